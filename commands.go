@@ -0,0 +1,522 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"whatAmIBuying/internal/render"
+	"whatAmIBuying/internal/services"
+)
+
+// commands maps subcommand names to their handlers, which receive the
+// arguments following the subcommand name
+var commands = map[string]func(ctx context.Context, args []string){
+	"model":     runModelCommand,
+	"eval":      runEvalCommand,
+	"cache":     runCacheCommand,
+	"models":    runModelsCommand,
+	"purchases": runPurchasesCommand,
+	"prompts":   runPromptsCommand,
+	"receipts":  runReceiptsCommand,
+	"predict":   runPredictCommand,
+	"insights":  runInsightsCommand,
+	"report":    runReportCommand,
+}
+
+func runModelCommand(ctx context.Context, args []string) {
+	if len(args) == 0 {
+		fmt.Println("usage: model train|evaluate [flags]")
+		os.Exit(2)
+	}
+
+	switch args[0] {
+	case "train":
+		fs := flag.NewFlagSet("model train", flag.ExitOnError)
+		path := fs.String("path", services.DefaultClassifierPath, "where to save the trained model")
+		fs.Parse(args[1:])
+
+		err := services.TrainClassifier(*path)
+		if err != nil {
+			log.Fatal("Error training classifier: ", err)
+		}
+	case "evaluate":
+		fs := flag.NewFlagSet("model evaluate", flag.ExitOnError)
+		testFraction := fs.Float64("test-fraction", 0.2, "fraction of categorized purchases held out for evaluation")
+		seed := fs.Int64("seed", 1, "seed used to shuffle purchases before splitting")
+		format := formatFlag(fs)
+		fs.Parse(args[1:])
+
+		err := services.EvaluateClassifier(*testFraction, *seed, *format)
+		if err != nil {
+			log.Fatal("Error evaluating classifier: ", err)
+		}
+	default:
+		fmt.Printf("unknown model command %q, expected train or evaluate\n", args[0])
+		os.Exit(2)
+	}
+}
+
+func runEvalCommand(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("eval", flag.ExitOnError)
+	categorizer := fs.String("categorizer", "llm", "categorizer to evaluate: llm, embedding, classifier, history, rules or auto")
+	dataset := fs.String("dataset", "mappings.txt", "labelled set: a mappings file or db for the categorized purchases")
+	limit := fs.Int("limit", 0, "evaluate at most this many purchases (0 for all)")
+	timeout := fs.Duration("timeout", 5*time.Minute, "maximum time a single LLM request may take")
+	retries := fs.Int("retries", 2, "how often a failed LLM request is retried when the failure is transient")
+	model := fs.String("model", services.DefaultLLMModel, "Ollama model used for LLM categorization")
+	pull := fs.Bool("pull", false, "pull the Ollama model if it is not installed")
+	prompt := fs.String("prompt", "", "prompt template file used for LLM categorization (default built-in prompt)")
+	testFraction := fs.Float64("test-fraction", 0.2, "fraction of categorized purchases held out for evaluation with -dataset db")
+	seed := fs.Int64("seed", 1, "seed used to shuffle purchases before splitting")
+	format := formatFlag(fs)
+	fs.Parse(args)
+
+	opts := services.CategorizeOptions{
+		Categorizer: *categorizer,
+		Model:       *model,
+		Pull:        *pull,
+		Timeout:     *timeout,
+		Progress:    os.Stderr,
+		Retries:     *retries,
+		PromptFile:  *prompt,
+	}
+	eval := services.EvalOptions{
+		Dataset:      *dataset,
+		Limit:        *limit,
+		TestFraction: *testFraction,
+		Seed:         *seed,
+		Format:       *format,
+	}
+	err := services.EvaluateCategorizer(ctx, opts, eval)
+	if err != nil {
+		log.Fatal("Error evaluating categorizer: ", err)
+	}
+}
+
+func runCacheCommand(ctx context.Context, args []string) {
+	if len(args) == 0 {
+		fmt.Println("usage: cache stats|clear [flags]")
+		os.Exit(2)
+	}
+
+	switch args[0] {
+	case "stats":
+		fs := flag.NewFlagSet("cache stats", flag.ExitOnError)
+		format := formatFlag(fs)
+		fs.Parse(args[1:])
+
+		err := services.ShowLLMCacheStats(*format)
+		if err != nil {
+			log.Fatal("Error reading LLM cache: ", err)
+		}
+	case "clear":
+		fs := flag.NewFlagSet("cache clear", flag.ExitOnError)
+		model := fs.String("model", "", "only remove the cached responses of this model")
+		all := fs.Bool("all", false, "remove the cached responses of every model")
+		fs.Parse(args[1:])
+
+		if *model == "" && !*all {
+			fmt.Println("cache clear needs -model <name> or -all")
+			os.Exit(2)
+		}
+
+		err := services.ClearLLMCache(*model)
+		if err != nil {
+			log.Fatal("Error clearing LLM cache: ", err)
+		}
+	default:
+		fmt.Printf("unknown cache command %q, expected stats or clear\n", args[0])
+		os.Exit(2)
+	}
+}
+
+func runModelsCommand(ctx context.Context, args []string) {
+	if len(args) == 0 {
+		fmt.Println("usage: models list|pull <name>")
+		os.Exit(2)
+	}
+
+	switch args[0] {
+	case "list":
+		fs := flag.NewFlagSet("models list", flag.ExitOnError)
+		format := formatFlag(fs)
+		fs.Parse(args[1:])
+
+		err := services.ListModels(ctx, *format)
+		if err != nil {
+			log.Fatal("Error listing models: ", err)
+		}
+	case "pull":
+		if len(args) < 2 {
+			fmt.Println("usage: models pull <name>")
+			os.Exit(2)
+		}
+		err := services.PullModel(ctx, args[1])
+		if err != nil {
+			log.Fatal("Error pulling model: ", err)
+		}
+	default:
+		fmt.Printf("unknown models command %q, expected list or pull\n", args[0])
+		os.Exit(2)
+	}
+}
+
+func runPurchasesCommand(ctx context.Context, args []string) {
+	if len(args) == 0 {
+		fmt.Println("usage: purchases explain [-prompt] [-format format] <id>")
+		os.Exit(2)
+	}
+
+	switch args[0] {
+	case "explain":
+		fs := flag.NewFlagSet("purchases explain", flag.ExitOnError)
+		showPrompt := fs.Bool("prompt", false, "also print the prompt sent to the model")
+		format := formatFlag(fs)
+		fs.Parse(args[1:])
+
+		if fs.NArg() != 1 {
+			fmt.Println("usage: purchases explain [-prompt] [-format format] <id>")
+			os.Exit(2)
+		}
+		id, err := strconv.Atoi(fs.Arg(0))
+		if err != nil {
+			fmt.Printf("invalid purchase ID %q\n", fs.Arg(0))
+			os.Exit(2)
+		}
+
+		err = services.ExplainPurchase(id, *showPrompt, *format)
+		if err != nil {
+			log.Fatal("Error explaining purchase: ", err)
+		}
+	default:
+		fmt.Printf("unknown purchases command %q, expected explain\n", args[0])
+		os.Exit(2)
+	}
+}
+
+func runPromptsCommand(ctx context.Context, args []string) {
+	if len(args) == 0 {
+		fmt.Println("usage: prompts render [-template file] [-format format] <purchase id> | prompts default")
+		os.Exit(2)
+	}
+
+	switch args[0] {
+	case "render":
+		fs := flag.NewFlagSet("prompts render", flag.ExitOnError)
+		template := fs.String("template", "", "prompt template file (default built-in prompt)")
+		format := formatFlag(fs)
+		fs.Parse(args[1:])
+
+		if fs.NArg() != 1 {
+			fmt.Println("usage: prompts render [-template file] [-format format] <purchase id>")
+			os.Exit(2)
+		}
+		id, err := strconv.Atoi(fs.Arg(0))
+		if err != nil {
+			fmt.Printf("invalid purchase ID %q\n", fs.Arg(0))
+			os.Exit(2)
+		}
+
+		err = services.RenderPrompt(*template, id, *format)
+		if err != nil {
+			log.Fatal("Error rendering prompt: ", err)
+		}
+	case "default":
+		services.PrintDefaultPromptTemplate()
+	default:
+		fmt.Printf("unknown prompts command %q, expected render or default\n", args[0])
+		os.Exit(2)
+	}
+}
+
+func runReceiptsCommand(ctx context.Context, args []string) {
+	if len(args) == 0 {
+		fmt.Println("usage: receipts import [flags] <image> | receipts rows [-out dir] <image> | receipts dates")
+		os.Exit(2)
+	}
+
+	switch args[0] {
+	case "import":
+		fs := flag.NewFlagSet("receipts import", flag.ExitOnError)
+		engine := fs.String("engine", "tesseract", "how the photo is read: tesseract, paddle or vision")
+		dump := fs.String("dump", "", "PaddleOCR JSON dump read by the paddle engine, next to the image if empty")
+		store := fs.String("store", "", "store the receipt is from")
+		clean := fs.String("clean", "rules", "how OCR product lines are cleaned: rules or llm")
+		model := fs.String("model", "", "Ollama model reading the photo with vision or cleaning lines with llm")
+		pull := fs.Bool("pull", false, "pull the Ollama model if it is not installed")
+		timeout := fs.Duration("timeout", 5*time.Minute, "maximum time a single Ollama request may take")
+		fs.Parse(args[1:])
+
+		if fs.NArg() != 1 {
+			fmt.Println("usage: receipts import [flags] <image>")
+			os.Exit(2)
+		}
+
+		var err error
+		if *engine == "vision" {
+			opts := services.VisionOptions{
+				Model:   *model,
+				Pull:    *pull,
+				Timeout: *timeout,
+			}
+			if opts.Model == "" {
+				opts.Model = services.DefaultVisionModel
+			}
+			err = services.ImportReceiptImage(ctx, opts, fs.Arg(0))
+		} else {
+			opts := services.OCRImportOptions{
+				Engine:  *engine,
+				Dump:    *dump,
+				Store:   *store,
+				Cleanup: *clean,
+				Model:   *model,
+				Pull:    *pull,
+				Timeout: *timeout,
+			}
+			err = services.ImportReceiptWithOCR(ctx, opts, fs.Arg(0))
+		}
+		if err != nil {
+			log.Fatal("Error importing receipt: ", err)
+		}
+	case "rows":
+		fs := flag.NewFlagSet("receipts rows", flag.ExitOnError)
+		out := fs.String("out", "rows", "directory the row images are written to")
+		fs.Parse(args[1:])
+
+		if fs.NArg() != 1 {
+			fmt.Println("usage: receipts rows [-out dir] <image>")
+			os.Exit(2)
+		}
+
+		err := services.SplitReceiptRows(fs.Arg(0), *out)
+		if err != nil {
+			log.Fatal("Error splitting receipt into rows: ", err)
+		}
+	case "dates":
+		fs := flag.NewFlagSet("receipts dates", flag.ExitOnError)
+		format := formatFlag(fs)
+		fs.Parse(args[1:])
+
+		err := services.CheckReceiptDates(*format)
+		if err != nil {
+			log.Fatal("Error checking receipt dates: ", err)
+		}
+	default:
+		fmt.Printf("unknown receipts command %q, expected import, rows or dates\n", args[0])
+		os.Exit(2)
+	}
+}
+
+// formatFlag defines the -format flag choosing how results are written
+func formatFlag(fs *flag.FlagSet) *render.Format {
+	format := render.Format(render.Formats[0])
+	fs.Var(&format, "format", "output `format`: "+strings.Join(render.Formats, ", "))
+	return &format
+}
+
+// predictTimeLayouts are the accepted formats of the predict -at flag
+var predictTimeLayouts = []string{"2006-01-02 15:04", "2006-01-02 15:04:05", "2006-01-02"}
+
+// parseAtFlag reads the local time of an -at flag, exiting on invalid times
+func parseAtFlag(value string) time.Time {
+	for _, layout := range predictTimeLayouts {
+		at, err := time.ParseInLocation(layout, value, time.Local)
+		if err == nil {
+			return at
+		}
+	}
+	fmt.Printf("invalid -at time %q, expected a time such as \"2026-10-20 18:00\"\n", value)
+	os.Exit(2)
+	return time.Time{}
+}
+
+// scoringFlags defines the flags weighing the purchase history of a
+// prediction and returns a function reading them once parsed
+func scoringFlags(fs *flag.FlagSet) func() services.ScoringOptions {
+	defaults := services.DefaultScoringOptions
+	halfLife := fs.Float64("half-life", defaults.HalfLife.Hours()/24, "days after which a purchase counts half as much, 0 for no decay")
+	weekday := fs.Float64("weekday-weight", defaults.Weekday, "weight of purchases made on a similar weekday")
+	month := fs.Float64("month-weight", defaults.Month, "weight of purchases made in a similar month")
+	timeOfDay := fs.Float64("time-weight", defaults.TimeOfDay, "weight of purchases made at a similar time of day")
+	recency := fs.Float64("recency-weight", defaults.Recency, "weight of every purchase by its age alone")
+
+	return func() services.ScoringOptions {
+		return services.ScoringOptions{
+			HalfLife:  time.Duration(*halfLife * 24 * float64(time.Hour)),
+			Weekday:   *weekday,
+			Month:     *month,
+			TimeOfDay: *timeOfDay,
+			Recency:   *recency,
+		}
+	}
+}
+
+func runPredictCommand(ctx context.Context, args []string) {
+	if len(args) > 0 && args[0] == "backtest" {
+		runPredictBacktestCommand(args[1:])
+		return
+	}
+	if len(args) > 0 && args[0] == "forecast" {
+		runPredictForecastCommand(args[1:])
+		return
+	}
+
+	name, list := "predict", false
+	if len(args) > 0 && args[0] == "shopping" {
+		name, list, args = "predict shopping", true, args[1:]
+	}
+
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	at := fs.String("at", "", "local time to predict purchases for, as \"2006-01-02 15:04\" (default now)")
+	days := fs.Int("days", 1, "number of days from -at to predict purchases over")
+	predictor := fs.String("predictor", "time", "predictor of categories: "+strings.Join(services.PredictorNames, ", "))
+	scoring := scoringFlags(fs)
+	format := formatFlag(fs)
+	fs.Parse(args)
+
+	opts := services.PredictOptions{
+		At:        time.Now(),
+		Days:      *days,
+		Predictor: *predictor,
+		Scoring:   scoring(),
+		Format:    *format,
+	}
+	if *at != "" {
+		opts.At = parseAtFlag(*at)
+	}
+
+	var err error
+	if list {
+		err = services.PredictShoppingList(opts)
+	} else {
+		err = services.PredictPurchases(opts)
+	}
+	if err != nil {
+		log.Fatal("Error predicting purchases: ", err)
+	}
+}
+
+func runPredictForecastCommand(args []string) {
+	fs := flag.NewFlagSet("predict forecast", flag.ExitOnError)
+	period := fs.String("period", "week", "length of a forecast period: week or month")
+	periods := fs.Int("periods", 4, "number of periods forecast")
+	level := fs.Float64("level", 0.8, "probability the spending falls within the prediction interval")
+	at := fs.String("at", "", "local time the forecast starts at, as \"2006-01-02\" (default now)")
+	format := formatFlag(fs)
+	fs.Parse(args)
+
+	opts := services.ForecastOptions{
+		Period:  *period,
+		Periods: *periods,
+		Level:   *level,
+		At:      time.Now(),
+		Format:  *format,
+	}
+	if *at != "" {
+		opts.At = parseAtFlag(*at)
+	}
+	err := services.ForecastSpending(opts)
+	if err != nil {
+		log.Fatal("Error forecasting spending: ", err)
+	}
+}
+
+func runPredictBacktestCommand(args []string) {
+	fs := flag.NewFlagSet("predict backtest", flag.ExitOnError)
+	level := fs.String("level", "category", "what is predicted: category, or product to backtest the shopping list")
+	k := fs.Int("k", 3, "number of best categories or products counted as predicted")
+	minHistory := fs.Int("min-history", 5, "receipts learned from before the first prediction is scored")
+	predictors := fs.String("predictor", "all", "comma separated category predictors to compare, or all: "+strings.Join(services.PredictorNames, ", "))
+	scoring := scoringFlags(fs)
+	format := formatFlag(fs)
+	fs.Parse(args)
+
+	opts := services.BacktestOptions{
+		Level:      *level,
+		K:          *k,
+		MinHistory: *minHistory,
+		Predictors: strings.Split(*predictors, ","),
+		Scoring:    scoring(),
+		Format:     *format,
+	}
+	if *predictors == "all" {
+		opts.Predictors = services.PredictorNames
+	}
+	err := services.BacktestPredictions(opts)
+	if err != nil {
+		log.Fatal("Error backtesting predictions: ", err)
+	}
+}
+
+func runInsightsCommand(ctx context.Context, args []string) {
+	if len(args) == 0 {
+		fmt.Println("usage: insights basket [flags]")
+		os.Exit(2)
+	}
+
+	switch args[0] {
+	case "basket":
+		defaults := services.DefaultBasketOptions
+		fs := flag.NewFlagSet("insights basket", flag.ExitOnError)
+		level := fs.String("level", defaults.Level, "what is bought together: product or category")
+		minSupport := fs.Float64("min-support", defaults.MinSupport, "fraction of receipts items must be bought together on")
+		minConfidence := fs.Float64("min-confidence", defaults.MinConfidence, "lowest fraction of receipts with the first items that hold the last one")
+		maxSize := fs.Int("max-size", defaults.MaxSize, "largest number of items in a rule")
+		limit := fs.Int("limit", defaults.Limit, "number of rules shown, 0 for all")
+		format := formatFlag(fs)
+		fs.Parse(args[1:])
+
+		opts := services.BasketOptions{
+			Level:         *level,
+			MinSupport:    *minSupport,
+			MinConfidence: *minConfidence,
+			MaxSize:       *maxSize,
+			Limit:         *limit,
+			Format:        *format,
+		}
+		err := services.BasketInsights(opts)
+		if err != nil {
+			log.Fatal("Error finding items bought together: ", err)
+		}
+	default:
+		fmt.Printf("unknown insights command %q, expected basket\n", args[0])
+		os.Exit(2)
+	}
+}
+
+func runReportCommand(ctx context.Context, args []string) {
+	if len(args) == 0 {
+		fmt.Println("usage: report spending [flags]")
+		os.Exit(2)
+	}
+
+	switch args[0] {
+	case "spending":
+		fs := flag.NewFlagSet("report spending", flag.ExitOnError)
+		from := fs.String("from", "", "first local day reported, as \"2006-01-02\" (default the first receipt)")
+		to := fs.String("to", "", "last local day reported, as \"2006-01-02\" (default the last receipt)")
+		groupBy := fs.String("group-by", "category", "what spending is summed by: category, store, week, month or product")
+		format := formatFlag(fs)
+		fs.Parse(args[1:])
+
+		opts := services.ReportOptions{GroupBy: *groupBy, Format: *format}
+		if *from != "" {
+			opts.From = parseAtFlag(*from)
+		}
+		if *to != "" {
+			opts.To = parseAtFlag(*to)
+		}
+		err := services.ReportSpending(opts)
+		if err != nil {
+			log.Fatal("Error reporting spending: ", err)
+		}
+	default:
+		fmt.Printf("unknown report command %q, expected spending\n", args[0])
+		os.Exit(2)
+	}
+}
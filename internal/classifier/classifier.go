@@ -0,0 +1,229 @@
+package classifier
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+)
+
+const (
+	minGram = 2
+	maxGram = 4
+)
+
+// Example is a labelled piece of text used to train or evaluate a model
+type Example struct {
+	Text  string
+	Label int
+}
+
+// ClassStats holds the feature counts of one class
+type ClassStats struct {
+	Documents     int            `json:"documents"`
+	FeatureCounts map[string]int `json:"featureCounts"`
+	TotalFeatures int            `json:"totalFeatures"`
+}
+
+// NaiveBayes is a multinomial naive Bayes classifier over character n-grams
+type NaiveBayes struct {
+	Classes    map[int]*ClassStats `json:"classes"`
+	Vocabulary map[string]bool     `json:"vocabulary"`
+	Documents  int                 `json:"documents"`
+}
+
+// Features splits text into its words and character n-grams
+func Features(text string) []string {
+	var features []string
+	for _, word := range strings.Fields(strings.ToLower(text)) {
+		features = append(features, "w:"+word)
+
+		padded := []rune("^" + word + "$")
+		for n := minGram; n <= maxGram; n++ {
+			for i := 0; i+n <= len(padded); i++ {
+				features = append(features, string(padded[i:i+n]))
+			}
+		}
+	}
+	return features
+}
+
+// Train builds a model from the given examples
+func Train(examples []Example) *NaiveBayes {
+	model := &NaiveBayes{
+		Classes:    make(map[int]*ClassStats),
+		Vocabulary: make(map[string]bool),
+	}
+
+	for _, e := range examples {
+		stats := model.Classes[e.Label]
+		if stats == nil {
+			stats = &ClassStats{FeatureCounts: make(map[string]int)}
+			model.Classes[e.Label] = stats
+		}
+
+		stats.Documents++
+		model.Documents++
+		for _, f := range Features(e.Text) {
+			stats.FeatureCounts[f]++
+			stats.TotalFeatures++
+			model.Vocabulary[f] = true
+		}
+	}
+
+	return model
+}
+
+// Predict returns the most likely label for the text and its probability
+func (m *NaiveBayes) Predict(text string) (int, float64, error) {
+	if m.Documents == 0 {
+		return 0, 0, fmt.Errorf("model has not been trained")
+	}
+
+	features := Features(text)
+	vocabularySize := float64(len(m.Vocabulary))
+
+	labels := make([]int, 0, len(m.Classes))
+	for label := range m.Classes {
+		labels = append(labels, label)
+	}
+	sort.Ints(labels)
+
+	// Log probabilities with Laplace smoothing, unknown features are ignored
+	logProbs := make([]float64, len(labels))
+	for i, label := range labels {
+		stats := m.Classes[label]
+		logProb := math.Log(float64(stats.Documents) / float64(m.Documents))
+		for _, f := range features {
+			if !m.Vocabulary[f] {
+				continue
+			}
+			logProb += math.Log((float64(stats.FeatureCounts[f]) + 1) / (float64(stats.TotalFeatures) + vocabularySize))
+		}
+		logProbs[i] = logProb
+	}
+
+	best := 0
+	for i := range logProbs {
+		if logProbs[i] > logProbs[best] {
+			best = i
+		}
+	}
+
+	var total float64
+	for _, lp := range logProbs {
+		total += math.Exp(lp - logProbs[best])
+	}
+
+	return labels[best], 1 / total, nil
+}
+
+// Save writes the model to a JSON file
+func (m *NaiveBayes) Save(path string) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("error marshaling model: %w", err)
+	}
+
+	err = os.WriteFile(path, data, 0644)
+	if err != nil {
+		return fmt.Errorf("error writing model file: %w", err)
+	}
+
+	return nil
+}
+
+// Load reads a model previously written by Save
+func Load(path string) (*NaiveBayes, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading model file: %w", err)
+	}
+
+	var model NaiveBayes
+	err = json.Unmarshal(data, &model)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshaling model: %w", err)
+	}
+
+	return &model, nil
+}
+
+// Split shuffles the examples with the given seed and holds out testFraction
+// of them for evaluation
+func Split(examples []Example, testFraction float64, seed int64) ([]Example, []Example) {
+	shuffled := make([]Example, len(examples))
+	copy(shuffled, examples)
+	rand.New(rand.NewSource(seed)).Shuffle(len(shuffled), func(i, j int) {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	})
+
+	testSize := int(math.Round(float64(len(shuffled)) * testFraction))
+	return shuffled[testSize:], shuffled[:testSize]
+}
+
+// ClassMetrics holds the evaluation results of a single class
+type ClassMetrics struct {
+	Precision float64
+	Recall    float64
+	Support   int
+}
+
+// Evaluation holds the results of evaluating a model on labelled examples
+type Evaluation struct {
+	Accuracy float64
+	PerClass map[int]ClassMetrics
+}
+
+// Evaluate measures the accuracy and per class precision and recall of the
+// model on the given examples
+func Evaluate(m *NaiveBayes, examples []Example) (Evaluation, error) {
+	truePositives := make(map[int]int)
+	predicted := make(map[int]int)
+	actual := make(map[int]int)
+	correct := 0
+
+	for _, e := range examples {
+		label, _, err := m.Predict(e.Text)
+		if err != nil {
+			return Evaluation{}, err
+		}
+
+		predicted[label]++
+		actual[e.Label]++
+		if label == e.Label {
+			truePositives[label]++
+			correct++
+		}
+	}
+
+	evaluation := Evaluation{PerClass: make(map[int]ClassMetrics)}
+	if len(examples) > 0 {
+		evaluation.Accuracy = float64(correct) / float64(len(examples))
+	}
+
+	labels := make(map[int]bool)
+	for label := range m.Classes {
+		labels[label] = true
+	}
+	for label := range actual {
+		labels[label] = true
+	}
+
+	for label := range labels {
+		var metrics ClassMetrics
+		metrics.Support = actual[label]
+		if predicted[label] > 0 {
+			metrics.Precision = float64(truePositives[label]) / float64(predicted[label])
+		}
+		if actual[label] > 0 {
+			metrics.Recall = float64(truePositives[label]) / float64(actual[label])
+		}
+		evaluation.PerClass[label] = metrics
+	}
+
+	return evaluation, nil
+}
@@ -0,0 +1,142 @@
+package classifier
+
+import (
+	"os"
+	"testing"
+)
+
+var trainingExamples = []Example{
+	{Text: "whole milk", Label: 1},
+	{Text: "semi skimmed milk", Label: 1},
+	{Text: "greek natural yogurt", Label: 1},
+	{Text: "mature cheddar", Label: 1},
+	{Text: "chick breast fil", Label: 2},
+	{Text: "chicken thighs", Label: 2},
+	{Text: "chicken drumsticks", Label: 2},
+	{Text: "blueberries", Label: 3},
+	{Text: "strawberries", Label: 3},
+	{Text: "bananas loose", Label: 3},
+}
+
+func TestFeatures(t *testing.T) {
+	features := Features("Milk")
+
+	expected := map[string]bool{"w:milk": true, "^m": true, "mil": true, "ilk$": true}
+	found := make(map[string]bool)
+	for _, f := range features {
+		found[f] = true
+	}
+	for f := range expected {
+		if !found[f] {
+			t.Errorf("Expected feature %q in %v", f, features)
+		}
+	}
+
+	if len(Features("")) != 0 {
+		t.Error("Expected no features for empty text")
+	}
+}
+
+func TestPredict(t *testing.T) {
+	model := Train(trainingExamples)
+
+	tests := []struct {
+		text     string
+		expected int
+	}{
+		{text: "milk", expected: 1},
+		{text: "chicken breast", expected: 2},
+		{text: "raspberries", expected: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			label, probability, err := model.Predict(tt.text)
+			if err != nil {
+				t.Fatalf("Predict() error = %v", err)
+			}
+			if label != tt.expected {
+				t.Errorf("Predict() = %d, want %d", label, tt.expected)
+			}
+			if probability <= 0 || probability > 1 {
+				t.Errorf("Predict() probability = %f, want within (0, 1]", probability)
+			}
+		})
+	}
+}
+
+func TestPredictUntrained(t *testing.T) {
+	model := Train(nil)
+	_, _, err := model.Predict("milk")
+	if err == nil {
+		t.Error("Expected an error when predicting with an untrained model")
+	}
+}
+
+func TestSaveAndLoad(t *testing.T) {
+	path := "test_model.json"
+	defer os.Remove(path)
+
+	model := Train(trainingExamples)
+	if err := model.Save(path); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	for _, e := range trainingExamples {
+		want, _, _ := model.Predict(e.Text)
+		got, _, _ := loaded.Predict(e.Text)
+		if got != want {
+			t.Errorf("Loaded model predicted %d for %q, original predicted %d", got, e.Text, want)
+		}
+	}
+}
+
+func TestSplit(t *testing.T) {
+	train, test := Split(trainingExamples, 0.3, 42)
+
+	if len(test) != 3 {
+		t.Errorf("Expected 3 test examples, got %d", len(test))
+	}
+	if len(train) != 7 {
+		t.Errorf("Expected 7 training examples, got %d", len(train))
+	}
+
+	trainAgain, _ := Split(trainingExamples, 0.3, 42)
+	for i := range train {
+		if train[i] != trainAgain[i] {
+			t.Fatal("Expected the same seed to produce the same split")
+		}
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	model := Train(trainingExamples)
+
+	evaluation, err := Evaluate(model, []Example{
+		{Text: "milk", Label: 1},
+		{Text: "chicken", Label: 2},
+		{Text: "blueberries", Label: 1},
+	})
+	if err != nil {
+		t.Fatalf("Evaluate() error = %v", err)
+	}
+
+	if evaluation.Accuracy < 0.66 || evaluation.Accuracy > 0.67 {
+		t.Errorf("Expected accuracy of 2/3, got %f", evaluation.Accuracy)
+	}
+
+	dairy := evaluation.PerClass[1]
+	if dairy.Precision != 1 || dairy.Recall != 0.5 || dairy.Support != 2 {
+		t.Errorf("Unexpected dairy metrics %+v", dairy)
+	}
+
+	fruit := evaluation.PerClass[3]
+	if fruit.Precision != 0 || fruit.Support != 0 {
+		t.Errorf("Unexpected fruit metrics %+v", fruit)
+	}
+}
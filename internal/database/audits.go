@@ -0,0 +1,73 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+	"whatAmIBuying/internal/models"
+)
+
+func CreateAuditTable(db *sql.DB) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS CategorizationAudits (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		purchaseId INTEGER NOT NULL,
+		categoryId INTEGER NOT NULL,
+		model TEXT NOT NULL,
+		promptVersion TEXT NOT NULL,
+		prompt TEXT NOT NULL,
+		rawResponse TEXT NOT NULL,
+		reasoning TEXT NOT NULL,
+		promptTokens INTEGER NOT NULL,
+		responseTokens INTEGER NOT NULL,
+		durationNs INTEGER NOT NULL,
+		cached INTEGER NOT NULL,
+		createdAt TEXT NOT NULL,
+		FOREIGN KEY(purchaseId) REFERENCES Purchases(id)
+	)`)
+	if err != nil {
+		return fmt.Errorf("Error creating CategorizationAudits table: %w", err)
+	}
+
+	return nil
+}
+
+func AddCategorizationAudit(db *sql.DB, audit models.CategorizationAudit) (int64, error) {
+	result, err := db.Exec(`INSERT INTO CategorizationAudits
+	(purchaseId, categoryId, model, promptVersion, prompt, rawResponse, reasoning, promptTokens, responseTokens, durationNs, cached, createdAt)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		audit.PurchaseID, audit.CategoryID, audit.Model, audit.PromptVersion, audit.Prompt, audit.RawResponse, audit.Reasoning,
+		audit.PromptTokens, audit.ResponseTokens, int64(audit.Duration), audit.Cached, time.Now().UTC().Format("2006-01-02 15:04:05"))
+	if err != nil {
+		return 0, fmt.Errorf("Query failed: %w", err)
+	}
+
+	return result.LastInsertId()
+}
+
+// GetAuditsForPurchase returns the audits of a purchase, newest first
+func GetAuditsForPurchase(db *sql.DB, purchaseId int) ([]models.CategorizationAudit, error) {
+	rows, err := db.Query(`SELECT id, purchaseId, categoryId, model, promptVersion, prompt, rawResponse, reasoning,
+	promptTokens, responseTokens, durationNs, cached, createdAt
+	FROM CategorizationAudits
+	WHERE purchaseId = ?
+	ORDER BY id DESC`, purchaseId)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading from CategorizationAudits table: %w", err)
+	}
+	defer rows.Close()
+
+	var audits []models.CategorizationAudit
+	for rows.Next() {
+		var a models.CategorizationAudit
+		var durationNs int64
+		err := rows.Scan(&a.ID, &a.PurchaseID, &a.CategoryID, &a.Model, &a.PromptVersion, &a.Prompt, &a.RawResponse, &a.Reasoning,
+			&a.PromptTokens, &a.ResponseTokens, &durationNs, &a.Cached, &a.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("Error scanning audit: %w", err)
+		}
+		a.Duration = time.Duration(durationNs)
+		audits = append(audits, a)
+	}
+
+	return audits, nil
+}
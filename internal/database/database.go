@@ -4,5 +4,46 @@ import "database/sql"
 
 func OpenDatabase() (*sql.DB, error) {
 	db, err := sql.Open("sqlite", "test_database.db")
-	return db, err
+	if err != nil {
+		return nil, err
+	}
+
+	err = Migrate(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// Migrate brings the Receipts and Purchases tables of an older database up to
+// date. It runs when the database is opened and only writes to a database
+// missing columns or holding receipt dates not parsed yet, so reading from an
+// up to date database never writes to it. Tables that do not exist yet are
+// left alone
+func Migrate(db *sql.DB) error {
+	columns, err := tableColumns(db, "Receipts")
+	if err != nil {
+		return err
+	}
+	if len(columns) > 0 {
+		err = MigrateReceipts(db)
+		if err != nil {
+			return err
+		}
+	}
+
+	columns, err = tableColumns(db, "Purchases")
+	if err != nil {
+		return err
+	}
+	if len(columns) > 0 {
+		err = MigratePurchases(db)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
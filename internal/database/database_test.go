@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"os"
 	"testing"
+	"time"
 	"whatAmIBuying/internal/models"
 
 	_ "modernc.org/sqlite"
@@ -47,6 +48,11 @@ func setupTestDB(t *testing.T) (*sql.DB, func()) {
 		t.Fatalf("Failed to create tables: %v", err)
 	}
 
+	err = Migrate(db)
+	if err != nil {
+		t.Fatalf("Failed to migrate tables: %v", err)
+	}
+
 	// Seed categories
 	categories := []string{"Dairy", "Meat", "Vegetables", "Fruit", "Snacks"}
 	for _, cat := range categories {
@@ -296,3 +302,374 @@ func TestGetCategoryNameByID(t *testing.T) {
 		})
 	}
 }
+
+func TestGetCategorizedPurchases(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	receipt := models.Receipt{
+		Date:   "2026-01-01 10:00:00",
+		Amount: "10.00",
+		Purchases: []models.Purchase{
+			{Product: "Milk", Price: "2.50"},
+			{Product: "Chicken", Price: "7.50"},
+		},
+	}
+	AddReceipt(receipt, db)
+
+	categoryId := 1
+	purchaseId := 1
+	_, err := ChangePurchaseCategory(db, &categoryId, &purchaseId)
+	if err != nil {
+		t.Fatalf("ChangePurchaseCategory() error = %v", err)
+	}
+
+	purchases, err := GetCategorizedPurchases(db)
+	if err != nil {
+		t.Fatalf("GetCategorizedPurchases() error = %v", err)
+	}
+
+	if len(purchases) != 1 {
+		t.Fatalf("Expected 1 categorized purchase, got %d", len(purchases))
+	}
+	if purchases[0].Product != "Milk" {
+		t.Errorf("Expected 'Milk', got '%s'", purchases[0].Product)
+	}
+	if !purchases[0].CategoryId.Valid || purchases[0].CategoryId.Int64 != 1 {
+		t.Errorf("Expected CategoryId = 1, got %v", purchases[0].CategoryId)
+	}
+}
+
+func TestSaveAndGetEmbedding(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	if err := CreateEmbeddingsTable(db); err != nil {
+		t.Fatalf("CreateEmbeddingsTable() error = %v", err)
+	}
+
+	_, found, err := GetEmbedding(db, "test-model", "milk")
+	if err != nil {
+		t.Fatalf("GetEmbedding() error = %v", err)
+	}
+	if found {
+		t.Error("Expected no embedding before saving one")
+	}
+
+	vector := []float64{0.5, -1.25, 3}
+	if err := SaveEmbedding(db, "test-model", "milk", vector); err != nil {
+		t.Fatalf("SaveEmbedding() error = %v", err)
+	}
+
+	got, found, err := GetEmbedding(db, "test-model", "milk")
+	if err != nil {
+		t.Fatalf("GetEmbedding() error = %v", err)
+	}
+	if !found {
+		t.Fatal("Expected embedding to be found after saving")
+	}
+	if len(got) != len(vector) {
+		t.Fatalf("Expected vector of length %d, got %d", len(vector), len(got))
+	}
+	for i := range vector {
+		if got[i] != vector[i] {
+			t.Errorf("vector[%d] = %f, want %f", i, got[i], vector[i])
+		}
+	}
+
+	_, found, _ = GetEmbedding(db, "other-model", "milk")
+	if found {
+		t.Error("Embeddings should be cached per model")
+	}
+}
+
+func TestLLMCache(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	if err := CreateLLMCacheTable(db); err != nil {
+		t.Fatalf("CreateLLMCacheTable() error = %v", err)
+	}
+
+	_, found, err := GetCachedResponse(db, "model-a", "v1", "milk")
+	if err != nil {
+		t.Fatalf("GetCachedResponse() error = %v", err)
+	}
+	if found {
+		t.Error("Expected no cached response before saving one")
+	}
+
+	SaveCachedResponse(db, "model-a", "v1", "milk", `{"ID": 5}`)
+	SaveCachedResponse(db, "model-a", "v1", "bread", `{"ID": 8}`)
+	SaveCachedResponse(db, "model-b", "v1", "milk", `{"ID": 4}`)
+
+	response, found, err := GetCachedResponse(db, "model-a", "v1", "milk")
+	if err != nil || !found {
+		t.Fatalf("GetCachedResponse() found = %v, error = %v", found, err)
+	}
+	if response != `{"ID": 5}` {
+		t.Errorf("Expected cached response for model-a, got %s", response)
+	}
+
+	_, found, _ = GetCachedResponse(db, "model-a", "v2", "milk")
+	if found {
+		t.Error("Responses should be cached per prompt version")
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := RecordCacheHit(db, "model-a", "v1", "milk"); err != nil {
+			t.Fatalf("RecordCacheHit() error = %v", err)
+		}
+	}
+
+	stats, err := GetLLMCacheStats(db)
+	if err != nil {
+		t.Fatalf("GetLLMCacheStats() error = %v", err)
+	}
+	if len(stats) != 2 || stats[0].Model != "model-a" || stats[0].Entries != 2 {
+		t.Errorf("Unexpected cache stats %+v", stats)
+	}
+	if stats[0].Hits != 2 || stats[0].LastUsed == "" || stats[1].Hits != 0 || stats[1].LastUsed != "" {
+		t.Errorf("Expected 2 hits of model-a only, got %+v", stats)
+	}
+
+	deleted, err := DeleteCachedResponses(db, "model-a")
+	if err != nil {
+		t.Fatalf("DeleteCachedResponses() error = %v", err)
+	}
+	if deleted != 2 {
+		t.Errorf("Expected 2 deleted entries, got %d", deleted)
+	}
+
+	_, found, _ = GetCachedResponse(db, "model-b", "v1", "milk")
+	if !found {
+		t.Error("Entries of other models should be kept")
+	}
+}
+
+func TestCreateLLMCacheTableAddsHits(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	// The table as created before hits were recorded
+	db.Exec(`CREATE TABLE LLMCache (
+		model TEXT NOT NULL,
+		promptVersion TEXT NOT NULL,
+		name TEXT NOT NULL,
+		response TEXT NOT NULL,
+		createdAt TEXT NOT NULL,
+		PRIMARY KEY(model, promptVersion, name)
+	)`)
+	SaveCachedResponse(db, "model-a", "v1", "milk", `{"ID": 5}`)
+
+	if err := CreateLLMCacheTable(db); err != nil {
+		t.Fatalf("CreateLLMCacheTable() error = %v", err)
+	}
+	if err := RecordCacheHit(db, "model-a", "v1", "milk"); err != nil {
+		t.Fatalf("RecordCacheHit() error = %v", err)
+	}
+
+	stats, _ := GetLLMCacheStats(db)
+	if len(stats) != 1 || stats[0].Hits != 1 {
+		t.Errorf("Expected the hit of the older entry, got %+v", stats)
+	}
+}
+
+func TestCategorizationAudits(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	if err := CreateAuditTable(db); err != nil {
+		t.Fatalf("CreateAuditTable() error = %v", err)
+	}
+
+	result, _ := db.Exec("INSERT INTO Receipts (date, amount) VALUES (?, ?)", "2025-01-06 10:00:00", "5.00")
+	receiptId, _ := result.LastInsertId()
+	result, _ = db.Exec("INSERT INTO Purchases (name, price, receiptId) VALUES (?, ?, ?)", "Whole Milk", "1.20", receiptId)
+	purchaseId, _ := result.LastInsertId()
+
+	_, err := AddCategorizationAudit(db, models.CategorizationAudit{
+		PurchaseID:     int(purchaseId),
+		CategoryID:     2,
+		Model:          "model-a",
+		PromptVersion:  "v1",
+		Prompt:         "Categorize Whole Milk",
+		RawResponse:    `<think>meat?</think>{"ID": 2}`,
+		Reasoning:      "meat?",
+		PromptTokens:   120,
+		ResponseTokens: 30,
+		Duration:       1500 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("AddCategorizationAudit() error = %v", err)
+	}
+	AddCategorizationAudit(db, models.CategorizationAudit{
+		PurchaseID: int(purchaseId),
+		CategoryID: 1,
+		Model:      "model-a",
+		Cached:     true,
+	})
+
+	audits, err := GetAuditsForPurchase(db, int(purchaseId))
+	if err != nil {
+		t.Fatalf("GetAuditsForPurchase() error = %v", err)
+	}
+	if len(audits) != 2 {
+		t.Fatalf("Expected 2 audits, got %d", len(audits))
+	}
+	if !audits[0].Cached || audits[0].CategoryID != 1 {
+		t.Errorf("Expected the newest audit first, got %+v", audits[0])
+	}
+	if audits[1].Reasoning != "meat?" || audits[1].PromptTokens != 120 || audits[1].Duration != 1500*time.Millisecond {
+		t.Errorf("Audit details were not stored, got %+v", audits[1])
+	}
+
+	purchase, err := GetPurchaseByID(db, int(purchaseId))
+	if err != nil {
+		t.Fatalf("GetPurchaseByID() error = %v", err)
+	}
+	if purchase.Product != "Whole Milk" {
+		t.Errorf("Expected Whole Milk, got %s", purchase.Product)
+	}
+
+	_, err = GetPurchaseByID(db, 999)
+	if err == nil {
+		t.Error("Expected an error for an unknown purchase")
+	}
+}
+
+func TestMigrateReceipts(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	for i := 0; i < 2; i++ {
+		if err := MigrateReceipts(db); err != nil {
+			t.Fatalf("MigrateReceipts() run %d error = %v", i+1, err)
+		}
+	}
+
+	id, err := AddReceipt(models.Receipt{Date: "2026-01-01 10:00:00", Amount: "1.00", Store: "Lidl"}, db)
+	if err != nil {
+		t.Fatalf("AddReceipt() error = %v", err)
+	}
+
+	var store string
+	db.QueryRow("SELECT store FROM Receipts WHERE id = ?", id).Scan(&store)
+	if store != "Lidl" {
+		t.Errorf("Expected store Lidl, got %q", store)
+	}
+}
+
+func TestAddReceiptStoresQuantities(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	id, err := AddReceipt(models.Receipt{
+		Date:   "2026-01-01 10:00:00",
+		Amount: "1.78",
+		Purchases: []models.Purchase{
+			{Product: "Demi Baguette", Price: "0.78", PriceFloat: 0.78, Quantity: 2, UnitPrice: 0.39},
+			{Product: "Milk", Price: "1.00", PriceFloat: 1.00},
+		},
+	}, db)
+	if err != nil {
+		t.Fatalf("AddReceipt() error = %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		quantity  sql.NullFloat64
+		unitPrice sql.NullFloat64
+	}{
+		{"Demi Baguette", sql.NullFloat64{Float64: 2, Valid: true}, sql.NullFloat64{Float64: 0.39, Valid: true}},
+		{"Milk", sql.NullFloat64{}, sql.NullFloat64{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var quantity, unitPrice sql.NullFloat64
+			err := db.QueryRow("SELECT quantity, unitPrice FROM Purchases WHERE receiptId = ? AND name = ?", id, tt.name).Scan(&quantity, &unitPrice)
+			if err != nil {
+				t.Fatalf("Failed to query purchase: %v", err)
+			}
+			if quantity != tt.quantity || unitPrice != tt.unitPrice {
+				t.Errorf("Got %v x %v, want %v x %v", quantity, unitPrice, tt.quantity, tt.unitPrice)
+			}
+		})
+	}
+}
+
+func TestAddReceiptKeepsDate(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	previous := ReceiptLocation
+	ReceiptLocation = time.UTC
+	defer func() { ReceiptLocation = previous }()
+
+	id, err := AddReceipt(models.Receipt{Date: "26/01/25 12:02", Amount: "1.00"}, db)
+	if err != nil {
+		t.Fatalf("AddReceipt() error = %v", err)
+	}
+
+	var date string
+	var dateUtc, dateError sql.NullString
+	db.QueryRow("SELECT date, dateUtc, dateError FROM Receipts WHERE id = ?", id).Scan(&date, &dateUtc, &dateError)
+	if date != "26/01/25 12:02" || dateUtc.String != "2025-01-26 12:02:00" || dateError.Valid {
+		t.Errorf("Receipt = %q, %v, %v, want the date as written and parsed", date, dateUtc, dateError)
+	}
+}
+
+func TestMigrateReceiptsNormalizesDates(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	previous := ReceiptLocation
+	ReceiptLocation = time.FixedZone("", 3600)
+	defer func() { ReceiptLocation = previous }()
+
+	for _, date := range []string{"26/01/25 12:02", "2025-04-29 19:07:17.522446", "yesterday"} {
+		db.Exec("INSERT INTO Receipts (date, amount) VALUES (?, ?)", date, "1.00")
+	}
+
+	if err := MigrateReceipts(db); err != nil {
+		t.Fatalf("MigrateReceipts() error = %v", err)
+	}
+
+	tests := []struct {
+		id       int
+		date     string
+		dateUtc  sql.NullString
+		timezone string
+	}{
+		// The date is kept as written
+		{1, "26/01/25 12:02", sql.NullString{String: "2025-01-26 11:02:00", Valid: true}, "+01:00"},
+		{2, "2025-04-29 19:07:17.522446", sql.NullString{String: "2025-04-29 18:07:17", Valid: true}, "+01:00"},
+		{3, "yesterday", sql.NullString{}, ""},
+	}
+	for _, tt := range tests {
+		var date, timezone string
+		var dateUtc sql.NullString
+		db.QueryRow("SELECT date, dateUtc, timezone FROM Receipts WHERE id = ?", tt.id).Scan(&date, &dateUtc, &timezone)
+		if date != tt.date || dateUtc != tt.dateUtc || timezone != tt.timezone {
+			t.Errorf("Receipt %d = %q, %v, %q, want %q, %v, %q", tt.id, date, dateUtc, timezone, tt.date, tt.dateUtc, tt.timezone)
+		}
+	}
+
+	flagged, err := GetReceiptDateErrors(db)
+	if err != nil {
+		t.Fatalf("GetReceiptDateErrors() error = %v", err)
+	}
+	if len(flagged) != 1 || flagged[0].ReceiptID != 3 || flagged[0].Date != "yesterday" || flagged[0].Error == "" {
+		t.Errorf("Expected receipt 3 flagged, got %+v", flagged)
+	}
+
+	id, err := AddReceipt(models.Receipt{Date: "last Tuesday", Amount: "1.00"}, db)
+	if err != nil {
+		t.Fatalf("AddReceipt() error = %v", err)
+	}
+	flagged, _ = GetReceiptDateErrors(db)
+	if len(flagged) != 2 || flagged[1].ReceiptID != int(id) || flagged[1].Date != "last Tuesday" {
+		t.Errorf("Expected the receipt with an invalid date stored and flagged, got %+v", flagged)
+	}
+}
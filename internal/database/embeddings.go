@@ -0,0 +1,60 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+func CreateEmbeddingsTable(db *sql.DB) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS Embeddings (
+		model TEXT NOT NULL,
+		name TEXT NOT NULL,
+		vector BLOB NOT NULL,
+		PRIMARY KEY(model, name)
+	)`)
+	if err != nil {
+		return fmt.Errorf("Error creating Embeddings table: %w", err)
+	}
+
+	return nil
+}
+
+func GetEmbedding(db *sql.DB, model string, name string) ([]float64, bool, error) {
+	var blob []byte
+	err := db.QueryRow("SELECT vector FROM Embeddings WHERE model = ? AND name = ?", model, name).Scan(&blob)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("error querying embedding: %w", err)
+	}
+
+	return decodeVector(blob), true, nil
+}
+
+func SaveEmbedding(db *sql.DB, model string, name string, vector []float64) error {
+	_, err := db.Exec("INSERT OR REPLACE INTO Embeddings (model, name, vector) VALUES (?, ?, ?)", model, name, encodeVector(vector))
+	if err != nil {
+		return fmt.Errorf("Query failed: %w", err)
+	}
+
+	return nil
+}
+
+func encodeVector(vector []float64) []byte {
+	blob := make([]byte, 8*len(vector))
+	for i, v := range vector {
+		binary.LittleEndian.PutUint64(blob[i*8:], math.Float64bits(v))
+	}
+	return blob
+}
+
+func decodeVector(blob []byte) []float64 {
+	vector := make([]float64, len(blob)/8)
+	for i := range vector {
+		vector[i] = math.Float64frombits(binary.LittleEndian.Uint64(blob[i*8:]))
+	}
+	return vector
+}
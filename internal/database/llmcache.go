@@ -0,0 +1,106 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+	"whatAmIBuying/internal/models"
+)
+
+func CreateLLMCacheTable(db *sql.DB) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS LLMCache (
+		model TEXT NOT NULL,
+		promptVersion TEXT NOT NULL,
+		name TEXT NOT NULL,
+		response TEXT NOT NULL,
+		createdAt TEXT NOT NULL,
+		hits INTEGER NOT NULL DEFAULT 0,
+		lastUsed TEXT,
+		PRIMARY KEY(model, promptVersion, name)
+	)`)
+	if err != nil {
+		return fmt.Errorf("Error creating LLMCache table: %w", err)
+	}
+
+	// hits counts how often a response was answered from the cache and
+	// lastUsed is when it last was
+	return addColumns(db, "LLMCache", []column{
+		{"hits", "hits INTEGER NOT NULL DEFAULT 0"},
+		{"lastUsed", "lastUsed TEXT"},
+	})
+}
+
+func GetCachedResponse(db *sql.DB, model string, promptVersion string, name string) (string, bool, error) {
+	var response string
+	err := db.QueryRow("SELECT response FROM LLMCache WHERE model = ? AND promptVersion = ? AND name = ?",
+		model, promptVersion, name).Scan(&response)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", false, nil
+		}
+		return "", false, fmt.Errorf("error querying LLM cache: %w", err)
+	}
+
+	return response, true, nil
+}
+
+func SaveCachedResponse(db *sql.DB, model string, promptVersion string, name string, response string) error {
+	_, err := db.Exec("INSERT OR REPLACE INTO LLMCache (model, promptVersion, name, response, createdAt) VALUES (?, ?, ?, ?, ?)",
+		model, promptVersion, name, response, time.Now().UTC().Format("2006-01-02 15:04:05"))
+	if err != nil {
+		return fmt.Errorf("Query failed: %w", err)
+	}
+
+	return nil
+}
+
+// RecordCacheHit counts that a cached response was used instead of calling
+// the model
+func RecordCacheHit(db *sql.DB, model string, promptVersion string, name string) error {
+	_, err := db.Exec("UPDATE LLMCache SET hits = hits + 1, lastUsed = ? WHERE model = ? AND promptVersion = ? AND name = ?",
+		time.Now().UTC().Format("2006-01-02 15:04:05"), model, promptVersion, name)
+	if err != nil {
+		return fmt.Errorf("Query failed: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteCachedResponses removes the cached responses of a model, or of all
+// models if model is empty, and returns how many were removed
+func DeleteCachedResponses(db *sql.DB, model string) (int64, error) {
+	var result sql.Result
+	var err error
+	if model == "" {
+		result, err = db.Exec("DELETE FROM LLMCache")
+	} else {
+		result, err = db.Exec("DELETE FROM LLMCache WHERE model = ?", model)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("Query failed: %w", err)
+	}
+
+	return result.RowsAffected()
+}
+
+func GetLLMCacheStats(db *sql.DB) ([]models.LLMCacheStats, error) {
+	rows, err := db.Query(`SELECT model, promptVersion, COUNT(*), SUM(hits), COALESCE(MAX(lastUsed), '') FROM LLMCache
+	GROUP BY model, promptVersion
+	ORDER BY model, promptVersion`)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading from LLMCache table: %w", err)
+	}
+	defer rows.Close()
+
+	var stats []models.LLMCacheStats
+	for rows.Next() {
+		var s models.LLMCacheStats
+		err := rows.Scan(&s.Model, &s.PromptVersion, &s.Entries, &s.Hits, &s.LastUsed)
+		if err != nil {
+			return nil, fmt.Errorf("Error scanning cache stats: %w", err)
+		}
+		stats = append(stats, s)
+	}
+
+	return stats, nil
+}
@@ -20,8 +20,26 @@ func AddPurchaseList(purchases []models.Purchase, receiptId int64, ctx context.C
 	return nil
 }
 
+// MigratePurchases adds the columns introduced after the Purchases table was
+// first created, so older databases keep working
+func MigratePurchases(db *sql.DB) error {
+	return addColumns(db, "Purchases", []column{
+		// quantity and unitPrice are read from the receipt line, NULL when
+		// the line was not cleaned
+		{"quantity", "quantity REAL"},
+		{"unitPrice", "unitPrice REAL"},
+	})
+}
+
 func AddPurchase(purchase models.Purchase, receiptId int64, ctx context.Context, tx *sql.Tx) (int64, error) {
-	id, err := tx.ExecContext(ctx, "INSERT INTO Purchases (name, price, receiptId) VALUES (?, ?, ?)", purchase.Product, purchase.Price, receiptId)
+	var quantity, unitPrice sql.NullFloat64
+	if purchase.Quantity > 0 {
+		quantity = sql.NullFloat64{Float64: purchase.Quantity, Valid: true}
+		unitPrice = sql.NullFloat64{Float64: purchase.UnitPrice, Valid: true}
+	}
+
+	id, err := tx.ExecContext(ctx, "INSERT INTO Purchases (name, price, receiptId, quantity, unitPrice) VALUES (?, ?, ?, ?, ?)",
+		purchase.Product, purchase.Price, receiptId, quantity, unitPrice)
 	if err != nil {
 		log.Fatal("Error inserting purchase into database: ", err)
 	}
@@ -39,7 +57,7 @@ func ChangePurchaseCategory(db *sql.DB, categoryId *int, purchaseId *int) (sql.R
 }
 
 func GetUnassignedPurchases(db *sql.DB) ([]models.Purchase, error) {
-	rows, err := db.Query("SELECT * FROM Purchases WHERE categoryId IS NULL")
+	rows, err := db.Query("SELECT id, name, price, receiptId, categoryId FROM Purchases WHERE categoryId IS NULL")
 	if err != nil {
 		return nil, fmt.Errorf("Error reading from Purchases table: %w", err)
 	}
@@ -57,3 +75,36 @@ func GetUnassignedPurchases(db *sql.DB) ([]models.Purchase, error) {
 
 	return purchases, nil
 }
+
+func GetCategorizedPurchases(db *sql.DB) ([]models.Purchase, error) {
+	rows, err := db.Query("SELECT id, name, price, receiptId, categoryId FROM Purchases WHERE categoryId IS NOT NULL")
+	if err != nil {
+		return nil, fmt.Errorf("Error reading from Purchases table: %w", err)
+	}
+	defer rows.Close()
+
+	var purchases []models.Purchase
+	for rows.Next() {
+		var p models.Purchase
+		err := rows.Scan(&p.Id, &p.Product, &p.Price, &p.ReceiptId, &p.CategoryId)
+		if err != nil {
+			return nil, fmt.Errorf("Error scanning purchase: %w", err)
+		}
+		purchases = append(purchases, p)
+	}
+
+	return purchases, nil
+}
+
+func GetPurchaseByID(db *sql.DB, id int) (models.Purchase, error) {
+	var p models.Purchase
+	err := db.QueryRow("SELECT id, name, price, receiptId, categoryId FROM Purchases WHERE id = ?", id).
+		Scan(&p.Id, &p.Product, &p.Price, &p.ReceiptId, &p.CategoryId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return p, fmt.Errorf("no purchase found with ID %d", id)
+		}
+		return p, fmt.Errorf("error querying purchase: %w", err)
+	}
+	return p, nil
+}
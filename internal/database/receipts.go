@@ -3,11 +3,180 @@ package database
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	"log"
+	"time"
+	"whatAmIBuying/internal/dates"
 	"whatAmIBuying/internal/models"
 )
 
+// ReceiptLocation is the timezone of receipt dates that do not name one
+var ReceiptLocation = time.Local
+
+// MigrateReceipts adds the columns introduced after the Receipts table was
+// first created, so older databases keep working, and parses the dates of
+// receipts added before dates were parsed
+func MigrateReceipts(db *sql.DB) error {
+	err := addColumns(db, "Receipts", []column{
+		{"store", "store TEXT NOT NULL DEFAULT ''"},
+		// dateUtc is the canonical date, in UTC, and timezone the one the
+		// receipt was printed in
+		{"dateUtc", "dateUtc TEXT"},
+		{"timezone", "timezone TEXT NOT NULL DEFAULT ''"},
+		// dateError explains why the date of a receipt could not be parsed
+		{"dateError", "dateError TEXT"},
+	})
+	if err != nil {
+		return err
+	}
+
+	return normalizeReceiptDates(db)
+}
+
+// column is a column added to a table after it was first created
+type column struct {
+	name       string
+	definition string
+}
+
+// addColumns adds the columns a table does not have yet
+func addColumns(db *sql.DB, table string, added []column) error {
+	columns, err := tableColumns(db, table)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range added {
+		if columns[c.name] {
+			continue
+		}
+		_, err = db.Exec("ALTER TABLE " + table + " ADD COLUMN " + c.definition)
+		if err != nil {
+			return fmt.Errorf("Error adding %s column to %s table: %w", c.name, table, err)
+		}
+	}
+	return nil
+}
+
+// normalizeReceiptDates fills in the canonical date of receipts that have
+// none yet and flags the receipts whose date cannot be parsed. The date is
+// kept as written
+func normalizeReceiptDates(db *sql.DB) error {
+	rows, err := db.Query("SELECT id, date FROM Receipts WHERE dateUtc IS NULL AND dateError IS NULL")
+	if err != nil {
+		return fmt.Errorf("Query failed: %w", err)
+	}
+
+	type pending struct {
+		id   int
+		date string
+	}
+	var receipts []pending
+	for rows.Next() {
+		var r pending
+		if err := rows.Scan(&r.id, &r.date); err != nil {
+			rows.Close()
+			return fmt.Errorf("Error scanning receipt date: %w", err)
+		}
+		receipts = append(receipts, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("Error reading receipt dates: %w", err)
+	}
+	if len(receipts) == 0 {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("Error starting a transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, r := range receipts {
+		date, err := dates.Parse(r.date, ReceiptLocation)
+		if err != nil {
+			_, err = tx.Exec("UPDATE Receipts SET dateError = ? WHERE id = ?", err.Error(), r.id)
+		} else {
+			_, err = tx.Exec("UPDATE Receipts SET dateUtc = ?, timezone = ? WHERE id = ?",
+				date.UTC().Format(dates.DatabaseLayout), dates.ZoneName(date), r.id)
+		}
+		if err != nil {
+			return fmt.Errorf("Error normalizing date of receipt %d: %w", r.id, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetReceiptDateErrors returns the receipts whose date could not be parsed
+func GetReceiptDateErrors(db *sql.DB) ([]models.ReceiptDateError, error) {
+	rows, err := db.Query("SELECT id, date, dateError FROM Receipts WHERE dateError IS NOT NULL ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("Query failed: %w", err)
+	}
+	defer rows.Close()
+
+	var receipts []models.ReceiptDateError
+	for rows.Next() {
+		var r models.ReceiptDateError
+		if err := rows.Scan(&r.ReceiptID, &r.Date, &r.Error); err != nil {
+			return nil, fmt.Errorf("Error scanning receipt: %w", err)
+		}
+		receipts = append(receipts, r)
+	}
+
+	return receipts, rows.Err()
+}
+
+// GetReceiptStore returns the store of a receipt, empty if the store or the
+// receipt is unknown
+func GetReceiptStore(db *sql.DB, receiptId int) (string, error) {
+	var store string
+	err := db.QueryRow("SELECT store FROM Receipts WHERE id = ?", receiptId).Scan(&store)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("Query failed: %w", err)
+	}
+
+	return store, nil
+}
+
+// tableColumns returns the set of column names of a table
+func tableColumns(db *sql.DB, table string) (map[string]bool, error) {
+	rows, err := db.Query("SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading columns of %s table: %w", table, err)
+	}
+	defer rows.Close()
+
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("Error scanning column name: %w", err)
+		}
+		columns[name] = true
+	}
+
+	return columns, rows.Err()
+}
+
+// AddReceipt stores a receipt with its purchases. The date is kept as
+// written, a date that cannot be parsed is flagged as the migration does
 func AddReceipt(receipt models.Receipt, db *sql.DB) (int64, error) {
+	var dateUtc, timezone, dateError any = nil, "", nil
+	date, err := dates.Parse(receipt.Date, ReceiptLocation)
+	if err != nil {
+		dateError = err.Error()
+	} else {
+		dateUtc = date.UTC().Format(dates.DatabaseLayout)
+		timezone = dates.ZoneName(date)
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
@@ -23,7 +192,8 @@ func AddReceipt(receipt models.Receipt, db *sql.DB) (int64, error) {
 	}
 	defer tx.Rollback()
 
-	id, err := tx.ExecContext(ctx, "INSERT INTO Receipts (date, amount) VALUES (?, ?)", receipt.Date, receipt.Amount)
+	id, err := tx.ExecContext(ctx, "INSERT INTO Receipts (date, dateUtc, timezone, dateError, amount, store) VALUES (?, ?, ?, ?, ?, ?)",
+		receipt.Date, dateUtc, timezone, dateError, receipt.Amount, receipt.Store)
 	if err != nil {
 		log.Fatal("Error inserting receipt into database: ", err)
 	}
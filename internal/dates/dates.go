@@ -0,0 +1,126 @@
+// Package dates parses the dates printed on receipts and written by the
+// importers, and converts them between local receipt time and UTC
+package dates
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DatabaseLayout is the format receipt dates are stored in
+const DatabaseLayout = "2006-01-02 15:04:05"
+
+// layouts are the receipt date formats understood by Parse. Fractional
+// seconds after the seconds are accepted by every layout with seconds
+var layouts = []string{
+	time.RFC3339,
+	DatabaseLayout,
+	"2006-01-02 15:04",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02",
+	// Day first, as printed on UK receipts
+	"02/01/06 15:04:05",
+	"02/01/06 15:04",
+	"02/01/06",
+	"02/01/2006 15:04:05",
+	"02/01/2006 15:04",
+	"02/01/2006",
+	"02.01.06 15:04:05",
+	"02.01.06 15:04",
+	"02.01.06",
+	"02.01.2006 15:04:05",
+	"02.01.2006 15:04",
+	"02.01.2006",
+}
+
+// Parse reads a receipt date in any of the supported formats. Dates without
+// a timezone are taken to be in loc
+func Parse(value string, loc *time.Location) (time.Time, error) {
+	normalized := strings.Join(strings.Fields(value), " ")
+	for _, layout := range layouts {
+		t, err := time.ParseInLocation(layout, normalized, loc)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognised receipt date %q", value)
+}
+
+// ZoneName names the timezone of t so that Location can restore it: the
+// IANA name when known, for local time too, otherwise its UTC offset such as
+// +01:00, which does not follow daylight saving time
+func ZoneName(t time.Time) string {
+	name := t.Location().String()
+	if name == "Local" {
+		name = localZoneName()
+	}
+	if name != "" {
+		return name
+	}
+	return t.Format("-07:00")
+}
+
+// localZoneName is the IANA name of the local timezone, empty if unknown
+var localZoneName = sync.OnceValue(systemZoneName)
+
+// systemZoneName finds the IANA name of the local timezone in TZ or the
+// target of /etc/localtime, the way the time package chooses it
+func systemZoneName() string {
+	name, set := os.LookupEnv("TZ")
+	name = strings.TrimPrefix(name, ":")
+	if set && name == "" {
+		return "UTC"
+	}
+	if !set {
+		target, err := os.Readlink("/etc/localtime")
+		if err != nil {
+			return ""
+		}
+		_, name, _ = strings.Cut(target, "zoneinfo/")
+	}
+	if name == "" || filepath.IsAbs(name) {
+		return ""
+	}
+	if _, err := time.LoadLocation(name); err != nil {
+		return ""
+	}
+	return name
+}
+
+var (
+	locationsMu sync.Mutex
+	// locations caches the timezones returned by Location by name
+	locations = make(map[string]*time.Location)
+)
+
+// Location returns the timezone named by ZoneName, local time if name is
+// empty. The same name always returns the same *time.Location
+func Location(name string) (*time.Location, error) {
+	if name == "" {
+		return time.Local, nil
+	}
+
+	locationsMu.Lock()
+	defer locationsMu.Unlock()
+	if loc, ok := locations[name]; ok {
+		return loc, nil
+	}
+
+	var loc *time.Location
+	if offset, err := time.Parse("-07:00", name); err == nil {
+		_, seconds := offset.Zone()
+		loc = time.FixedZone(name, seconds)
+	} else {
+		loc, err = time.LoadLocation(name)
+		if err != nil {
+			return nil, fmt.Errorf("unknown timezone %q: %w", name, err)
+		}
+	}
+	locations[name] = loc
+	return loc, nil
+}
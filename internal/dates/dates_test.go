@@ -0,0 +1,126 @@
+package dates
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	london, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Skip("No timezone database: ", err)
+	}
+
+	tests := []struct {
+		name     string
+		value    string
+		expected time.Time
+	}{
+		{"Database format", "2025-01-26 12:02:57", time.Date(2025, 1, 26, 12, 2, 57, 0, london)},
+		{"Microseconds", "2025-04-29 19:07:17.522446", time.Date(2025, 4, 29, 19, 7, 17, 522446000, london)},
+		{"No seconds", "2025-01-26 12:02", time.Date(2025, 1, 26, 12, 2, 0, 0, london)},
+		{"ISO with T", "2025-01-26T12:02:57", time.Date(2025, 1, 26, 12, 2, 57, 0, london)},
+		{"Date only", "2025-01-26", time.Date(2025, 1, 26, 0, 0, 0, 0, london)},
+		{"With timezone", "2025-07-01T09:00:00+02:00", time.Date(2025, 7, 1, 7, 0, 0, 0, time.UTC)},
+		{"Receipt with seconds", "26/01/25 12:02:57", time.Date(2025, 1, 26, 12, 2, 57, 0, london)},
+		{"Receipt without seconds", "26/01/25 12:02", time.Date(2025, 1, 26, 12, 2, 0, 0, london)},
+		{"Receipt with full year", "26/01/2025 12:02", time.Date(2025, 1, 26, 12, 2, 0, 0, london)},
+		{"Receipt date only", "26/01/25", time.Date(2025, 1, 26, 0, 0, 0, 0, london)},
+		{"Dotted", "26.01.25 12:02", time.Date(2025, 1, 26, 12, 2, 0, 0, london)},
+		{"Extra spaces", " 26/01/25   12:02:57 ", time.Date(2025, 1, 26, 12, 2, 57, 0, london)},
+		{"Summer time", "01/07/25 09:00", time.Date(2025, 7, 1, 8, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.value, london)
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", tt.value, err)
+			}
+			if !got.Equal(tt.expected) {
+				t.Errorf("Parse(%q) = %v, want %v", tt.value, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, value := range []string{"", "last Tuesday", "31/02/25", "2025-13-01", "12:02:57"} {
+		if _, err := Parse(value, time.UTC); err == nil {
+			t.Errorf("Expected an error for %q", value)
+		}
+	}
+}
+
+func TestZoneNameAndLocation(t *testing.T) {
+	tests := []struct {
+		name     string
+		t        time.Time
+		expected string
+	}{
+		{"UTC", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), "UTC"},
+		{"Offset", time.Date(2025, 1, 1, 0, 0, 0, 0, time.FixedZone("", -5*3600)), "-05:00"},
+	}
+	if london, err := time.LoadLocation("Europe/London"); err == nil {
+		tests = append(tests, struct {
+			name     string
+			t        time.Time
+			expected string
+		}{"IANA name", time.Date(2025, 7, 1, 0, 0, 0, 0, london), "Europe/London"})
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name := ZoneName(tt.t)
+			if name != tt.expected {
+				t.Fatalf("ZoneName() = %q, want %q", name, tt.expected)
+			}
+
+			loc, err := Location(name)
+			if err != nil {
+				t.Fatalf("Location(%q) error = %v", name, err)
+			}
+			// The restored timezone shows the same wall clock time
+			restored := tt.t.UTC().In(loc)
+			if restored.Format(DatabaseLayout) != tt.t.Format(DatabaseLayout) {
+				t.Errorf("Expected %s, got %s", tt.t.Format(DatabaseLayout), restored.Format(DatabaseLayout))
+			}
+		})
+	}
+
+	if _, err := Location("Mars/Olympus"); err == nil {
+		t.Error("Expected an error for an unknown timezone")
+	}
+
+	first, _ := Location("+01:00")
+	second, _ := Location("+01:00")
+	if first != second {
+		t.Error("Expected the same location for the same name")
+	}
+}
+
+func TestSystemZoneName(t *testing.T) {
+	if _, err := time.LoadLocation("Europe/London"); err != nil {
+		t.Skip("no timezone database")
+	}
+
+	tests := []struct {
+		tz       string
+		expected string
+	}{
+		{"Europe/London", "Europe/London"},
+		{":Europe/London", "Europe/London"},
+		{"", "UTC"},
+		{"/usr/share/zoneinfo/Europe/London", ""},
+		{"Mars/Olympus", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.tz, func(t *testing.T) {
+			t.Setenv("TZ", tt.tz)
+			if got := systemZoneName(); got != tt.expected {
+				t.Errorf("systemZoneName() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package imaging
+
+import (
+	"image"
+	"math"
+)
+
+const (
+	// maxSkew is the largest tilt in degrees that is corrected
+	maxSkew = 10.0
+	// skewStep is the resolution in degrees of the skew estimate
+	skewStep = 0.25
+	// maxSkewSamples bounds how many ink pixels are used to estimate the skew
+	maxSkewSamples = 100000
+)
+
+// EstimateSkew returns the angle in degrees by which the rows of text are
+// tilted, positive when they run down to the right. It picks the angle at
+// which projecting the ink onto the vertical axis gives the sharpest peaks
+func EstimateSkew(g *image.Gray) float64 {
+	threshold := OtsuThreshold(g)
+	bounds := g.Bounds()
+
+	total := 0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if g.GrayAt(x, y).Y <= threshold {
+				total++
+			}
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+
+	// Every stride-th ink pixel is kept, so the sample stays small on large photos
+	stride := total/maxSkewSamples + 1
+	ink := make([]image.Point, 0, total/stride+1)
+	seen := 0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if g.GrayAt(x, y).Y > threshold {
+				continue
+			}
+			if seen%stride == 0 {
+				ink = append(ink, image.Pt(x-bounds.Min.X, y-bounds.Min.Y))
+			}
+			seen++
+		}
+	}
+
+	size := bounds.Dx() + bounds.Dy()
+	bins := make([]int, 2*size+1)
+	best, bestScore := 0.0, -1.0
+	for angle := -maxSkew; angle <= maxSkew+skewStep/2; angle += skewStep {
+		sin, cos := math.Sincos(angle * math.Pi / 180)
+		clear(bins)
+		for _, p := range ink {
+			// Points on a row tilted by angle all land in the same bin
+			r := int(math.Round(float64(p.Y)*cos-float64(p.X)*sin)) + size
+			bins[r]++
+		}
+
+		var score float64
+		for _, count := range bins {
+			score += float64(count * count)
+		}
+		// Prefer the smaller correction when two angles score the same
+		if score > bestScore || (score == bestScore && math.Abs(angle) < math.Abs(best)) {
+			best, bestScore = angle, score
+		}
+	}
+
+	return best
+}
+
+// Rotate turns the content of an image by the given angle in degrees around
+// its centre, the opposite way to the tilt measured by EstimateSkew. Areas
+// that come from outside the image are filled white
+func Rotate(g *image.Gray, degrees float64) *image.Gray {
+	bounds := g.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	out := image.NewGray(image.Rect(0, 0, width, height))
+
+	sin, cos := math.Sincos(degrees * math.Pi / 180)
+	cx, cy := float64(width-1)/2, float64(height-1)/2
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			dx, dy := float64(x)-cx, float64(y)-cy
+			// A pixel on the straightened row comes from the tilted row
+			sx := cx + dx*cos - dy*sin
+			sy := cy + dx*sin + dy*cos
+			out.Pix[out.PixOffset(x, y)] = bilinear(g, sx, sy)
+		}
+	}
+
+	return out
+}
+
+// bilinear samples an image between pixels, white outside the image
+func bilinear(g *image.Gray, x float64, y float64) uint8 {
+	bounds := g.Bounds()
+	x0, y0 := int(math.Floor(x)), int(math.Floor(y))
+	if x0 < 0 || y0 < 0 || x0+1 >= bounds.Dx() || y0+1 >= bounds.Dy() {
+		if x0 >= 0 && y0 >= 0 && x0 < bounds.Dx() && y0 < bounds.Dy() {
+			return g.GrayAt(bounds.Min.X+x0, bounds.Min.Y+y0).Y
+		}
+		return 255
+	}
+
+	fx, fy := x-float64(x0), y-float64(y0)
+	at := func(px int, py int) float64 {
+		return float64(g.GrayAt(bounds.Min.X+px, bounds.Min.Y+py).Y)
+	}
+	top := at(x0, y0)*(1-fx) + at(x0+1, y0)*fx
+	bottom := at(x0, y0+1)*(1-fx) + at(x0+1, y0+1)*fx
+	return uint8(math.Round(top*(1-fy) + bottom*fy))
+}
+
+// Deskew straightens an image whose rows of text are tilted
+func Deskew(g *image.Gray) *image.Gray {
+	skew := EstimateSkew(g)
+	if skew == 0 {
+		return g
+	}
+	return Rotate(g, skew)
+}
@@ -0,0 +1,218 @@
+// Package imaging prepares receipt photos for OCR: it crops them to the
+// paper, straightens them, raises their contrast and splits them into rows
+// of text
+package imaging
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/jpeg"
+	"image/png"
+	"os"
+)
+
+// Load reads a PNG or JPEG image
+func Load(path string) (image.Image, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening image: %w", err)
+	}
+	defer file.Close()
+
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding image %s: %w", path, err)
+	}
+
+	return img, nil
+}
+
+// SavePNG writes an image as PNG
+func SavePNG(path string, img image.Image) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating image: %w", err)
+	}
+
+	err = png.Encode(file, img)
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("error encoding image %s: %w", path, err)
+	}
+
+	return file.Close()
+}
+
+// Greyscale converts an image to greyscale with its top left corner at 0,0
+func Greyscale(img image.Image) *image.Gray {
+	bounds := img.Bounds()
+	gray := image.NewGray(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(gray, gray.Bounds(), img, bounds.Min, draw.Src)
+	return gray
+}
+
+// histogram counts the pixels of every grey level
+func histogram(g *image.Gray) [256]int {
+	var hist [256]int
+	bounds := g.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		row := g.Pix[g.PixOffset(bounds.Min.X, y):g.PixOffset(bounds.Max.X, y)]
+		for _, v := range row {
+			hist[v]++
+		}
+	}
+	return hist
+}
+
+// OtsuThreshold returns the grey level that best separates dark ink from
+// light paper. Pixels at or below the threshold count as ink
+func OtsuThreshold(g *image.Gray) uint8 {
+	hist := histogram(g)
+
+	total := 0
+	var sum float64
+	for level, count := range hist {
+		total += count
+		sum += float64(level * count)
+	}
+	if total == 0 {
+		return 127
+	}
+
+	var sumBelow float64
+	below := 0
+	best, bestVariance := 0, -1.0
+	for level := 0; level < 256; level++ {
+		below += hist[level]
+		if below == 0 {
+			continue
+		}
+		above := total - below
+		if above == 0 {
+			break
+		}
+		sumBelow += float64(level * hist[level])
+
+		meanBelow := sumBelow / float64(below)
+		meanAbove := (sum - sumBelow) / float64(above)
+		variance := float64(below) * float64(above) * (meanBelow - meanAbove) * (meanBelow - meanAbove)
+		if variance > bestVariance {
+			best, bestVariance = level, variance
+		}
+	}
+
+	return uint8(best)
+}
+
+// Contrast stretches the grey levels so the darkest percent of pixels becomes
+// black and the lightest percent becomes white
+func Contrast(g *image.Gray) *image.Gray {
+	hist := histogram(g)
+	total := 0
+	for _, count := range hist {
+		total += count
+	}
+
+	low, high := percentileLevel(hist, total, 0.01), percentileLevel(hist, total, 0.99)
+	out := image.NewGray(g.Bounds())
+	if high <= low {
+		copy(out.Pix, g.Pix)
+		return out
+	}
+
+	var lookup [256]uint8
+	for level := range lookup {
+		v := (level - low) * 255 / (high - low)
+		lookup[level] = uint8(min(max(v, 0), 255))
+	}
+	for i, v := range g.Pix {
+		out.Pix[i] = lookup[v]
+	}
+	return out
+}
+
+// percentileLevel returns the grey level below which the given fraction of
+// pixels lies
+func percentileLevel(hist [256]int, total int, fraction float64) int {
+	target := int(fraction * float64(total))
+	seen := 0
+	for level, count := range hist {
+		seen += count
+		if seen > target {
+			return level
+		}
+	}
+	return 255
+}
+
+// CropToPaper crops a photo to the receipt, the largest light area of the
+// image. Rows and columns count as paper when at least a quarter of them is
+// light, so dense rows of text do not cut the paper short. The image is
+// returned unchanged if no paper stands out
+func CropToPaper(g *image.Gray) *image.Gray {
+	threshold := OtsuThreshold(g)
+	bounds := g.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	columnLight := make([]int, width)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if g.GrayAt(bounds.Min.X+x, bounds.Min.Y+y).Y > threshold {
+				columnLight[x]++
+			}
+		}
+	}
+	left, right := longestRun(columnLight, height/4)
+	if right-left <= 0 {
+		return g
+	}
+
+	rowLight := make([]int, height)
+	for y := 0; y < height; y++ {
+		for x := left; x < right; x++ {
+			if g.GrayAt(bounds.Min.X+x, bounds.Min.Y+y).Y > threshold {
+				rowLight[y]++
+			}
+		}
+	}
+	top, bottom := longestRun(rowLight, (right-left)/4)
+	if bottom-top <= 0 {
+		return g
+	}
+
+	return crop(g, image.Rect(left, top, right, bottom).Add(bounds.Min))
+}
+
+// longestRun returns the start and end of the longest run of values above
+// minimum
+func longestRun(values []int, minimum int) (int, int) {
+	bestStart, bestEnd := 0, 0
+	start := -1
+	for i := 0; i <= len(values); i++ {
+		if i < len(values) && values[i] > minimum {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 && i-start > bestEnd-bestStart {
+			bestStart, bestEnd = start, i
+		}
+		start = -1
+	}
+	return bestStart, bestEnd
+}
+
+// crop copies part of an image into a new image with its top left corner at 0,0
+func crop(g *image.Gray, rect image.Rectangle) *image.Gray {
+	out := image.NewGray(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+	draw.Draw(out, out.Bounds(), g, rect.Min, draw.Src)
+	return out
+}
+
+// Preprocess crops a receipt photo to the paper, straightens it and raises
+// its contrast
+func Preprocess(img image.Image) *image.Gray {
+	return Contrast(Deskew(CropToPaper(Greyscale(img))))
+}
@@ -0,0 +1,155 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"os"
+	"testing"
+)
+
+// fill paints a rectangle of an image with a grey level
+func fill(g *image.Gray, rect image.Rectangle, level uint8) {
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			g.SetGray(x, y, color.Gray{Y: level})
+		}
+	}
+}
+
+// syntheticReceipt returns a photo of light paper on a dark table, with three
+// rows of dashed "text" on the paper
+func syntheticReceipt() *image.Gray {
+	g := image.NewGray(image.Rect(0, 0, 200, 300))
+	fill(g, g.Bounds(), 60)
+	fill(g, image.Rect(40, 20, 160, 280), 235)
+	for _, row := range [][2]int{{60, 70}, {90, 98}, {120, 132}} {
+		for x := 50; x < 150; x += 6 {
+			fill(g, image.Rect(x, row[0], x+4, row[1]), 20)
+		}
+	}
+	return g
+}
+
+func TestOtsuThreshold(t *testing.T) {
+	g := image.NewGray(image.Rect(0, 0, 10, 10))
+	fill(g, g.Bounds(), 200)
+	fill(g, image.Rect(0, 0, 10, 3), 40)
+
+	threshold := OtsuThreshold(g)
+	if threshold < 40 || threshold >= 200 {
+		t.Errorf("Expected a threshold between 40 and 200, got %d", threshold)
+	}
+}
+
+func TestContrast(t *testing.T) {
+	g := image.NewGray(image.Rect(0, 0, 10, 10))
+	fill(g, g.Bounds(), 150)
+	fill(g, image.Rect(0, 0, 10, 5), 100)
+
+	out := Contrast(g)
+	if dark, light := out.GrayAt(0, 0).Y, out.GrayAt(0, 9).Y; dark != 0 || light != 255 {
+		t.Errorf("Expected levels stretched to 0 and 255, got %d and %d", dark, light)
+	}
+}
+
+func TestCropToPaper(t *testing.T) {
+	cropped := CropToPaper(syntheticReceipt())
+
+	if w, h := cropped.Bounds().Dx(), cropped.Bounds().Dy(); w != 120 || h != 260 {
+		t.Errorf("Expected the 120x260 paper, got %dx%d", w, h)
+	}
+	if level := cropped.GrayAt(0, 0).Y; level != 235 {
+		t.Errorf("Expected the crop to start on the paper, got level %d", level)
+	}
+}
+
+func TestRowBands(t *testing.T) {
+	paper := CropToPaper(syntheticReceipt())
+	opts := DefaultRowOptions
+
+	bands := RowBands(paper, opts)
+
+	// Rows are at 60, 90 and 120 in the photo, the paper starts at 20
+	expected := []Band{
+		{Top: 40 - opts.Padding, Bottom: 50 + opts.Padding},
+		{Top: 70 - opts.Padding, Bottom: 78 + opts.Padding},
+		{Top: 100 - opts.Padding, Bottom: 112 + opts.Padding},
+	}
+	if len(bands) != len(expected) {
+		t.Fatalf("Expected %d bands, got %v", len(expected), bands)
+	}
+	for i := range expected {
+		if bands[i] != expected[i] {
+			t.Errorf("Band %d = %+v, want %+v", i, bands[i], expected[i])
+		}
+	}
+
+	rows := CropRows(paper, bands)
+	if h := rows[2].Bounds().Dy(); h != 12+2*opts.Padding {
+		t.Errorf("Expected the third row to be %d pixels high, got %d", 12+2*opts.Padding, h)
+	}
+}
+
+func TestRowBandsMergesSmallGaps(t *testing.T) {
+	g := image.NewGray(image.Rect(0, 0, 100, 60))
+	fill(g, g.Bounds(), 255)
+	// A row with a one pixel gap, like the dot above an "i"
+	fill(g, image.Rect(10, 10, 90, 12), 0)
+	fill(g, image.Rect(10, 13, 90, 22), 0)
+
+	bands := RowBands(g, RowOptions{MinInk: 0.01, MaxGap: 2, MinHeight: 3})
+	if len(bands) != 1 || bands[0] != (Band{Top: 10, Bottom: 22}) {
+		t.Errorf("Expected one band from 10 to 22, got %v", bands)
+	}
+}
+
+func TestDeskew(t *testing.T) {
+	g := image.NewGray(image.Rect(0, 0, 400, 300))
+	fill(g, g.Bounds(), 255)
+
+	// Rows of text running down to the right by 3 degrees
+	slope := math.Tan(3 * math.Pi / 180)
+	for _, y0 := range []int{60, 120, 180, 240} {
+		for x := 40; x < 360; x++ {
+			y := y0 + int(math.Round(float64(x-200)*slope))
+			fill(g, image.Rect(x, y, x+1, y+4), 0)
+		}
+	}
+
+	skew := EstimateSkew(g)
+	if math.Abs(skew-3) > 0.5 {
+		t.Errorf("Expected a skew of about 3 degrees, got %.2f", skew)
+	}
+
+	straightened := Deskew(g)
+	if remaining := EstimateSkew(straightened); math.Abs(remaining) > 0.5 {
+		t.Errorf("Expected no skew after deskewing, got %.2f", remaining)
+	}
+}
+
+func TestWriteRowsAndLoad(t *testing.T) {
+	dir := "test_rows"
+	defer os.RemoveAll(dir)
+
+	paper := CropToPaper(syntheticReceipt())
+	paths, err := WriteRows(dir, CropRows(paper, RowBands(paper, DefaultRowOptions)))
+	if err != nil {
+		t.Fatalf("WriteRows() error = %v", err)
+	}
+	if len(paths) != 3 {
+		t.Fatalf("Expected 3 row images, got %d", len(paths))
+	}
+
+	img, err := Load(paths[0])
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if w := img.Bounds().Dx(); w != 120 {
+		t.Errorf("Expected rows as wide as the paper, got %d", w)
+	}
+
+	if _, err := Load("missing.png"); err == nil {
+		t.Error("Expected an error for a missing image")
+	}
+}
@@ -0,0 +1,111 @@
+package imaging
+
+import (
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+)
+
+// Band is a horizontal strip of an image holding a row of text, from Top up
+// to but not including Bottom
+type Band struct {
+	Top    int
+	Bottom int
+}
+
+// RowOptions tunes how rows of text are told apart
+type RowOptions struct {
+	// MinInk is the fraction of a pixel row that must be ink for it to count as text
+	MinInk float64
+	// MaxGap is the height of the largest gap inside a row, e.g. between the
+	// dots of "i" and the rest of the letters
+	MaxGap int
+	// MinHeight is the height of the smallest row, smaller bands are noise
+	MinHeight int
+	// Padding is added above and below every row
+	Padding int
+}
+
+// DefaultRowOptions suits phone photos of till receipts
+var DefaultRowOptions = RowOptions{
+	MinInk:    0.005,
+	MaxGap:    2,
+	MinHeight: 6,
+	Padding:   3,
+}
+
+// RowBands finds the rows of text in an image by counting the ink in every
+// pixel row and grouping the rows with enough ink
+func RowBands(g *image.Gray, opts RowOptions) []Band {
+	threshold := OtsuThreshold(g)
+	bounds := g.Bounds()
+	minInk := max(1, int(opts.MinInk*float64(bounds.Dx())))
+
+	var bands []Band
+	inBand := false
+	for y := bounds.Min.Y; y <= bounds.Max.Y; y++ {
+		ink := 0
+		if y < bounds.Max.Y {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				if g.GrayAt(x, y).Y <= threshold {
+					ink++
+				}
+			}
+		}
+
+		text := ink >= minInk
+		switch {
+		case text && !inBand:
+			// A gap small enough belongs to the previous row, which continues
+			if n := len(bands); n == 0 || y-bands[n-1].Bottom > opts.MaxGap {
+				bands = append(bands, Band{Top: y})
+			}
+			inBand = true
+		case !text && inBand:
+			bands[len(bands)-1].Bottom = y
+			inBand = false
+		}
+	}
+
+	var rows []Band
+	for _, b := range bands {
+		if b.Bottom-b.Top < opts.MinHeight {
+			continue
+		}
+		rows = append(rows, Band{
+			Top:    max(bounds.Min.Y, b.Top-opts.Padding),
+			Bottom: min(bounds.Max.Y, b.Bottom+opts.Padding),
+		})
+	}
+	return rows
+}
+
+// CropRows cuts the bands out of an image
+func CropRows(g *image.Gray, bands []Band) []*image.Gray {
+	bounds := g.Bounds()
+	rows := make([]*image.Gray, 0, len(bands))
+	for _, b := range bands {
+		rows = append(rows, crop(g, image.Rect(bounds.Min.X, b.Top, bounds.Max.X, b.Bottom)))
+	}
+	return rows
+}
+
+// WriteRows saves every row as row_000.png, row_001.png, ... in dir and
+// returns the paths written
+func WriteRows(dir string, rows []*image.Gray) ([]string, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("error creating %s: %w", dir, err)
+	}
+
+	paths := make([]string, 0, len(rows))
+	for i, row := range rows {
+		path := filepath.Join(dir, fmt.Sprintf("row_%03d.png", i))
+		if err := SavePNG(path, row); err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
@@ -10,12 +10,17 @@ type Purchase struct {
 	Product    string
 	Price      string
 	PriceFloat float64
+	// Quantity and UnitPrice are read from the receipt line, 0 when the line
+	// was not cleaned
+	Quantity   float64
+	UnitPrice  float64
 	ReceiptId  int
 	CategoryId sql.NullInt64
 }
 
 type Receipt struct {
 	Date      string     `json:"date"`
+	Store     string     `json:"store"`
 	Purchases []Purchase `json:"-"`
 	Amount    string     `json:"amount"`
 }
@@ -40,3 +45,88 @@ type PurchaseRecord struct {
 	Purchase    Purchase
 	ReceiptDate time.Time
 }
+
+// ShoppingItem is a product predicted to be needed again
+type ShoppingItem struct {
+	Product    string
+	LastBought time.Time
+	// Interval is the typical time between purchases of the product
+	Interval time.Duration
+	Due      time.Time
+	// Confidence is how regular the purchases are, from 0 to 1
+	Confidence float64
+	Purchases  int
+}
+
+type LLMCacheStats struct {
+	Model         string
+	PromptVersion string
+	Entries       int
+	// Hits counts the responses answered from the cache, LastUsed is when
+	// the latest was, in UTC, empty if none was
+	Hits     int
+	LastUsed string
+}
+
+type CategorizationAudit struct {
+	ID             int
+	PurchaseID     int
+	CategoryID     int
+	Model          string
+	PromptVersion  string
+	Prompt         string
+	RawResponse    string
+	Reasoning      string
+	PromptTokens   int
+	ResponseTokens int
+	Duration       time.Duration
+	Cached         bool
+	CreatedAt      string
+}
+
+type LineItem struct {
+	Name      string  `json:"name"`
+	Quantity  float64 `json:"quantity"`
+	UnitPrice float64 `json:"unit_price"`
+}
+
+// AssociationRule says that baskets holding all of Antecedent tend to hold
+// Consequent as well
+type AssociationRule struct {
+	Antecedent []string
+	Consequent string
+	// Count is the number of baskets holding the antecedent and consequent
+	Count int
+	// Support is the fraction of baskets holding the antecedent and consequent
+	Support float64
+	// Confidence is the fraction of baskets holding the antecedent that hold
+	// the consequent too
+	Confidence float64
+	// Lift is how much more often the consequent is bought with the
+	// antecedent than on its own, above 1 for items that go together
+	Lift float64
+}
+
+// SpendingForecast is the spending expected in a period, with a prediction
+// interval around it
+type SpendingForecast struct {
+	Start    time.Time
+	Forecast float64
+	Low      float64
+	High     float64
+}
+
+// ReceiptDateError is a receipt whose date could not be understood
+type ReceiptDateError struct {
+	ReceiptID int
+	Date      string
+	Error     string
+}
+
+// SpendingGroup is the spending on one category, store, period or product
+type SpendingGroup struct {
+	Key       string
+	Total     float64
+	Purchases int
+	Receipts  int
+}
@@ -0,0 +1,363 @@
+// Package render writes the results of listings and reports as aligned text
+// tables, CSV, JSON or Markdown
+package render
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Formats are the names of the output formats, the first being the default
+var Formats = []string{"table", "csv", "json", "markdown"}
+
+// Format is an output format, usable as a command line flag
+type Format string
+
+// String returns the name of the format
+func (f *Format) String() string {
+	return string(*f)
+}
+
+// Set checks and sets the format from a flag value
+func (f *Format) Set(value string) error {
+	for _, name := range Formats {
+		if value == name {
+			*f = Format(value)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown format %q, expected %s", value, strings.Join(Formats, ", "))
+}
+
+// Percent is a fraction shown as a percentage in text and as the fraction
+// in JSON
+type Percent float64
+
+// Number is a value shown with a fixed number of decimals in text
+type Number struct {
+	Value    float64
+	Decimals int
+}
+
+// Fixed returns a number shown with the given number of decimals
+func Fixed(value float64, decimals int) Number {
+	return Number{Value: value, Decimals: decimals}
+}
+
+// Table is a named grid of values. Strings, integers, floats, which show two
+// decimals, Percent, Number, bool, time.Time and time.Duration are understood
+type Table struct {
+	// Name is the key of the table in JSON holding several tables
+	Name string
+	// Title is shown above the table in text and Markdown
+	Title string
+	// Empty is shown in text and Markdown instead of a table without rows
+	Empty string
+	// Columns are the headings of the columns
+	Columns []string
+	// Rows hold a value for every column
+	Rows [][]any
+}
+
+// NewTable returns a table without rows
+func NewTable(name string, columns ...string) *Table {
+	return &Table{Name: name, Columns: columns}
+}
+
+// AddRow appends a row holding a value for every column
+func (t *Table) AddRow(values ...any) {
+	t.Rows = append(t.Rows, values)
+}
+
+// Write writes the tables in the given format, the default table format if
+// empty. A single table is written to JSON as a list of objects, several as
+// an object holding every list under the table's name. Several tables are
+// written to CSV with a Table column naming the table of every row
+func Write(w io.Writer, format Format, tables ...*Table) error {
+	switch format {
+	case "", "table":
+		return writeText(w, tables)
+	case "csv":
+		return writeCSV(w, tables)
+	case "json":
+		return writeJSON(w, tables)
+	case "markdown":
+		return writeMarkdown(w, tables)
+	default:
+		return fmt.Errorf("unknown format %q, expected %s", format, strings.Join(Formats, ", "))
+	}
+}
+
+// text returns how a value is shown in text, CSV and Markdown
+func text(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return fmt.Sprintf("%.2f", v)
+	case Percent:
+		return fmt.Sprintf("%.1f%%", float64(v)*100)
+	case Number:
+		return fmt.Sprintf("%.*f", v.Decimals, v.Value)
+	case bool:
+		if v {
+			return "yes"
+		}
+		return ""
+	case time.Time:
+		if v.Hour() == 0 && v.Minute() == 0 && v.Second() == 0 {
+			return v.Format("2006-01-02")
+		}
+		return v.Format("2006-01-02 15:04")
+	case time.Duration:
+		return v.String()
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// jsonValue returns the value written to JSON, keeping numbers as numbers,
+// floats rounded to the cent and durations in seconds
+func jsonValue(value any) any {
+	switch v := value.(type) {
+	case float64:
+		return math.Round(v*100) / 100
+	case Percent:
+		return float64(v)
+	case Number:
+		return v.Value
+	case time.Time:
+		return v.Format(time.RFC3339)
+	case time.Duration:
+		return v.Seconds()
+	default:
+		return v
+	}
+}
+
+// numeric reports whether a value is a number, which is aligned right
+func numeric(value any) bool {
+	switch value.(type) {
+	case int, int64, float64, Percent, Number, time.Duration:
+		return true
+	}
+	return false
+}
+
+// rightAligned reports for every column whether all its values are numbers
+func rightAligned(t *Table) []bool {
+	right := make([]bool, len(t.Columns))
+	for i := range t.Columns {
+		right[i] = len(t.Rows) > 0
+		for _, row := range t.Rows {
+			if i < len(row) && row[i] != nil && !numeric(row[i]) {
+				right[i] = false
+			}
+		}
+	}
+	return right
+}
+
+// cells returns the text of every value of a row, one per column
+func cells(t *Table, row []any) []string {
+	texts := make([]string, len(t.Columns))
+	for i := range texts {
+		if i < len(row) {
+			texts[i] = text(row[i])
+		}
+	}
+	return texts
+}
+
+// jsonKey turns a column heading such as "Last bought" into last_bought
+func jsonKey(column string) string {
+	var b strings.Builder
+	underscore := false
+	for _, r := range strings.TrimSpace(column) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if underscore && b.Len() > 0 {
+				b.WriteByte('_')
+			}
+			b.WriteRune(unicode.ToLower(r))
+			underscore = false
+		} else {
+			underscore = true
+		}
+	}
+	return b.String()
+}
+
+// writeText writes the tables with their columns padded to line up
+func writeText(w io.Writer, tables []*Table) error {
+	for n, t := range tables {
+		if n > 0 {
+			fmt.Fprintln(w)
+		}
+		if t.Title != "" {
+			fmt.Fprintln(w, t.Title)
+		}
+		if len(t.Rows) == 0 && t.Empty != "" {
+			fmt.Fprintf(w, "  %s\n", t.Empty)
+			continue
+		}
+
+		widths := make([]int, len(t.Columns))
+		for i, c := range t.Columns {
+			widths[i] = utf8.RuneCountInString(c)
+		}
+		rows := make([][]string, len(t.Rows))
+		for r, row := range t.Rows {
+			rows[r] = cells(t, row)
+			for i, cell := range rows[r] {
+				widths[i] = max(widths[i], utf8.RuneCountInString(cell))
+			}
+		}
+
+		right := rightAligned(t)
+		for _, line := range append([][]string{t.Columns}, rows...) {
+			var b strings.Builder
+			b.WriteString(" ")
+			for i, cell := range line {
+				pad := strings.Repeat(" ", widths[i]-utf8.RuneCountInString(cell))
+				b.WriteString(" ")
+				if right[i] {
+					b.WriteString(pad + cell)
+				} else {
+					b.WriteString(cell + pad)
+				}
+				if i < len(line)-1 {
+					b.WriteString(" ")
+				}
+			}
+			_, err := fmt.Fprintln(w, strings.TrimRight(b.String(), " "))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeCSV writes the tables as one CSV document with a heading row
+func writeCSV(w io.Writer, tables []*Table) error {
+	cw := csv.NewWriter(w)
+	if len(tables) == 1 {
+		cw.Write(tables[0].Columns)
+		for _, row := range tables[0].Rows {
+			cw.Write(cells(tables[0], row))
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+
+	// Several tables share one header holding every column, each row filling
+	// in those of its table after the name of the table
+	header := []string{"Table"}
+	position := make(map[string]int)
+	for _, t := range tables {
+		for _, c := range t.Columns {
+			if _, ok := position[c]; !ok {
+				position[c] = len(header)
+				header = append(header, c)
+			}
+		}
+	}
+	cw.Write(header)
+	for _, t := range tables {
+		for _, row := range t.Rows {
+			record := make([]string, len(header))
+			record[0] = t.Name
+			for i, value := range cells(t, row) {
+				record[position[t.Columns[i]]] = value
+			}
+			cw.Write(record)
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeJSON writes the rows of the tables as objects keyed by column
+func writeJSON(w io.Writer, tables []*Table) error {
+	lists := make(map[string][]map[string]any)
+	for _, t := range tables {
+		keys := make([]string, len(t.Columns))
+		for i, c := range t.Columns {
+			keys[i] = jsonKey(c)
+		}
+		list := make([]map[string]any, 0, len(t.Rows))
+		for _, row := range t.Rows {
+			object := make(map[string]any)
+			for i, key := range keys {
+				if i < len(row) {
+					object[key] = jsonValue(row[i])
+				}
+			}
+			list = append(list, object)
+		}
+		lists[t.Name] = list
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if len(tables) == 1 {
+		return encoder.Encode(lists[tables[0].Name])
+	}
+	return encoder.Encode(lists)
+}
+
+// markdownEscaper keeps cell text from breaking a Markdown table
+var markdownEscaper = strings.NewReplacer("|", `\|`, "\n", " ")
+
+// writeMarkdown writes every table as a Markdown table under its title
+func writeMarkdown(w io.Writer, tables []*Table) error {
+	for n, t := range tables {
+		if n > 0 {
+			fmt.Fprintln(w)
+		}
+		if t.Title != "" {
+			fmt.Fprintf(w, "### %s\n\n", t.Title)
+		}
+		if len(t.Rows) == 0 && t.Empty != "" {
+			fmt.Fprintln(w, t.Empty)
+			continue
+		}
+
+		right := rightAligned(t)
+		separators := make([]string, len(t.Columns))
+		for i := range separators {
+			separators[i] = "---"
+			if right[i] {
+				separators[i] = "---:"
+			}
+		}
+
+		fmt.Fprintf(w, "| %s |\n", strings.Join(escapeAll(t.Columns), " | "))
+		fmt.Fprintf(w, "| %s |\n", strings.Join(separators, " | "))
+		for _, row := range t.Rows {
+			_, err := fmt.Fprintf(w, "| %s |\n", strings.Join(escapeAll(cells(t, row)), " | "))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// escapeAll escapes the text of every Markdown cell
+func escapeAll(texts []string) []string {
+	escaped := make([]string, len(texts))
+	for i, s := range texts {
+		escaped[i] = markdownEscaper.Replace(s)
+	}
+	return escaped
+}
@@ -0,0 +1,129 @@
+package render
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func testTable() *Table {
+	t := NewTable("items", "Product", "Price", "Confidence", "Last bought")
+	t.Title = "Shopping list"
+	t.AddRow("Whole Milk", 1.5, Percent(0.625), time.Date(2025, 1, 6, 0, 0, 0, 0, time.UTC))
+	t.AddRow("Bread | Rolls", 12.25, Percent(0.1), time.Date(2025, 1, 7, 18, 30, 0, 0, time.UTC))
+	return t
+}
+
+func TestWrite(t *testing.T) {
+	tests := []struct {
+		format   Format
+		expected string
+	}{
+		{"table", `Shopping list
+  Product        Price  Confidence  Last bought
+  Whole Milk      1.50       62.5%  2025-01-06
+  Bread | Rolls  12.25       10.0%  2025-01-07 18:30
+`},
+		{"csv", `Product,Price,Confidence,Last bought
+Whole Milk,1.50,62.5%,2025-01-06
+Bread | Rolls,12.25,10.0%,2025-01-07 18:30
+`},
+		{"json", `[
+  {
+    "confidence": 0.625,
+    "last_bought": "2025-01-06T00:00:00Z",
+    "price": 1.5,
+    "product": "Whole Milk"
+  },
+  {
+    "confidence": 0.1,
+    "last_bought": "2025-01-07T18:30:00Z",
+    "price": 12.25,
+    "product": "Bread | Rolls"
+  }
+]
+`},
+		{"markdown", `### Shopping list
+
+| Product | Price | Confidence | Last bought |
+| --- | ---: | ---: | --- |
+| Whole Milk | 1.50 | 62.5% | 2025-01-06 |
+| Bread \| Rolls | 12.25 | 10.0% | 2025-01-07 18:30 |
+`},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.format), func(t *testing.T) {
+			var out bytes.Buffer
+			if err := Write(&out, tt.format, testTable()); err != nil {
+				t.Fatalf("Write() error = %v", err)
+			}
+			if out.String() != tt.expected {
+				t.Errorf("Write() =\n%s\nwant\n%s", out.String(), tt.expected)
+			}
+		})
+	}
+}
+
+func TestWriteSeveralTables(t *testing.T) {
+	empty := NewTable("also_buy", "Product")
+	empty.Empty = "Nothing else"
+
+	var out bytes.Buffer
+	if err := Write(&out, "json", testTable(), empty); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if !bytes.Contains(out.Bytes(), []byte(`"also_buy": []`)) || !bytes.Contains(out.Bytes(), []byte(`"items": [`)) {
+		t.Errorf("Expected both tables by name, got\n%s", out.String())
+	}
+
+	out.Reset()
+	totals := NewTable("totals", "Product", "Count")
+	totals.AddRow("All", 2)
+	if err := Write(&out, "csv", testTable(), totals); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	expected := `Table,Product,Price,Confidence,Last bought,Count
+items,Whole Milk,1.50,62.5%,2025-01-06,
+items,Bread | Rolls,12.25,10.0%,2025-01-07 18:30,
+totals,All,,,,2
+`
+	if out.String() != expected {
+		t.Errorf("Expected one CSV document, got\n%s", out.String())
+	}
+
+	out.Reset()
+	if err := Write(&out, "table", empty); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if out.String() != "  Nothing else\n" {
+		t.Errorf("Expected the empty message, got %q", out.String())
+	}
+}
+
+func TestFormatSet(t *testing.T) {
+	var f Format
+	if err := f.Set("markdown"); err != nil || f != "markdown" {
+		t.Errorf("Set(markdown) = %v, format %q", err, f)
+	}
+	if err := f.Set("xml"); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+	if err := Write(&bytes.Buffer{}, "xml", testTable()); err == nil {
+		t.Error("Expected Write to refuse an unknown format")
+	}
+}
+
+func TestJSONKey(t *testing.T) {
+	tests := map[string]string{
+		"Product":       "product",
+		"Last bought":   "last_bought",
+		"Precision@3":   "precision_3",
+		"Parse failure": "parse_failure",
+	}
+	for column, expected := range tests {
+		if got := jsonKey(column); got != expected {
+			t.Errorf("jsonKey(%q) = %q, want %q", column, got, expected)
+		}
+	}
+}
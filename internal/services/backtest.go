@@ -0,0 +1,229 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"whatAmIBuying/internal/database"
+	"whatAmIBuying/internal/models"
+	"whatAmIBuying/internal/render"
+)
+
+// backtestMinProbability stands in for categories a predictor gave no chance
+// at all, which would otherwise make the log-loss infinite
+const backtestMinProbability = 1e-6
+
+// shoppingPredictorName names the shopping list in product backtests
+const shoppingPredictorName = "shopping"
+
+// BacktestOptions configures how predictions are replayed over the history
+type BacktestOptions struct {
+	// Level is what is predicted, "category" if empty or "product". Products
+	// are predicted by the shopping list, Predictors only predict categories
+	Level string
+	// K is how many of the best categories or products count as predicted
+	K int
+	// MinHistory is how many receipts are learned from before the first
+	// prediction is scored
+	MinHistory int
+	// Predictors are the names of the predictors compared, "time" if empty
+	Predictors []string
+	// Scoring weighs the purchase history, DefaultScoringOptions if zero
+	Scoring ScoringOptions
+	// Format is how the results are written, a table if empty
+	Format render.Format
+}
+
+// BacktestResult is how well a predictor foresaw the receipts in the history
+type BacktestResult struct {
+	Predictor string
+	// Receipts is the number of receipts predicted
+	Receipts int
+	K        int
+	// Precision is the mean fraction of the top K predictions that were bought
+	Precision float64
+	// Recall is the mean fraction of what was bought that was in the top K
+	Recall float64
+	// LogLoss is the mean negative log probability given to the category of
+	// every item bought, lower is better. Products are predicted without
+	// probabilities, so it is 0 for them
+	LogLoss float64
+}
+
+// groupByReceipt splits purchases into receipts, keeping their order
+func groupByReceipt(purchases []models.PurchaseRecord) [][]models.PurchaseRecord {
+	index := make(map[int]int)
+	var receipts [][]models.PurchaseRecord
+	for _, p := range purchases {
+		i, ok := index[p.Purchase.ReceiptId]
+		if !ok {
+			i = len(receipts)
+			index[p.Purchase.ReceiptId] = i
+			receipts = append(receipts, nil)
+		}
+		receipts[i] = append(receipts[i], p)
+	}
+	return receipts
+}
+
+// backtest replays the receipts in order, predicting every receipt from the
+// ones before it and comparing the prediction with what was bought. Receipts
+// the predictor has nothing to predict for are not scored
+func backtest(purchases []models.PurchaseRecord, predictor Predictor, k int, minHistory int) BacktestResult {
+	result := BacktestResult{Predictor: predictor.Name(), K: k}
+	receipts := groupByReceipt(purchases)
+
+	var history []models.PurchaseRecord
+	items := 0
+	for i, receipt := range receipts {
+		var scores []models.CategoryScore
+		if i >= minHistory {
+			scores = predictor.Predict(history, receipt[0].ReceiptDate)
+		}
+		if predicted := min(k, len(scores)); predicted > 0 {
+			bought := make(map[int]bool)
+			for _, p := range receipt {
+				bought[int(p.Purchase.CategoryId.Int64)] = true
+			}
+			hits := 0
+			for _, cs := range scores[:predicted] {
+				if bought[cs.CategoryID] {
+					hits++
+				}
+			}
+			result.Precision += float64(hits) / float64(predicted)
+			result.Recall += float64(hits) / float64(len(bought))
+
+			probability := make(map[int]float64)
+			for _, cs := range scores {
+				probability[cs.CategoryID] = cs.Score
+			}
+			for _, p := range receipt {
+				result.LogLoss -= math.Log(max(probability[int(p.Purchase.CategoryId.Int64)], backtestMinProbability))
+				items++
+			}
+			result.Receipts++
+		}
+		history = append(history, receipt...)
+	}
+
+	if result.Receipts > 0 {
+		result.Precision /= float64(result.Receipts)
+		result.Recall /= float64(result.Receipts)
+	}
+	if items > 0 {
+		result.LogLoss /= float64(items)
+	}
+	return result
+}
+
+// backtestProducts replays the receipts in order like backtest, taking the K
+// products soonest due on the shopping list of the receipts before every
+// receipt as its prediction
+func backtestProducts(purchases []models.PurchaseRecord, k int, minHistory int) BacktestResult {
+	result := BacktestResult{Predictor: shoppingPredictorName, K: k}
+	receipts := groupByReceipt(purchases)
+
+	var history []models.PurchaseRecord
+	for i, receipt := range receipts {
+		var due []models.ShoppingItem
+		if i >= minHistory {
+			due = dueProducts(history, receipt[0].ReceiptDate)
+		}
+
+		bought := make(map[string]bool)
+		for _, p := range receipt {
+			if name := NormalizeProductName(p.Purchase.Product); name != "" {
+				bought[name] = true
+			}
+		}
+		if predicted := min(k, len(due)); predicted > 0 && len(bought) > 0 {
+			hits := 0
+			for _, item := range due[:predicted] {
+				if bought[NormalizeProductName(item.Product)] {
+					hits++
+				}
+			}
+			result.Precision += float64(hits) / float64(predicted)
+			result.Recall += float64(hits) / float64(len(bought))
+			result.Receipts++
+		}
+		history = append(history, receipt...)
+	}
+
+	if result.Receipts > 0 {
+		result.Precision /= float64(result.Receipts)
+		result.Recall /= float64(result.Receipts)
+	}
+	return result
+}
+
+// BacktestPredictions replays the receipts chronologically, predicting the
+// categories or products of every receipt from the ones before it, and
+// prints how good every predictor's predictions were
+func BacktestPredictions(opts BacktestOptions) error {
+	db, err := database.OpenDatabase()
+	if err != nil {
+		log.Fatal("Error opening database: ", err)
+	}
+
+	if opts.Level == "" {
+		opts.Level = "category"
+	}
+	if opts.Level != "category" && opts.Level != "product" {
+		return fmt.Errorf("unknown backtest level %q, expected category or product", opts.Level)
+	}
+	if opts.Scoring == (ScoringOptions{}) {
+		opts.Scoring = DefaultScoringOptions
+	}
+	if len(opts.Predictors) == 0 {
+		opts.Predictors = []string{"time"}
+	}
+	if opts.K < 1 {
+		return fmt.Errorf("k must be at least 1, got %d", opts.K)
+	}
+
+	var predictors []Predictor
+	for _, name := range opts.Predictors {
+		predictor, err := NewPredictor(name, opts.Scoring)
+		if err != nil {
+			return err
+		}
+		predictors = append(predictors, predictor)
+	}
+
+	// Products are predicted from every purchase, categories only from the
+	// categorized ones
+	purchases, err := loadPurchaseRecords(db, opts.Level == "category")
+	if err != nil {
+		return err
+	}
+
+	var results []BacktestResult
+	if opts.Level == "product" {
+		results = append(results, backtestProducts(purchases, opts.K, opts.MinHistory))
+	} else {
+		for _, predictor := range predictors {
+			results = append(results, backtest(purchases, predictor, opts.K, opts.MinHistory))
+		}
+	}
+
+	table := render.NewTable("predictors", "Predictor", "Receipts", "K", "Precision", "Recall", "Log-loss")
+	table.Title = fmt.Sprintf("Predictions of the best %d categories of every receipt", opts.K)
+	if opts.Level == "product" {
+		table.Title = fmt.Sprintf("Predictions of the %d products soonest due on the shopping list of every receipt", opts.K)
+	}
+	for _, result := range results {
+		if result.Receipts == 0 {
+			return fmt.Errorf("not enough receipts to backtest, %d are learned from first", opts.MinHistory)
+		}
+		var logLoss any
+		if opts.Level == "category" {
+			logLoss = render.Fixed(result.LogLoss, 3)
+		}
+		table.AddRow(result.Predictor, result.Receipts, result.K, render.Fixed(result.Precision, 3), render.Fixed(result.Recall, 3), logLoss)
+	}
+
+	return render.Write(os.Stdout, opts.Format, table)
+}
@@ -0,0 +1,154 @@
+package services
+
+import (
+	"database/sql"
+	"math"
+	"testing"
+	"time"
+	"whatAmIBuying/internal/models"
+)
+
+// backtestRecord is a categorized purchase on a receipt bought on the given day
+func backtestRecord(receiptId int, day int, categoryId int64) models.PurchaseRecord {
+	return models.PurchaseRecord{
+		Purchase: models.Purchase{
+			ReceiptId:  receiptId,
+			CategoryId: sql.NullInt64{Int64: categoryId, Valid: true},
+		},
+		ReceiptDate: time.Date(2025, 1, day, 10, 0, 0, 0, time.UTC),
+	}
+}
+
+// fixedPredictor always predicts the same scores and records the size of
+// every history it is given
+type fixedPredictor struct {
+	scores []models.CategoryScore
+	seen   []int
+}
+
+func (p *fixedPredictor) Name() string {
+	return "fixed"
+}
+
+func (p *fixedPredictor) Predict(history []models.PurchaseRecord, at time.Time) []models.CategoryScore {
+	p.seen = append(p.seen, len(history))
+	return p.scores
+}
+
+func TestBacktest(t *testing.T) {
+	purchases := []models.PurchaseRecord{
+		backtestRecord(1, 1, 1),
+		backtestRecord(2, 2, 1),
+		backtestRecord(2, 2, 2),
+		backtestRecord(3, 3, 1),
+		backtestRecord(3, 3, 3),
+	}
+
+	tests := []struct {
+		name       string
+		k          int
+		minHistory int
+		expected   BacktestResult
+		history    []int
+	}{
+		{
+			"Top one after one receipt", 1, 1,
+			BacktestResult{Receipts: 2, K: 1, Precision: 1, Recall: 0.5, LogLoss: -(2*math.Log(0.5) + math.Log(0.3) + math.Log(0.2)) / 4},
+			[]int{1, 3},
+		},
+		{
+			"Top two after two receipts", 2, 2,
+			BacktestResult{Receipts: 1, K: 2, Precision: 0.5, Recall: 0.5, LogLoss: -(math.Log(0.5) + math.Log(0.2)) / 2},
+			[]int{3},
+		},
+		{"Not enough receipts", 1, 3, BacktestResult{K: 1}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Dairy at 0.5, Meat at 0.3 and Vegetables at 0.2
+			fixed := &fixedPredictor{scores: []models.CategoryScore{{CategoryID: 1, Score: 0.5}, {CategoryID: 2, Score: 0.3}, {CategoryID: 3, Score: 0.2}}}
+			got := backtest(purchases, fixed, tt.k, tt.minHistory)
+			seen := fixed.seen
+
+			if got.Predictor != "fixed" || got.Receipts != tt.expected.Receipts || got.K != tt.expected.K {
+				t.Errorf("backtest() = %+v, want %+v", got, tt.expected)
+			}
+			for _, metric := range []struct {
+				name      string
+				got, want float64
+			}{
+				{"precision", got.Precision, tt.expected.Precision},
+				{"recall", got.Recall, tt.expected.Recall},
+				{"log-loss", got.LogLoss, tt.expected.LogLoss},
+			} {
+				if math.Abs(metric.got-metric.want) > 1e-9 {
+					t.Errorf("Expected %s %f, got %f", metric.name, metric.want, metric.got)
+				}
+			}
+			// Every prediction knows only the receipts before it
+			if len(seen) != len(tt.history) {
+				t.Fatalf("Expected histories of %v purchases, got %v", tt.history, seen)
+			}
+			for i := range seen {
+				if seen[i] != tt.history[i] {
+					t.Errorf("Prediction %d saw %d purchases, want %d", i, seen[i], tt.history[i])
+				}
+			}
+		})
+	}
+}
+
+func TestBacktestUnknownCategory(t *testing.T) {
+	purchases := []models.PurchaseRecord{backtestRecord(1, 1, 1), backtestRecord(2, 2, 2)}
+
+	result := backtest(purchases, &TimePredictor{Scoring: DefaultScoringOptions}, 1, 1)
+
+	// Meat was never bought before, so it gets the minimum probability
+	if math.Abs(result.LogLoss+math.Log(backtestMinProbability)) > 1e-9 || result.Precision != 0 {
+		t.Errorf("Unexpected result for an unforeseen category %+v", result)
+	}
+}
+
+func TestBacktestFewerScoresThanK(t *testing.T) {
+	purchases := []models.PurchaseRecord{backtestRecord(1, 1, 1), backtestRecord(2, 2, 1), backtestRecord(3, 3, 1)}
+
+	// Only Dairy is predicted, which is right every time
+	result := backtest(purchases, &fixedPredictor{scores: []models.CategoryScore{{CategoryID: 1, Score: 1}}}, 3, 1)
+	if result.Receipts != 2 || result.Precision != 1 || result.Recall != 1 {
+		t.Errorf("Expected precision over the one category predicted, got %+v", result)
+	}
+
+	// Receipts without any prediction are not scored
+	result = backtest(purchases, &fixedPredictor{}, 3, 1)
+	if result.Receipts != 0 || result.Precision != 0 {
+		t.Errorf("Expected no receipt scored without predictions, got %+v", result)
+	}
+}
+
+// backtestProductRecord is a purchase of a product on a receipt bought on the
+// given day
+func backtestProductRecord(receiptId int, day int, product string) models.PurchaseRecord {
+	return models.PurchaseRecord{
+		Purchase:    models.Purchase{ReceiptId: receiptId, Product: product},
+		ReceiptDate: time.Date(2025, 1, day, 10, 0, 0, 0, time.UTC),
+	}
+}
+
+func TestBacktestProducts(t *testing.T) {
+	purchases := []models.PurchaseRecord{
+		backtestProductRecord(1, 1, "Whole Milk"),
+		backtestProductRecord(2, 3, "Whole Milk"),
+		backtestProductRecord(3, 5, "Whole Milk"),
+		backtestProductRecord(4, 7, "Whole Milk"),
+		backtestProductRecord(4, 7, "Sourdough Loaf"),
+	}
+
+	result := backtestProducts(purchases, 2, 1)
+
+	// Milk is due on the 7th once bought three times, the receipts before
+	// have no product due and are not scored
+	if result.Predictor != shoppingPredictorName || result.Receipts != 1 || result.Precision != 1 || result.Recall != 0.5 {
+		t.Errorf("Unexpected product backtest %+v", result)
+	}
+}
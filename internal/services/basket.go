@@ -0,0 +1,296 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"whatAmIBuying/internal/database"
+	"whatAmIBuying/internal/models"
+	"whatAmIBuying/internal/render"
+)
+
+// BasketOptions configures which association rules are mined
+type BasketOptions struct {
+	// Level is what the baskets are made of, "product" or "category"
+	Level string
+	// MinSupport is the fraction of baskets an item set must appear in
+	MinSupport float64
+	// MinConfidence is the lowest confidence of a rule
+	MinConfidence float64
+	// MaxSize is the largest number of items in a rule, antecedent and
+	// consequent together
+	MaxSize int
+	// Limit is the number of rules printed, 0 for all
+	Limit int
+	// Format is how the rules are written, a table if empty
+	Format render.Format
+}
+
+// DefaultBasketOptions suits a household's history of weekly shops
+var DefaultBasketOptions = BasketOptions{
+	Level:         "product",
+	MinSupport:    0.02,
+	MinConfidence: 0.5,
+	MaxSize:       3,
+	Limit:         20,
+}
+
+// itemSetKey identifies a sorted item set
+func itemSetKey(items []string) string {
+	return strings.Join(items, "\x00")
+}
+
+// MineAssociationRules finds the item sets bought together in at least
+// minSupport of the baskets with Apriori, and returns the rules with a
+// single consequent reaching minConfidence, by lift then confidence
+func MineAssociationRules(baskets [][]string, opts BasketOptions) []models.AssociationRule {
+	if len(baskets) == 0 {
+		return nil
+	}
+
+	sets := make([]map[string]bool, len(baskets))
+	for i, basket := range baskets {
+		sets[i] = make(map[string]bool)
+		for _, item := range basket {
+			sets[i][item] = true
+		}
+	}
+	// A set seen in a single basket is a coincidence, not a habit
+	minCount := max(2, int(math.Ceil(opts.MinSupport*float64(len(baskets)))))
+
+	counts := make(map[string]int)
+	itemCounts := make(map[string]int)
+	for _, set := range sets {
+		for item := range set {
+			itemCounts[item]++
+		}
+	}
+	var frequent [][]string
+	for item, count := range itemCounts {
+		if count >= minCount {
+			frequent = append(frequent, []string{item})
+			counts[item] = count
+		}
+	}
+
+	var all [][]string
+	for size := 2; size <= opts.MaxSize && len(frequent) > 1; size++ {
+		var next [][]string
+		for _, candidate := range aprioriCandidates(frequent, counts) {
+			count := 0
+			for _, set := range sets {
+				if containsAll(set, candidate) {
+					count++
+				}
+			}
+			if count >= minCount {
+				counts[itemSetKey(candidate)] = count
+				next = append(next, candidate)
+			}
+		}
+		all = append(all, next...)
+		frequent = next
+	}
+
+	total := float64(len(baskets))
+	var rules []models.AssociationRule
+	for _, set := range all {
+		count := counts[itemSetKey(set)]
+		for i, consequent := range set {
+			antecedent := make([]string, 0, len(set)-1)
+			antecedent = append(antecedent, set[:i]...)
+			antecedent = append(antecedent, set[i+1:]...)
+
+			confidence := float64(count) / float64(counts[itemSetKey(antecedent)])
+			if confidence < opts.MinConfidence {
+				continue
+			}
+			rules = append(rules, models.AssociationRule{
+				Antecedent: antecedent,
+				Consequent: consequent,
+				Count:      count,
+				Support:    float64(count) / total,
+				Confidence: confidence,
+				Lift:       confidence / (float64(counts[consequent]) / total),
+			})
+		}
+	}
+
+	sort.Slice(rules, func(i, j int) bool {
+		a, b := rules[i], rules[j]
+		if a.Lift != b.Lift {
+			return a.Lift > b.Lift
+		}
+		if a.Confidence != b.Confidence {
+			return a.Confidence > b.Confidence
+		}
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return itemSetKey(a.Antecedent)+"\x01"+a.Consequent < itemSetKey(b.Antecedent)+"\x01"+b.Consequent
+	})
+	return rules
+}
+
+// aprioriCandidates joins frequent sets sharing all but their last item into
+// sets one larger, keeping those whose every subset is frequent
+func aprioriCandidates(frequent [][]string, counts map[string]int) [][]string {
+	for _, set := range frequent {
+		sort.Strings(set)
+	}
+	sort.Slice(frequent, func(i, j int) bool { return itemSetKey(frequent[i]) < itemSetKey(frequent[j]) })
+
+	var candidates [][]string
+	for i := range frequent {
+		for j := i + 1; j < len(frequent); j++ {
+			a, b := frequent[i], frequent[j]
+			n := len(a)
+			if itemSetKey(a[:n-1]) != itemSetKey(b[:n-1]) {
+				break
+			}
+
+			candidate := append(append([]string{}, a...), b[n-1])
+			pruned := false
+			for k := range candidate {
+				subset := append(append([]string{}, candidate[:k]...), candidate[k+1:]...)
+				if _, ok := counts[itemSetKey(subset)]; !ok {
+					pruned = true
+					break
+				}
+			}
+			if !pruned {
+				candidates = append(candidates, candidate)
+			}
+		}
+	}
+	return candidates
+}
+
+// containsAll reports whether the set holds every item
+func containsAll(set map[string]bool, items []string) bool {
+	for _, item := range items {
+		if !set[item] {
+			return false
+		}
+	}
+	return true
+}
+
+// basketItem names a purchase at the given level, empty if it has no name
+// there
+func basketItem(p models.PurchaseRecord, level string, categoryNames map[int]string) string {
+	if level == "category" {
+		if !p.Purchase.CategoryId.Valid {
+			return ""
+		}
+		return categoryNames[int(p.Purchase.CategoryId.Int64)]
+	}
+	return NormalizeProductName(p.Purchase.Product)
+}
+
+// loadBaskets reads every receipt up to before, or every receipt if before
+// is zero, as a basket of products or categories
+func loadBaskets(db *sql.DB, level string, before time.Time) ([][]string, error) {
+	if level != "product" && level != "category" {
+		return nil, fmt.Errorf("unknown basket level %q, expected product or category", level)
+	}
+
+	purchases, err := loadPurchaseRecords(db, level == "category")
+	if err != nil {
+		return nil, err
+	}
+	if !before.IsZero() {
+		// Records are sorted oldest first
+		end := sort.Search(len(purchases), func(i int) bool { return purchases[i].ReceiptDate.After(before) })
+		purchases = purchases[:end]
+	}
+
+	categoryNames := make(map[int]string)
+	for _, c := range *database.GetAllCategories(db) {
+		categoryNames[c.ID] = c.Category
+	}
+
+	var baskets [][]string
+	for _, receipt := range groupByReceipt(purchases) {
+		var basket []string
+		for _, p := range receipt {
+			if item := basketItem(p, level, categoryNames); item != "" {
+				basket = append(basket, item)
+			}
+		}
+		baskets = append(baskets, basket)
+	}
+	return baskets, nil
+}
+
+// AlsoBuySuggestion is an item usually bought with items already chosen
+type AlsoBuySuggestion struct {
+	Item string
+	// Because are the chosen items the suggestion follows from
+	Because    []string
+	Confidence float64
+}
+
+// AlsoBuy suggests items usually bought with the given ones, most confident
+// first, using every rule whose antecedent is among them. Rules with a lift
+// of 1 or less are skipped, their consequent is bought as often without
+// the antecedent
+func AlsoBuy(rules []models.AssociationRule, items []string) []AlsoBuySuggestion {
+	chosen := make(map[string]bool)
+	for _, item := range items {
+		chosen[item] = true
+	}
+
+	best := make(map[string]AlsoBuySuggestion)
+	for _, rule := range rules {
+		if rule.Lift <= 1 || chosen[rule.Consequent] || !containsAll(chosen, rule.Antecedent) {
+			continue
+		}
+		if s, ok := best[rule.Consequent]; !ok || rule.Confidence > s.Confidence {
+			best[rule.Consequent] = AlsoBuySuggestion{Item: rule.Consequent, Because: rule.Antecedent, Confidence: rule.Confidence}
+		}
+	}
+
+	suggestions := make([]AlsoBuySuggestion, 0, len(best))
+	for _, s := range best {
+		suggestions = append(suggestions, s)
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		if suggestions[i].Confidence != suggestions[j].Confidence {
+			return suggestions[i].Confidence > suggestions[j].Confidence
+		}
+		return suggestions[i].Item < suggestions[j].Item
+	})
+	return suggestions
+}
+
+// BasketInsights prints the products or categories bought together
+func BasketInsights(opts BasketOptions) error {
+	db, err := database.OpenDatabase()
+	if err != nil {
+		log.Fatal("Error opening database: ", err)
+	}
+
+	baskets, err := loadBaskets(db, opts.Level, time.Time{})
+	if err != nil {
+		return err
+	}
+
+	rules := MineAssociationRules(baskets, opts)
+	if opts.Limit > 0 && len(rules) > opts.Limit {
+		rules = rules[:opts.Limit]
+	}
+
+	table := render.NewTable("rules", "Bought", "Also bought", "Support", "Confidence", "Lift", "Receipts")
+	table.Title = fmt.Sprintf("%d rules from %d receipts", len(rules), len(baskets))
+	for _, rule := range rules {
+		table.AddRow(strings.Join(rule.Antecedent, " + "), rule.Consequent, render.Fixed(rule.Support, 3), render.Fixed(rule.Confidence, 2), render.Fixed(rule.Lift, 2), rule.Count)
+	}
+
+	return render.Write(os.Stdout, opts.Format, table)
+}
@@ -0,0 +1,150 @@
+package services
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// tacoBaskets are ten receipts where wraps, taco mix and soured cream go
+// together and milk is bought on most receipts regardless of them
+var tacoBaskets = [][]string{
+	{"wraps", "taco mix", "soured cream", "milk"},
+	{"wraps", "taco mix", "soured cream"},
+	{"wraps", "taco mix", "milk"},
+	{"wraps", "taco mix", "soured cream"},
+	{"milk", "bread"},
+	{"milk", "bread"},
+	{"milk", "bananas"},
+	{"milk"},
+	{"bread", "bananas"},
+	{"bananas", "bananas"},
+}
+
+func TestMineAssociationRules(t *testing.T) {
+	opts := BasketOptions{MinSupport: 0.3, MinConfidence: 0.7, MaxSize: 3}
+
+	rules := MineAssociationRules(tacoBaskets, opts)
+
+	tests := []struct {
+		antecedent []string
+		consequent string
+		count      int
+		confidence float64
+		lift       float64
+	}{
+		{[]string{"taco mix"}, "wraps", 4, 1, 10.0 / 4},
+		{[]string{"wraps"}, "taco mix", 4, 1, 10.0 / 4},
+		{[]string{"soured cream", "taco mix"}, "wraps", 3, 1, 10.0 / 4},
+		{[]string{"soured cream", "wraps"}, "taco mix", 3, 1, 10.0 / 4},
+		{[]string{"soured cream"}, "taco mix", 3, 1, 10.0 / 4},
+		{[]string{"soured cream"}, "wraps", 3, 1, 10.0 / 4},
+		{[]string{"taco mix", "wraps"}, "soured cream", 3, 0.75, 0.75 / 0.3},
+		{[]string{"taco mix"}, "soured cream", 3, 0.75, 0.75 / 0.3},
+		{[]string{"wraps"}, "soured cream", 3, 0.75, 0.75 / 0.3},
+	}
+	if len(rules) != len(tests) {
+		t.Fatalf("Expected %d rules, got %+v", len(tests), rules)
+	}
+	for _, tt := range tests {
+		found := false
+		for _, rule := range rules {
+			if reflect.DeepEqual(rule.Antecedent, tt.antecedent) && rule.Consequent == tt.consequent {
+				found = true
+				if rule.Count != tt.count || math.Abs(rule.Confidence-tt.confidence) > 1e-9 || math.Abs(rule.Lift-tt.lift) > 1e-9 {
+					t.Errorf("Rule %v => %s = %+v, want count %d, confidence %f, lift %f",
+						tt.antecedent, tt.consequent, rule, tt.count, tt.confidence, tt.lift)
+				}
+				if math.Abs(rule.Support-float64(tt.count)/10) > 1e-9 {
+					t.Errorf("Rule %v => %s has support %f", tt.antecedent, tt.consequent, rule.Support)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("Expected a rule %v => %s", tt.antecedent, tt.consequent)
+		}
+	}
+
+	// Sorted by lift, so the rules with soured cream as consequent come last
+	if last := rules[len(rules)-1]; last.Consequent != "soured cream" {
+		t.Errorf("Expected the lowest lift last, got %+v", last)
+	}
+}
+
+func TestMineAssociationRulesLimits(t *testing.T) {
+	tests := []struct {
+		name     string
+		baskets  [][]string
+		opts     BasketOptions
+		expected int
+	}{
+		{"No baskets", nil, DefaultBasketOptions, 0},
+		{"Pairs only", tacoBaskets, BasketOptions{MinSupport: 0.3, MinConfidence: 0.7, MaxSize: 2}, 6},
+		{"High support", tacoBaskets, BasketOptions{MinSupport: 0.5, MinConfidence: 0, MaxSize: 3}, 0},
+		{"Once is a coincidence", [][]string{{"a", "b"}, {"c"}}, BasketOptions{MinSupport: 0, MinConfidence: 0, MaxSize: 3}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rules := MineAssociationRules(tt.baskets, tt.opts); len(rules) != tt.expected {
+				t.Errorf("Expected %d rules, got %+v", tt.expected, rules)
+			}
+		})
+	}
+}
+
+func TestAlsoBuy(t *testing.T) {
+	rules := MineAssociationRules(tacoBaskets, BasketOptions{MinSupport: 0.2, MinConfidence: 0.5, MaxSize: 3})
+
+	suggestions := AlsoBuy(rules, []string{"wraps", "milk"})
+
+	if len(suggestions) != 2 {
+		t.Fatalf("Expected taco mix and soured cream, got %+v", suggestions)
+	}
+	if suggestions[0].Item != "taco mix" || suggestions[0].Confidence != 1 || !reflect.DeepEqual(suggestions[0].Because, []string{"wraps"}) {
+		t.Errorf("Unexpected first suggestion %+v", suggestions[0])
+	}
+	if suggestions[1].Item != "soured cream" {
+		t.Errorf("Unexpected second suggestion %+v", suggestions[1])
+	}
+
+	if s := AlsoBuy(rules, []string{"wraps", "taco mix", "soured cream"}); len(s) != 0 {
+		t.Errorf("Expected no suggestions once everything is chosen, got %+v", s)
+	}
+}
+
+func TestLoadBasketsBefore(t *testing.T) {
+	db, cleanup := setupTestDBForServices(t)
+	defer cleanup()
+
+	for _, date := range []string{"2025-01-06 10:00:00", "2025-01-13 10:00:00", "2025-01-20 10:00:00"} {
+		result, _ := db.Exec("INSERT INTO Receipts (date, amount) VALUES (?, ?)", date, "2.00")
+		receiptId, _ := result.LastInsertId()
+		db.Exec("INSERT INTO Purchases (name, price, receiptId) VALUES (?, ?, ?)", "Wraps", "1.00", receiptId)
+		db.Exec("INSERT INTO Purchases (name, price, receiptId) VALUES (?, ?, ?)", "Taco Mix", "1.00", receiptId)
+	}
+	migrateTestDB(t, db)
+
+	tests := []struct {
+		name     string
+		before   time.Time
+		expected int
+	}{
+		{"Every receipt", time.Time{}, 3},
+		{"Receipts up to the prediction time", time.Date(2025, 1, 13, 18, 0, 0, 0, time.Local), 2},
+		{"Before the first receipt", time.Date(2025, 1, 1, 0, 0, 0, 0, time.Local), 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			baskets, err := loadBaskets(db, "product", tt.before)
+			if err != nil {
+				t.Fatalf("loadBaskets() error = %v", err)
+			}
+			if len(baskets) != tt.expected {
+				t.Errorf("Expected %d baskets, got %v", tt.expected, baskets)
+			}
+		})
+	}
+}
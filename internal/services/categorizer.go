@@ -0,0 +1,699 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"whatAmIBuying/internal/classifier"
+	"whatAmIBuying/internal/database"
+	"whatAmIBuying/internal/models"
+)
+
+// Categorizer assigns a category ID to a purchase
+type Categorizer interface {
+	Name() string
+	Categorize(ctx context.Context, purchase models.Purchase) (int, error)
+}
+
+// CategorizeOptions configures how purchases are categorized automatically
+type CategorizeOptions struct {
+	// Categorizer is the name of the categorizer to use
+	Categorizer string
+	// Model is the Ollama model used by the LLM categorizer, DefaultLLMModel if empty
+	Model string
+	// Pull downloads a missing Ollama model instead of refusing to start
+	Pull bool
+	// Timeout limits how long a single LLM request may take, 0 for no limit
+	Timeout time.Duration
+	// Progress receives progress output of streamed LLM responses, if set
+	Progress io.Writer
+	// Retries is how often a transient LLM failure is retried
+	Retries int
+	// Audit records the details of every LLM categorization of a stored purchase
+	Audit bool
+	// Workers is how many purchases are categorized at the same time
+	Workers int
+	// Hosts are the Ollama servers LLM requests are spread over, OllamaHost if empty
+	Hosts []string
+	// PromptFile is the prompt template used by the LLM categorizer, the
+	// built-in prompt if empty
+	PromptFile string
+	// Training, if not nil, are the categorized purchases learned from
+	// instead of every categorized purchase in the database, and the LLM cache
+	// is left alone, so purchases held out of it can be evaluated fairly
+	Training []models.Purchase
+	// SkipCache stops the LLM categorizer from reading or writing cached
+	// responses
+	SkipCache bool
+}
+
+// statsReporter is implemented by categorizers that keep statistics worth
+// showing at the end of a run
+type statsReporter interface {
+	Stats() string
+}
+
+// deferredCategorizer is implemented by categorizers that write to the
+// database while categorizing. categorizeDeferred returns those writes to be
+// made by the caller instead of making them
+type deferredCategorizer interface {
+	categorizeDeferred(ctx context.Context, purchase models.Purchase) (int, deferredWrites, error)
+}
+
+// deferredWrites are the database writes of a single categorization
+type deferredWrites struct {
+	// cache is made once the categorization is handled
+	cache func() error
+	// audit is made once the category is assigned to the purchase, nil if
+	// the categorization is not audited
+	audit func() error
+}
+
+// historyLearner is implemented by categorizers that learn from purchases
+// categorized during the current run
+type historyLearner interface {
+	Learn(ctx context.Context, purchase models.Purchase)
+}
+
+// NewCategorizer creates the categorizer named in the options. Models used by
+// Ollama based categorizers are checked before use, so a missing model or
+// server is reported before any purchase is processed
+func NewCategorizer(ctx context.Context, db *sql.DB, opts CategorizeOptions) (Categorizer, error) {
+	if opts.Model == "" {
+		opts.Model = DefaultLLMModel
+	}
+	progress := opts.Progress
+	if progress == nil {
+		progress = io.Discard
+	}
+
+	switch opts.Categorizer {
+	case "llm":
+		if err := ensureModelOnHosts(ctx, opts, progress); err != nil {
+			return nil, err
+		}
+		return newConfiguredLLMCategorizer(db, opts)
+	case "embedding":
+		if err := EnsureModel(ctx, DefaultEmbeddingModel, opts.Pull, progress); err != nil {
+			return nil, err
+		}
+		if opts.Training != nil {
+			return newEmbeddingCategorizer(ctx, db, DefaultEmbeddingModel, defaultNeighbours, opts.Training)
+		}
+		return NewEmbeddingCategorizer(ctx, db, DefaultEmbeddingModel, defaultNeighbours)
+	case "classifier":
+		return newConfiguredClassifierCategorizer(opts)
+	case "history":
+		if opts.Training != nil {
+			return newHistoryCategorizer(opts.Training), nil
+		}
+		return NewHistoryCategorizer(db)
+	case "rules":
+		return NewRulesCategorizer(db), nil
+	case "auto":
+		err := ensureModelOnHosts(ctx, opts, progress)
+		if err == nil {
+			return newConfiguredLLMCategorizer(db, opts)
+		}
+		fmt.Printf("%v\nFalling back to the offline classifier\n", err)
+		return newConfiguredClassifierCategorizer(opts)
+	default:
+		return nil, fmt.Errorf("unknown categorizer %q", opts.Categorizer)
+	}
+}
+
+// ensureModelOnHosts checks every Ollama server named in the options for the
+// LLM model
+func ensureModelOnHosts(ctx context.Context, opts CategorizeOptions, progress io.Writer) error {
+	hosts := opts.Hosts
+	if len(hosts) == 0 {
+		hosts = []string{OllamaHost}
+	}
+
+	for _, host := range hosts {
+		if err := ensureModelAt(ctx, host, opts.Model, opts.Pull, progress); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newConfiguredLLMCategorizer(db *sql.DB, opts CategorizeOptions) (*LLMCategorizer, error) {
+	prompt, err := LoadPromptTemplate(opts.PromptFile)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := NewLLMCategorizer(db, opts.Model)
+	if err != nil {
+		return nil, err
+	}
+	c.Prompt = prompt
+	c.Timeout = opts.Timeout
+	c.Retry.MaxAttempts = opts.Retries + 1
+	c.Audit = opts.Audit
+	c.Hosts = opts.Hosts
+	c.SkipCache = opts.SkipCache
+	if opts.Training != nil {
+		c.history = opts.Training
+		c.SkipCache = true
+	}
+	// Status lines of concurrent streams would overwrite each other
+	if opts.Workers <= 1 {
+		c.Progress = opts.Progress
+	}
+	return c, nil
+}
+
+// LLMCategorizer categorizes purchases by prompting a generative Ollama model.
+// Responses are cached per model, prompt template version and normalized
+// product name, unless SkipCache is set.
+// With Audit set, the prompt, response, reasoning and token counts of every
+// categorization are stored with the purchase. It is safe for concurrent use,
+// requests are spread over Hosts in turn
+type LLMCategorizer struct {
+	Model       string
+	SkipCache   bool
+	Timeout     time.Duration
+	Progress    io.Writer
+	Retry       RetryPolicy
+	Audit       bool
+	Hosts       []string
+	Prompt      *PromptTemplate
+	CacheHits   int
+	CacheMisses int
+	db          *sql.DB
+	categories  []models.Category
+	mu          sync.Mutex
+	history     []models.Purchase
+	nextHost    atomic.Uint32
+}
+
+// NewLLMCategorizer creates an LLM categorizer using the categories and
+// categorized purchases in the database
+func NewLLMCategorizer(db *sql.DB, model string) (*LLMCategorizer, error) {
+	err := database.CreateLLMCacheTable(db)
+	if err != nil {
+		return nil, err
+	}
+
+	err = database.CreateAuditTable(db)
+	if err != nil {
+		return nil, err
+	}
+
+	history, err := database.GetCategorizedPurchases(db)
+	if err != nil {
+		return nil, fmt.Errorf("getting categorized purchases failed: %w", err)
+	}
+
+	return &LLMCategorizer{
+		Model:      model,
+		Retry:      DefaultRetryPolicy,
+		Prompt:     DefaultPromptTemplate(),
+		db:         db,
+		categories: *database.GetAllCategories(db),
+		history:    history,
+	}, nil
+}
+
+func (c *LLMCategorizer) Name() string {
+	return "llm"
+}
+
+func (c *LLMCategorizer) Categorize(ctx context.Context, purchase models.Purchase) (int, error) {
+	id, writes, err := c.categorizeDeferred(ctx, purchase)
+	if err != nil {
+		return 0, err
+	}
+	if err := writes.cache(); err != nil {
+		return 0, err
+	}
+	if writes.audit != nil {
+		if err := writes.audit(); err != nil {
+			return 0, err
+		}
+	}
+	return id, nil
+}
+
+// categorizeDeferred categorizes a purchase and returns the cache and audit
+// writes instead of making them, so concurrent categorizations leave all
+// database writes to the goroutine handling their results, and the audit is
+// only recorded for a category that was assigned
+func (c *LLMCategorizer) categorizeDeferred(ctx context.Context, purchase models.Purchase) (int, deferredWrites, error) {
+	name := NormalizeProductName(purchase.Product)
+
+	var response string
+	var found bool
+	var err error
+	if !c.SkipCache {
+		response, found, err = database.GetCachedResponse(c.db, c.Model, c.Prompt.Version, name)
+		if err != nil {
+			return 0, deferredWrites{}, err
+		}
+	}
+	if found {
+		id, err := ParseLLMResponse(response)
+		if err == nil {
+			c.mu.Lock()
+			c.CacheHits++
+			c.mu.Unlock()
+			writes := deferredWrites{
+				cache: func() error {
+					return database.RecordCacheHit(c.db, c.Model, c.Prompt.Version, name)
+				},
+				audit: c.auditWrite(models.CategorizationAudit{
+					PurchaseID:  purchase.Id,
+					CategoryID:  id,
+					RawResponse: response,
+					Cached:      true,
+				}),
+			}
+			return id, writes, nil
+		}
+	}
+	c.mu.Lock()
+	c.CacheMisses++
+	history := c.history
+	c.mu.Unlock()
+
+	store, err := database.GetReceiptStore(c.db, purchase.ReceiptId)
+	if err != nil {
+		return 0, deferredWrites{}, err
+	}
+
+	examples := FindSimilarPurchases(purchase, history, fewShotExamples)
+	prompt, err := c.Prompt.Render(c.categories, examples, purchase, store)
+	if err != nil {
+		return 0, deferredWrites{}, err
+	}
+
+	var result OllamaResult
+	err = c.Retry.Do(ctx, func() error {
+		result, err = c.generate(ctx, purchase.Product, prompt)
+		return err
+	}, func(retry int, wait time.Duration, err error) {
+		if c.Progress != nil {
+			fmt.Fprintf(c.Progress, "Retrying '%s' in %v (retry %d of %d): %v\n", purchase.Product, wait, retry, c.Retry.MaxAttempts-1, err)
+		}
+	})
+	if err != nil {
+		return 0, deferredWrites{}, fmt.Errorf("error calling Ollama: %w", err)
+	}
+
+	id, err := ParseLLMResponse(result.Response)
+	if err != nil {
+		return 0, deferredWrites{}, fmt.Errorf("error parsing LLM response: %w", err)
+	}
+
+	writes := deferredWrites{
+		cache: func() error {
+			// Only responses that parse are cached, so failures are retried next run
+			if c.SkipCache {
+				return nil
+			}
+			return database.SaveCachedResponse(c.db, c.Model, c.Prompt.Version, name, result.Response)
+		},
+		audit: c.auditWrite(models.CategorizationAudit{
+			PurchaseID:     purchase.Id,
+			CategoryID:     id,
+			Prompt:         prompt,
+			RawResponse:    result.Raw,
+			Reasoning:      result.Reasoning,
+			PromptTokens:   result.Final.PromptEvalCount,
+			ResponseTokens: result.Final.EvalCount,
+			Duration:       time.Duration(result.Final.TotalDuration),
+		}),
+	}
+	return id, writes, nil
+}
+
+// auditWrite returns the write storing an audit of a categorization, nil if
+// auditing is disabled or the purchase is not stored in the database
+func (c *LLMCategorizer) auditWrite(audit models.CategorizationAudit) func() error {
+	if !c.Audit || audit.PurchaseID == 0 {
+		return nil
+	}
+
+	audit.Model = c.Model
+	audit.PromptVersion = c.Prompt.Version
+	return func() error {
+		_, err := database.AddCategorizationAudit(c.db, audit)
+		return err
+	}
+}
+
+// generate makes a single streamed request to the model, limited by the
+// categorizer's timeout
+func (c *LLMCategorizer) generate(ctx context.Context, product string, prompt string) (OllamaResult, error) {
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	var onChunk func(OllamaResponse)
+	if c.Progress != nil {
+		progress := NewStreamProgress(c.Progress, product)
+		defer progress.Finish()
+		onChunk = progress.Update
+	}
+
+	return callOllamaStreamAt(ctx, c.host(), OllamaRequest{Model: c.Model, Prompt: prompt}, onChunk)
+}
+
+// host returns the Ollama server for the next request
+func (c *LLMCategorizer) host() string {
+	if len(c.Hosts) == 0 {
+		return OllamaHost
+	}
+	n := c.nextHost.Add(1) - 1
+	return c.Hosts[int(n)%len(c.Hosts)]
+}
+
+func (c *LLMCategorizer) Stats() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	total := c.CacheHits + c.CacheMisses
+	if total == 0 {
+		return "LLM cache: no lookups"
+	}
+	return fmt.Sprintf("LLM cache: %d hits, %d misses (%.0f%% hit rate)", c.CacheHits, c.CacheMisses, 100*float64(c.CacheHits)/float64(total))
+}
+
+func (c *LLMCategorizer) Learn(ctx context.Context, purchase models.Purchase) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.history = append(c.history, purchase)
+}
+
+// defaultNeighbours is how many nearest purchases vote on a category
+const defaultNeighbours = 5
+
+type embeddedPurchase struct {
+	categoryID int
+	vector     []float64
+}
+
+// EmbeddingCategorizer categorizes purchases by a k-nearest-neighbour vote
+// over the embeddings of already categorized purchases
+type EmbeddingCategorizer struct {
+	Model      string
+	K          int
+	db         *sql.DB
+	mu         sync.Mutex
+	neighbours []embeddedPurchase
+}
+
+// NewEmbeddingCategorizer creates an embedding categorizer, embedding every
+// categorized purchase in the database that is not cached yet
+func NewEmbeddingCategorizer(ctx context.Context, db *sql.DB, model string, k int) (*EmbeddingCategorizer, error) {
+	history, err := database.GetCategorizedPurchases(db)
+	if err != nil {
+		return nil, fmt.Errorf("getting categorized purchases failed: %w", err)
+	}
+
+	return newEmbeddingCategorizer(ctx, db, model, k, history)
+}
+
+// newEmbeddingCategorizer creates an embedding categorizer comparing
+// purchases with the given categorized purchases
+func newEmbeddingCategorizer(ctx context.Context, db *sql.DB, model string, k int, history []models.Purchase) (*EmbeddingCategorizer, error) {
+	err := database.CreateEmbeddingsTable(db)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &EmbeddingCategorizer{Model: model, K: k, db: db}
+	for _, p := range history {
+		vector, err := c.embed(ctx, p.Product)
+		if err != nil {
+			return nil, err
+		}
+		c.neighbours = append(c.neighbours, embeddedPurchase{categoryID: int(p.CategoryId.Int64), vector: vector})
+	}
+
+	return c, nil
+}
+
+func (c *EmbeddingCategorizer) Name() string {
+	return "embedding"
+}
+
+func (c *EmbeddingCategorizer) Categorize(ctx context.Context, purchase models.Purchase) (int, error) {
+	c.mu.Lock()
+	neighbours := c.neighbours
+	c.mu.Unlock()
+
+	if len(neighbours) == 0 {
+		return 0, fmt.Errorf("no categorized purchases to compare '%s' with", purchase.Product)
+	}
+
+	vector, err := c.embed(ctx, purchase.Product)
+	if err != nil {
+		return 0, err
+	}
+
+	type neighbour struct {
+		categoryID int
+		similarity float64
+	}
+	nearest := make([]neighbour, 0, len(neighbours))
+	for _, n := range neighbours {
+		nearest = append(nearest, neighbour{categoryID: n.categoryID, similarity: CosineSimilarity(vector, n.vector)})
+	}
+	sort.SliceStable(nearest, func(i, j int) bool {
+		return nearest[i].similarity > nearest[j].similarity
+	})
+	if len(nearest) > c.K {
+		nearest = nearest[:c.K]
+	}
+
+	// Each neighbour votes with its similarity, so close matches outweigh far ones
+	votes := make(map[int]float64)
+	bestID := 0
+	for _, n := range nearest {
+		votes[n.categoryID] += n.similarity
+		if bestID == 0 || votes[n.categoryID] > votes[bestID] {
+			bestID = n.categoryID
+		}
+	}
+
+	return bestID, nil
+}
+
+func (c *EmbeddingCategorizer) Learn(ctx context.Context, purchase models.Purchase) {
+	vector, err := c.embed(ctx, purchase.Product)
+	if err != nil {
+		log.Printf("Error embedding '%s', not learning its category: %v", purchase.Product, err)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.neighbours = append(c.neighbours, embeddedPurchase{categoryID: int(purchase.CategoryId.Int64), vector: vector})
+}
+
+// embed returns the embedding of a product name, from the cache if possible
+func (c *EmbeddingCategorizer) embed(ctx context.Context, product string) ([]float64, error) {
+	name := NormalizeProductName(product)
+
+	vector, found, err := database.GetEmbedding(c.db, c.Model, name)
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		return vector, nil
+	}
+
+	vector, err = GetOllamaEmbedding(ctx, c.Model, name)
+	if err != nil {
+		return nil, fmt.Errorf("error embedding '%s': %w", product, err)
+	}
+
+	err = database.SaveEmbedding(c.db, c.Model, name, vector)
+	if err != nil {
+		return nil, err
+	}
+
+	return vector, nil
+}
+
+// HistoryCategorizer categorizes purchases the same way a purchase with the
+// same normalized name was categorized before
+type HistoryCategorizer struct {
+	mu    sync.RWMutex
+	votes map[string]map[int]int
+}
+
+// NewHistoryCategorizer creates a history categorizer from the categorized
+// purchases in the database
+func NewHistoryCategorizer(db *sql.DB) (*HistoryCategorizer, error) {
+	history, err := database.GetCategorizedPurchases(db)
+	if err != nil {
+		return nil, fmt.Errorf("getting categorized purchases failed: %w", err)
+	}
+
+	return newHistoryCategorizer(history), nil
+}
+
+// newHistoryCategorizer creates a history categorizer from the given
+// categorized purchases
+func newHistoryCategorizer(history []models.Purchase) *HistoryCategorizer {
+	c := &HistoryCategorizer{votes: make(map[string]map[int]int)}
+	for _, p := range history {
+		c.Learn(context.Background(), p)
+	}
+	return c
+}
+
+func (c *HistoryCategorizer) Name() string {
+	return "history"
+}
+
+func (c *HistoryCategorizer) Categorize(ctx context.Context, purchase models.Purchase) (int, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	votes, ok := c.votes[NormalizeProductName(purchase.Product)]
+	if !ok {
+		return 0, fmt.Errorf("'%s' has not been categorized before", purchase.Product)
+	}
+
+	// The most common category wins, ties go to the lowest ID to stay deterministic
+	bestID := 0
+	for id, count := range votes {
+		if bestID == 0 || count > votes[bestID] || (count == votes[bestID] && id < bestID) {
+			bestID = id
+		}
+	}
+
+	return bestID, nil
+}
+
+func (c *HistoryCategorizer) Learn(ctx context.Context, purchase models.Purchase) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	name := NormalizeProductName(purchase.Product)
+	if c.votes[name] == nil {
+		c.votes[name] = make(map[int]int)
+	}
+	c.votes[name][int(purchase.CategoryId.Int64)]++
+}
+
+// RulesCategorizer categorizes purchases by the category whose name appears
+// as a word in the product name, e.g. "Beef Steak Mince" as Beef. Plurals
+// match too and the longest matching name wins
+type RulesCategorizer struct {
+	categories []models.Category
+}
+
+// NewRulesCategorizer creates a rules categorizer from the categories in the
+// database
+func NewRulesCategorizer(db *sql.DB) *RulesCategorizer {
+	return &RulesCategorizer{categories: *database.GetAllCategories(db)}
+}
+
+func (c *RulesCategorizer) Name() string {
+	return "rules"
+}
+
+func (c *RulesCategorizer) Categorize(ctx context.Context, purchase models.Purchase) (int, error) {
+	words := make(map[string]bool)
+	for _, word := range strings.Fields(NormalizeProductName(purchase.Product)) {
+		words[word] = true
+		words[strings.TrimSuffix(word, "s")] = true
+		words[strings.TrimSuffix(word, "es")] = true
+	}
+
+	bestID, bestLength := 0, 0
+	for _, category := range c.categories {
+		for _, word := range strings.Fields(NormalizeProductName(category.Category)) {
+			singular := strings.TrimSuffix(word, "s")
+			if (words[word] || words[singular]) && len(word) > bestLength {
+				bestID, bestLength = category.ID, len(word)
+			}
+		}
+	}
+	if bestID == 0 {
+		return 0, fmt.Errorf("no category name found in '%s'", purchase.Product)
+	}
+
+	return bestID, nil
+}
+
+// DefaultClassifierPath is where the trained offline classifier is stored
+const DefaultClassifierPath = "classifier_model.json"
+
+// ClassifierCategorizer categorizes purchases with the offline naive Bayes
+// classifier trained by "model train"
+type ClassifierCategorizer struct {
+	model *classifier.NaiveBayes
+}
+
+// NewClassifierCategorizer loads a trained classifier from the given path
+func NewClassifierCategorizer(path string) (*ClassifierCategorizer, error) {
+	model, err := classifier.Load(path)
+	if err != nil {
+		return nil, fmt.Errorf("loading classifier failed, run 'model train' first: %w", err)
+	}
+
+	return &ClassifierCategorizer{model: model}, nil
+}
+
+// newConfiguredClassifierCategorizer trains a classifier on the training
+// purchases of the options, or loads the one trained by "model train"
+func newConfiguredClassifierCategorizer(opts CategorizeOptions) (*ClassifierCategorizer, error) {
+	if opts.Training == nil {
+		return NewClassifierCategorizer(DefaultClassifierPath)
+	}
+
+	examples := purchaseExamples(opts.Training)
+	if len(examples) == 0 {
+		return nil, fmt.Errorf("no categorized purchases to train the classifier on")
+	}
+	return &ClassifierCategorizer{model: classifier.Train(examples)}, nil
+}
+
+func (c *ClassifierCategorizer) Name() string {
+	return "classifier"
+}
+
+func (c *ClassifierCategorizer) Categorize(ctx context.Context, purchase models.Purchase) (int, error) {
+	id, _, err := c.model.Predict(NormalizeProductName(purchase.Product))
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// CosineSimilarity returns the cosine of the angle between two vectors
+func CosineSimilarity(a []float64, b []float64) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+
+	var dot, normA, normB float64
+	for i := range a {
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
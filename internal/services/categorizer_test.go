@@ -0,0 +1,371 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"whatAmIBuying/internal/classifier"
+	"whatAmIBuying/internal/database"
+	"whatAmIBuying/internal/models"
+)
+
+// ollamaStub counts the requests made to a fake Ollama server
+type ollamaStub struct {
+	generateCalls int32
+	embedCalls    int32
+}
+
+// startOllamaStub starts a fake Ollama server answering generate requests with
+// the given response and embedding requests with keyword based vectors
+func startOllamaStub(t *testing.T, generateResponse string) (*ollamaStub, func()) {
+	stub := &ollamaStub{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/generate":
+			atomic.AddInt32(&stub.generateCalls, 1)
+			json.NewEncoder(w).Encode(OllamaResponse{Response: generateResponse, Done: true})
+		case "/api/embeddings":
+			atomic.AddInt32(&stub.embedCalls, 1)
+			var req OllamaEmbeddingRequest
+			json.NewDecoder(r.Body).Decode(&req)
+
+			vector := []float64{0, 0, 1}
+			if strings.Contains(req.Prompt, "milk") || strings.Contains(req.Prompt, "yogurt") {
+				vector = []float64{1, 0.1, 0}
+			} else if strings.Contains(req.Prompt, "chicken") || strings.Contains(req.Prompt, "steak") {
+				vector = []float64{0, 1, 0.1}
+			}
+			json.NewEncoder(w).Encode(OllamaEmbeddingResponse{Embedding: vector})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	previousHost := OllamaHost
+	OllamaHost = server.URL
+	return stub, func() {
+		OllamaHost = previousHost
+		server.Close()
+	}
+}
+
+func TestCosineSimilarity(t *testing.T) {
+	tests := []struct {
+		name     string
+		a        []float64
+		b        []float64
+		expected float64
+	}{
+		{name: "Identical", a: []float64{1, 2}, b: []float64{1, 2}, expected: 1},
+		{name: "Orthogonal", a: []float64{1, 0}, b: []float64{0, 1}, expected: 0},
+		{name: "Opposite", a: []float64{1, 0}, b: []float64{-1, 0}, expected: -1},
+		{name: "Different lengths", a: []float64{1}, b: []float64{1, 0}, expected: 0},
+		{name: "Zero vector", a: []float64{0, 0}, b: []float64{1, 0}, expected: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := CosineSimilarity(tt.a, tt.b)
+			if result < tt.expected-1e-9 || result > tt.expected+1e-9 {
+				t.Errorf("CosineSimilarity() = %f, want %f", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestEmbeddingCategorizer(t *testing.T) {
+	db, cleanup := setupTestDBForServices(t)
+	defer cleanup()
+
+	stub, stop := startOllamaStub(t, "")
+	defer stop()
+
+	result, _ := db.Exec("INSERT INTO Receipts (date, amount) VALUES (?, ?)", "2025-01-06 10:00:00", "10.00")
+	receiptId, _ := result.LastInsertId()
+	db.Exec("INSERT INTO Purchases (name, price, receiptId, categoryId) VALUES (?, ?, ?, ?)", "Whole Milk", "1.50", receiptId, 1)
+	db.Exec("INSERT INTO Purchases (name, price, receiptId, categoryId) VALUES (?, ?, ?, ?)", "Greek Yogurt", "1.65", receiptId, 1)
+	db.Exec("INSERT INTO Purchases (name, price, receiptId, categoryId) VALUES (?, ?, ?, ?)", "Chicken Breast", "4.00", receiptId, 2)
+
+	categorizer, err := NewEmbeddingCategorizer(context.Background(), db, "test-embed", 3)
+	if err != nil {
+		t.Fatalf("NewEmbeddingCategorizer() error = %v", err)
+	}
+
+	id, err := categorizer.Categorize(context.Background(), models.Purchase{Product: "Semi Skimmed Milk 0082031"})
+	if err != nil {
+		t.Fatalf("Categorize() error = %v", err)
+	}
+	if id != 1 {
+		t.Errorf("Expected milk to be categorized as 1, got %d", id)
+	}
+
+	id, err = categorizer.Categorize(context.Background(), models.Purchase{Product: "Rump Steak"})
+	if err != nil {
+		t.Fatalf("Categorize() error = %v", err)
+	}
+	if id != 2 {
+		t.Errorf("Expected steak to be categorized as 2, got %d", id)
+	}
+
+	// A second categorizer should reuse the cached vectors of the history
+	callsBefore := atomic.LoadInt32(&stub.embedCalls)
+	_, err = NewEmbeddingCategorizer(context.Background(), db, "test-embed", 3)
+	if err != nil {
+		t.Fatalf("NewEmbeddingCategorizer() error = %v", err)
+	}
+	if calls := atomic.LoadInt32(&stub.embedCalls); calls != callsBefore {
+		t.Errorf("Expected cached embeddings to be reused, got %d new embedding calls", calls-callsBefore)
+	}
+}
+
+func TestEmbeddingCategorizerWithoutHistory(t *testing.T) {
+	db, cleanup := setupTestDBForServices(t)
+	defer cleanup()
+
+	_, stop := startOllamaStub(t, "")
+	defer stop()
+
+	categorizer, err := NewEmbeddingCategorizer(context.Background(), db, "test-embed", 3)
+	if err != nil {
+		t.Fatalf("NewEmbeddingCategorizer() error = %v", err)
+	}
+
+	_, err = categorizer.Categorize(context.Background(), models.Purchase{Product: "Milk"})
+	if err == nil {
+		t.Error("Expected an error when there are no categorized purchases")
+	}
+
+	// Learning follows the caller's context, a cancelled one embeds nothing
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	categorizer.Learn(ctx, models.Purchase{Product: "Whole Milk", CategoryId: sql.NullInt64{Int64: 1, Valid: true}})
+	_, err = categorizer.Categorize(context.Background(), models.Purchase{Product: "Milk"})
+	if err == nil {
+		t.Error("Expected nothing to be learned with a cancelled context")
+	}
+
+	categorizer.Learn(context.Background(), models.Purchase{Product: "Whole Milk", CategoryId: sql.NullInt64{Int64: 1, Valid: true}})
+	id, err := categorizer.Categorize(context.Background(), models.Purchase{Product: "Milk"})
+	if err != nil || id != 1 {
+		t.Errorf("Categorize() = %d, %v, want the learned category 1", id, err)
+	}
+}
+
+func TestAutoAssignPurchasesWithLLMCategorizer(t *testing.T) {
+	db, cleanup := setupTestDBForServices(t)
+	defer cleanup()
+
+	_, stop := startOllamaStub(t, "<think>It is a meat product</think>{\"ID\": 2}")
+	defer stop()
+
+	result, _ := db.Exec("INSERT INTO Receipts (date, amount) VALUES (?, ?)", "2025-01-06 10:00:00", "10.00")
+	receiptId, _ := result.LastInsertId()
+	db.Exec("INSERT INTO Purchases (name, price, receiptId) VALUES (?, ?, ?)", "Chick Breast Fil", "4.00", receiptId)
+
+	categorizer, err := NewLLMCategorizer(db, "test-model")
+	if err != nil {
+		t.Fatalf("NewLLMCategorizer() error = %v", err)
+	}
+
+	err = AutoAssignPurchases(context.Background(), db, categorizer, 1)
+	if err != nil {
+		t.Fatalf("AutoAssignPurchases() error = %v", err)
+	}
+
+	var categoryId int
+	err = db.QueryRow("SELECT categoryId FROM Purchases WHERE name = ?", "Chick Breast Fil").Scan(&categoryId)
+	if err != nil {
+		t.Fatalf("Failed to query purchase: %v", err)
+	}
+	if categoryId != 2 {
+		t.Errorf("Expected category 2, got %d", categoryId)
+	}
+}
+
+func TestLLMCategorizerCache(t *testing.T) {
+	db, cleanup := setupTestDBForServices(t)
+	defer cleanup()
+
+	stub, stop := startOllamaStub(t, "{\"ID\": 1}")
+	defer stop()
+
+	categorizer, err := NewLLMCategorizer(db, "test-model")
+	if err != nil {
+		t.Fatalf("NewLLMCategorizer() error = %v", err)
+	}
+
+	for _, product := range []string{"Whole Milk 0082031", "whole milk", "Greek Yogurt"} {
+		id, err := categorizer.Categorize(context.Background(), models.Purchase{Product: product, Price: "1.00"})
+		if err != nil {
+			t.Fatalf("Categorize() error = %v", err)
+		}
+		if id != 1 {
+			t.Errorf("Expected category 1 for %s, got %d", product, id)
+		}
+	}
+
+	if calls := atomic.LoadInt32(&stub.generateCalls); calls != 2 {
+		t.Errorf("Expected 2 model calls, got %d", calls)
+	}
+	if categorizer.CacheHits != 1 || categorizer.CacheMisses != 2 {
+		t.Errorf("Expected 1 hit and 2 misses, got %d hits and %d misses", categorizer.CacheHits, categorizer.CacheMisses)
+	}
+	stats, _ := database.GetLLMCacheStats(db)
+	if len(stats) != 1 || stats[0].Hits != 1 {
+		t.Errorf("Expected the hit recorded in the cache, got %+v", stats)
+	}
+
+	// Another model must not reuse the cached responses
+	other, _ := NewLLMCategorizer(db, "other-model")
+	other.Categorize(context.Background(), models.Purchase{Product: "Whole Milk"})
+	if calls := atomic.LoadInt32(&stub.generateCalls); calls != 3 {
+		t.Errorf("Expected the other model to be called, got %d calls in total", calls)
+	}
+}
+
+func TestLLMCategorizerAudit(t *testing.T) {
+	db, cleanup := setupTestDBForServices(t)
+	defer cleanup()
+
+	_, stop := startOllamaStub(t, "<think>It comes from a cow</think>{\"ID\": 1}")
+	defer stop()
+
+	result, _ := db.Exec("INSERT INTO Receipts (date, amount, store) VALUES (?, ?, ?)", "2025-01-06 10:00:00", "2.40", "Lidl")
+	receiptId, _ := result.LastInsertId()
+	result, _ = db.Exec("INSERT INTO Purchases (name, price, receiptId) VALUES (?, ?, ?)", "Whole Milk", "1.20", receiptId)
+	firstId, _ := result.LastInsertId()
+	result, _ = db.Exec("INSERT INTO Purchases (name, price, receiptId) VALUES (?, ?, ?)", "Whole Milk", "1.20", receiptId)
+	secondId, _ := result.LastInsertId()
+
+	categorizer, err := NewLLMCategorizer(db, "test-model")
+	if err != nil {
+		t.Fatalf("NewLLMCategorizer() error = %v", err)
+	}
+	categorizer.Audit = true
+
+	for _, id := range []int64{firstId, secondId} {
+		_, err := categorizer.Categorize(context.Background(), models.Purchase{Id: int(id), Product: "Whole Milk", Price: "1.20", ReceiptId: int(receiptId)})
+		if err != nil {
+			t.Fatalf("Categorize() error = %v", err)
+		}
+	}
+
+	audits, err := database.GetAuditsForPurchase(db, int(firstId))
+	if err != nil {
+		t.Fatalf("GetAuditsForPurchase() error = %v", err)
+	}
+	if len(audits) != 1 {
+		t.Fatalf("Expected 1 audit, got %d", len(audits))
+	}
+	audit := audits[0]
+	if audit.Reasoning != "It comes from a cow" || audit.Model != "test-model" || audit.PromptVersion != PromptVersion {
+		t.Errorf("Unexpected audit %+v", audit)
+	}
+	if !strings.Contains(audit.Prompt, "Whole Milk bought for 1.20 at Lidl") || audit.Cached {
+		t.Errorf("Expected the prompt of an uncached categorization, got %+v", audit)
+	}
+
+	audits, _ = database.GetAuditsForPurchase(db, int(secondId))
+	if len(audits) != 1 || !audits[0].Cached || audits[0].CategoryID != 1 {
+		t.Errorf("Expected a cached audit for the second purchase, got %+v", audits)
+	}
+}
+
+func TestAutoAssignPurchasesAuditsOnlyAssigned(t *testing.T) {
+	db, cleanup := setupTestDBForServices(t)
+	defer cleanup()
+
+	result, _ := db.Exec("INSERT INTO Receipts (date, amount) VALUES (?, ?)", "2025-01-06 10:00:00", "1.20")
+	receiptId, _ := result.LastInsertId()
+	result, _ = db.Exec("INSERT INTO Purchases (name, price, receiptId) VALUES (?, ?, ?)", "Whole Milk", "1.20", receiptId)
+	purchaseId, _ := result.LastInsertId()
+
+	tests := []struct {
+		name     string
+		response string
+		audits   int
+	}{
+		{"Unknown category is not audited", `{"ID": 99}`, 0},
+		{"Assigned category is audited", `{"ID": 1}`, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, stop := startOllamaStub(t, tt.response)
+			defer stop()
+
+			categorizer, err := NewLLMCategorizer(db, "test-model")
+			if err != nil {
+				t.Fatalf("NewLLMCategorizer() error = %v", err)
+			}
+			categorizer.Audit = true
+			categorizer.SkipCache = true
+
+			if err := AutoAssignPurchases(context.Background(), db, categorizer, 1); err != nil {
+				t.Fatalf("AutoAssignPurchases() error = %v", err)
+			}
+
+			audits, _ := database.GetAuditsForPurchase(db, int(purchaseId))
+			if len(audits) != tt.audits {
+				t.Errorf("Expected %d audits, got %+v", tt.audits, audits)
+			}
+		})
+	}
+}
+
+func TestNewCategorizerUnknownName(t *testing.T) {
+	_, err := NewCategorizer(context.Background(), nil, CategorizeOptions{Categorizer: "crystal-ball"})
+	if err == nil {
+		t.Error("Expected an error for an unknown categorizer")
+	}
+}
+
+func TestClassifierCategorizer(t *testing.T) {
+	path := "test_classifier_model.json"
+	defer os.Remove(path)
+
+	history := []models.Purchase{
+		{Product: "Whole Milk", CategoryId: sql.NullInt64{Int64: 1, Valid: true}},
+		{Product: "Greek Natural Yogurt", CategoryId: sql.NullInt64{Int64: 1, Valid: true}},
+		{Product: "Chick Breast Fil 0082031", CategoryId: sql.NullInt64{Int64: 2, Valid: true}},
+		{Product: "Chicken Thighs", CategoryId: sql.NullInt64{Int64: 2, Valid: true}},
+		{Product: "Unassigned Item", CategoryId: sql.NullInt64{}},
+	}
+
+	examples := purchaseExamples(history)
+	if len(examples) != 4 {
+		t.Fatalf("Expected 4 examples from categorized purchases, got %d", len(examples))
+	}
+	if examples[2].Text != "chick breast fil" {
+		t.Errorf("Expected normalized example text, got %q", examples[2].Text)
+	}
+
+	err := classifier.Train(examples).Save(path)
+	if err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	categorizer, err := NewClassifierCategorizer(path)
+	if err != nil {
+		t.Fatalf("NewClassifierCategorizer() error = %v", err)
+	}
+
+	id, err := categorizer.Categorize(context.Background(), models.Purchase{Product: "Semi Skimmed Milk"})
+	if err != nil {
+		t.Fatalf("Categorize() error = %v", err)
+	}
+	if id != 1 {
+		t.Errorf("Expected milk to be categorized as 1, got %d", id)
+	}
+
+	_, err = NewClassifierCategorizer("missing_model.json")
+	if err == nil {
+		t.Error("Expected an error when the model file does not exist")
+	}
+}
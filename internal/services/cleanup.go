@@ -0,0 +1,246 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"whatAmIBuying/internal/database"
+	"whatAmIBuying/internal/models"
+)
+
+// cleanupPromptVersion identifies the line cleanup prompt in the LLM cache
+const cleanupPromptVersion = "cleanup-v1"
+
+var (
+	// barcodePattern matches the article number printed after some products
+	barcodePattern = regexp.MustCompile(`\s+0\d{6}$`)
+	// trailingMultiplierPattern matches "Demi Baguette 2 x 0.39"
+	trailingMultiplierPattern = regexp.MustCompile(`^(.*?)\s+0*(\d+)\s*[xX]\s*[£f]?(\d+\.\d{2})$`)
+	// leadingMultiplierPattern matches "4 2 x 3.49 Quarter Pounders", where the
+	// first number is OCR noise
+	leadingMultiplierPattern = regexp.MustCompile(`^(?:\d+\s+)?0*(\d+)\s*[xX]\s*[£f]?(\d+\.\d{2})\s+(.+)$`)
+	// sizePattern matches pack sizes such as "350g" that legitimately mix digits and letters
+	sizePattern = regexp.MustCompile(`^\d+(\.\d+)?(g|kg|ml|cl|l|pk)$`)
+)
+
+// lineItemSchema is the JSON schema the LLM must follow when cleaning a line
+const lineItemSchema = `{
+	"type": "object",
+	"properties": {
+		"name": {"type": "string"},
+		"quantity": {"type": "number"},
+		"unit_price": {"type": "number"}
+	},
+	"required": ["name", "quantity", "unit_price"]
+}`
+
+const lineCleanupPrompt = `You clean up product lines read from a supermarket receipt by OCR.
+
+The line may contain OCR mistakes such as digits in place of letters ("App1e" for "Apple"), article numbers, stray numbers and quantity multipliers such as "2 x 0.39".
+
+Line: %q
+Line total: %.2f
+
+Respond ONLY with a JSON object holding the product name as it would appear on the shelf, the quantity bought and the price of a single unit. quantity multiplied by unit_price must equal the line total.`
+
+// CleanLineRules cleans a receipt line with deterministic rules, removing
+// article numbers and splitting off "2 x 0.39" multipliers. The result is
+// only trusted if it contains no words that look like OCR mistakes and its
+// quantity and unit price add up to the line total
+func CleanLineRules(line string, total float64) (models.LineItem, bool) {
+	name := strings.Join(strings.Fields(line), " ")
+	name = barcodePattern.ReplaceAllString(name, "")
+
+	item := models.LineItem{Quantity: 1, UnitPrice: total}
+	if m := trailingMultiplierPattern.FindStringSubmatch(name); m != nil {
+		name = m[1]
+		item.Quantity, _ = strconv.ParseFloat(m[2], 64)
+		item.UnitPrice, _ = strconv.ParseFloat(m[3], 64)
+	} else if m := leadingMultiplierPattern.FindStringSubmatch(name); m != nil {
+		name = m[3]
+		item.Quantity, _ = strconv.ParseFloat(m[1], 64)
+		item.UnitPrice, _ = strconv.ParseFloat(m[2], 64)
+	}
+	item.Name = strings.TrimSpace(name)
+
+	ok := item.Name != "" && !hasSuspiciousWord(item.Name) && addsUp(item, total)
+	return item, ok
+}
+
+// hasSuspiciousWord reports whether a word mixes letters and digits, such as
+// "App1e" or "Ro11", unless it is a pack size
+func hasSuspiciousWord(name string) bool {
+	for _, word := range strings.Fields(name) {
+		hasLetter, hasDigit := false, false
+		for _, r := range word {
+			hasLetter = hasLetter || unicode.IsLetter(r)
+			hasDigit = hasDigit || unicode.IsDigit(r)
+		}
+		if hasLetter && hasDigit && !sizePattern.MatchString(strings.ToLower(word)) {
+			return true
+		}
+	}
+	return false
+}
+
+// addsUp reports whether the quantity and unit price of an item match the
+// line total to the penny
+func addsUp(item models.LineItem, total float64) bool {
+	return item.Quantity > 0 && math.Abs(item.Quantity*item.UnitPrice-total) < 0.005
+}
+
+// LineCleaner cleans receipt lines with CleanLineRules and, if it has a
+// Model, asks an LLM about the lines the rules cannot fix. Answers are cached
+// like categorizations. The zero value cleans with the rules only
+type LineCleaner struct {
+	Model    string
+	Timeout  time.Duration
+	LLMCalls int
+	db       *sql.DB
+}
+
+// NewLineCleaner creates a line cleaner using the given Ollama model
+func NewLineCleaner(db *sql.DB, model string) (*LineCleaner, error) {
+	err := database.CreateLLMCacheTable(db)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LineCleaner{Model: model, db: db}, nil
+}
+
+// newConfiguredLineCleaner creates the line cleaner for the named cleanup,
+// nil if lines are stored as read
+func newConfiguredLineCleaner(ctx context.Context, db *sql.DB, opts ImportOptions) (*LineCleaner, error) {
+	switch opts.Cleanup {
+	case "":
+		return nil, nil
+	case "rules":
+		return &LineCleaner{}, nil
+	case "llm":
+		if opts.Model == "" {
+			opts.Model = DefaultLLMModel
+		}
+		if err := EnsureModel(ctx, opts.Model, opts.Pull, os.Stderr); err != nil {
+			return nil, err
+		}
+		cleaner, err := NewLineCleaner(db, opts.Model)
+		if err != nil {
+			return nil, err
+		}
+		cleaner.Timeout = opts.Timeout
+		return cleaner, nil
+	default:
+		return nil, fmt.Errorf("unknown cleanup %q, expected rules or llm", opts.Cleanup)
+	}
+}
+
+// cleanPurchases replaces the product of every purchase with its cleaned
+// name, quantity and unit price. Lines that cannot be cleaned keep the name
+// the rules gave them
+func (c *LineCleaner) cleanPurchases(ctx context.Context, purchases []models.Purchase) {
+	for i, p := range purchases {
+		item, err := c.Clean(ctx, p.Product, p.PriceFloat)
+		if err != nil {
+			log.Printf("Error cleaning '%s', keeping '%s': %v", p.Product, item.Name, err)
+		}
+		if item.Name != p.Product {
+			fmt.Printf("Cleaned '%s' to '%s' (%g x %.2f)\n", p.Product, item.Name, item.Quantity, item.UnitPrice)
+		}
+		purchases[i].Product = item.Name
+		purchases[i].Quantity = item.Quantity
+		purchases[i].UnitPrice = item.UnitPrice
+	}
+}
+
+// Clean returns the cleaned line item for a receipt line. It fails if the
+// rules cannot fix the line and the LLM gives no answer that adds up, still
+// returning the line as cleaned by the rules
+func (c *LineCleaner) Clean(ctx context.Context, line string, total float64) (models.LineItem, error) {
+	item, ok := CleanLineRules(line, total)
+	if ok || c.Model == "" {
+		return item, nil
+	}
+
+	cleaned, err := c.cleanWithLLM(ctx, line, total)
+	if err != nil {
+		return item, err
+	}
+	return cleaned, nil
+}
+
+// cleanWithLLM asks the LLM about a line the rules could not fix, answering
+// from the cache when it was asked before
+func (c *LineCleaner) cleanWithLLM(ctx context.Context, line string, total float64) (models.LineItem, error) {
+	key := fmt.Sprintf("%s @ %.2f", line, total)
+	response, found, err := database.GetCachedResponse(c.db, c.Model, cleanupPromptVersion, key)
+	if err != nil {
+		return models.LineItem{}, err
+	}
+	if found {
+		if item, err := parseLineItem(response, total); err == nil {
+			err = database.RecordCacheHit(c.db, c.Model, cleanupPromptVersion, key)
+			if err != nil {
+				return models.LineItem{}, err
+			}
+			return item, nil
+		}
+	}
+
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	c.LLMCalls++
+	result, err := callOllamaStreamAt(ctx, OllamaHost, OllamaRequest{
+		Model:  c.Model,
+		Prompt: fmt.Sprintf(lineCleanupPrompt, line, total),
+		Format: json.RawMessage(lineItemSchema),
+	}, nil)
+	if err != nil {
+		return models.LineItem{}, fmt.Errorf("error calling Ollama: %w", err)
+	}
+
+	item, err := parseLineItem(result.Response, total)
+	if err != nil {
+		return models.LineItem{}, err
+	}
+
+	err = database.SaveCachedResponse(c.db, c.Model, cleanupPromptVersion, key, result.Response)
+	if err != nil {
+		return models.LineItem{}, err
+	}
+
+	return item, nil
+}
+
+// parseLineItem reads a line item answered by the LLM and checks that it
+// adds up to the line total
+func parseLineItem(response string, total float64) (models.LineItem, error) {
+	var item models.LineItem
+	err := json.Unmarshal([]byte(strings.TrimSpace(response)), &item)
+	if err != nil {
+		return models.LineItem{}, fmt.Errorf("invalid line item %q: %w", response, err)
+	}
+
+	item.Name = strings.TrimSpace(item.Name)
+	if item.Name == "" {
+		return models.LineItem{}, fmt.Errorf("line item %q has no name", response)
+	}
+	if !addsUp(item, total) {
+		return models.LineItem{}, fmt.Errorf("line item %q does not add up to %.2f", response, total)
+	}
+
+	return item, nil
+}
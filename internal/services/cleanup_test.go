@@ -0,0 +1,124 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestCleanLineRules(t *testing.T) {
+	tests := []struct {
+		line      string
+		total     float64
+		name      string
+		quantity  float64
+		unitPrice float64
+		ok        bool
+	}{
+		{"Iceberg Lettuce 0082031", 0.89, "Iceberg Lettuce", 1, 0.89, true},
+		{"Demi Baguette 2 x 0.39", 0.78, "Demi Baguette", 2, 0.39, true},
+		{"Extra Large Onions 02 x 1.59", 3.18, "Extra Large Onions", 2, 1.59, true},
+		{"Stock Pots Chicken 2 x f0.99", 1.98, "Stock Pots Chicken", 2, 0.99, true},
+		{"4 2 x 3.49 Quarter Pounders", 6.98, "Quarter Pounders", 2, 3.49, true},
+		{"Blueberries 350g 0080826", 2.99, "Blueberries 350g", 1, 2.99, true},
+		{"Mild Cheddar Slices", 2.09, "Mild Cheddar Slices", 1, 2.09, true},
+		// OCR mistakes inside words are left to the LLM
+		{"App1e & Mango Juice", 1.75, "App1e & Mango Juice", 1, 1.75, false},
+		{"Panini Ro11 4 x 0.35", 1.40, "Panini Ro11", 4, 0.35, false},
+		// A multiplier that does not add up to the total is not trusted
+		{"Demi Baguette 3 x 0.39", 0.78, "Demi Baguette", 3, 0.39, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			item, ok := CleanLineRules(tt.line, tt.total)
+			if ok != tt.ok {
+				t.Errorf("CleanLineRules() ok = %v, want %v", ok, tt.ok)
+			}
+			if item.Name != tt.name || item.Quantity != tt.quantity || item.UnitPrice != tt.unitPrice {
+				t.Errorf("CleanLineRules() = %+v, want %s, %g x %.2f", item, tt.name, tt.quantity, tt.unitPrice)
+			}
+		})
+	}
+}
+
+func TestLineCleaner(t *testing.T) {
+	db, cleanup := setupTestDBForServices(t)
+	defer cleanup()
+
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		var req OllamaRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if !strings.Contains(string(req.Format), "unit_price") {
+			t.Errorf("Expected the request to carry the line item schema, got %s", req.Format)
+		}
+
+		response := `{"name": "Apple & Mango Juice", "quantity": 1, "unit_price": 1.75}`
+		if strings.Contains(req.Prompt, "Ro11") {
+			// Does not add up to the line total
+			response = `{"name": "Panini Rolls", "quantity": 1, "unit_price": 0.35}`
+		}
+		json.NewEncoder(w).Encode(OllamaResponse{Response: response, Done: true})
+	}))
+	defer server.Close()
+	previousHost := OllamaHost
+	OllamaHost = server.URL
+	defer func() { OllamaHost = previousHost }()
+
+	cleaner, err := NewLineCleaner(db, "test-model")
+	if err != nil {
+		t.Fatalf("NewLineCleaner() error = %v", err)
+	}
+
+	item, err := cleaner.Clean(context.Background(), "Iceberg Lettuce 0082031", 0.89)
+	if err != nil || item.Name != "Iceberg Lettuce" {
+		t.Errorf("Clean() = %+v, %v", item, err)
+	}
+	if cleaner.LLMCalls != 0 {
+		t.Error("Lines fixed by the rules should not reach the LLM")
+	}
+
+	for i := 0; i < 2; i++ {
+		item, err = cleaner.Clean(context.Background(), "App1e & Mango Juice", 1.75)
+		if err != nil {
+			t.Fatalf("Clean() error = %v", err)
+		}
+		if item.Name != "Apple & Mango Juice" || item.Quantity != 1 || item.UnitPrice != 1.75 {
+			t.Errorf("Clean() = %+v", item)
+		}
+	}
+	if cleaner.LLMCalls != 1 {
+		t.Errorf("Expected the second answer from the cache, got %d LLM calls", cleaner.LLMCalls)
+	}
+
+	item, err = cleaner.Clean(context.Background(), "Panini Ro11 4 x 0.35", 1.40)
+	if err == nil {
+		t.Error("Expected an error for an answer that does not add up")
+	}
+	if item.Name != "Panini Ro11" || item.Quantity != 4 {
+		t.Errorf("Expected the line as cleaned by the rules, got %+v", item)
+	}
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Errorf("Expected 2 requests, got %d", n)
+	}
+}
+
+func TestLineCleanerRulesOnly(t *testing.T) {
+	cleaner := &LineCleaner{}
+
+	item, err := cleaner.Clean(context.Background(), "Demi Baguette 2 x 0.39", 0.78)
+	if err != nil || item.Name != "Demi Baguette" || item.Quantity != 2 || item.UnitPrice != 0.39 {
+		t.Errorf("Clean() = %+v, %v", item, err)
+	}
+
+	item, err = cleaner.Clean(context.Background(), "App1e & Mango Juice", 1.75)
+	if err != nil || item.Name != "App1e & Mango Juice" {
+		t.Errorf("Expected a line the rules cannot fix to be kept without the LLM, got %+v, %v", item, err)
+	}
+}
@@ -0,0 +1,151 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+)
+
+// OllamaErrorKind classifies why a call to the Ollama API failed
+type OllamaErrorKind int
+
+const (
+	// ErrKindConnection means the server could not be reached or dropped the connection
+	ErrKindConnection OllamaErrorKind = iota + 1
+	// ErrKindModelNotFound means the requested model is not installed
+	ErrKindModelNotFound
+	// ErrKindTimeout means the request did not finish before its deadline
+	ErrKindTimeout
+	// ErrKindBadJSON means the server answered with something that is not valid JSON
+	ErrKindBadJSON
+	// ErrKindStatus means the server answered with an unexpected HTTP status or an error message
+	ErrKindStatus
+)
+
+func (k OllamaErrorKind) String() string {
+	switch k {
+	case ErrKindConnection:
+		return "connection failed"
+	case ErrKindModelNotFound:
+		return "model not found"
+	case ErrKindTimeout:
+		return "timeout"
+	case ErrKindBadJSON:
+		return "bad JSON"
+	case ErrKindStatus:
+		return "server error"
+	default:
+		return "unknown error"
+	}
+}
+
+// OllamaError is returned when a call to the Ollama API fails
+type OllamaError struct {
+	Kind       OllamaErrorKind
+	StatusCode int
+	Body       string
+	Err        error
+}
+
+func (e *OllamaError) Error() string {
+	msg := e.Kind.String()
+	if e.StatusCode != 0 {
+		msg += fmt.Sprintf(" (HTTP %d)", e.StatusCode)
+	}
+	if e.Body != "" {
+		msg += ": " + e.Body
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *OllamaError) Unwrap() error {
+	return e.Err
+}
+
+// Transient reports whether the same request may succeed if it is retried,
+// e.g. while the server is starting or still loading the model
+func (e *OllamaError) Transient() bool {
+	switch e.Kind {
+	case ErrKindConnection:
+		return true
+	case ErrKindStatus:
+		return e.StatusCode >= 500 || e.StatusCode == http.StatusTooManyRequests
+	default:
+		return false
+	}
+}
+
+// IsTransient reports whether err is an Ollama error worth retrying
+func IsTransient(err error) bool {
+	var ollamaErr *OllamaError
+	return errors.As(err, &ollamaErr) && ollamaErr.Transient()
+}
+
+// classifyRequestError turns the error of a failed HTTP request to the Ollama
+// server at host into an OllamaError. Cancellation by the caller is returned
+// unchanged
+func classifyRequestError(ctx context.Context, host string, err error) error {
+	if errors.Is(ctx.Err(), context.Canceled) {
+		return fmt.Errorf("request stopped: %w", ctx.Err())
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return &OllamaError{Kind: ErrKindTimeout, Err: ctx.Err()}
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return &OllamaError{Kind: ErrKindTimeout, Err: err}
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return &OllamaError{Kind: ErrKindConnection, Err: fmt.Errorf("is Ollama running at %s? %w", host, err)}
+	}
+
+	return &OllamaError{Kind: ErrKindConnection, Err: err}
+}
+
+// checkResponseStatus returns an OllamaError describing a response with a
+// status other than 200 OK
+func checkResponseStatus(resp *http.Response) error {
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	message := strings.TrimSpace(string(body))
+
+	// Ollama reports errors as {"error": "..."}
+	var errResp struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(body, &errResp) == nil && errResp.Error != "" {
+		message = errResp.Error
+	}
+
+	kind := ErrKindStatus
+	if resp.StatusCode == http.StatusNotFound && strings.Contains(message, "not found") {
+		kind = ErrKindModelNotFound
+	}
+
+	return &OllamaError{Kind: kind, StatusCode: resp.StatusCode, Body: message}
+}
+
+// FailureReason describes in a few words why categorizing a purchase failed
+func FailureReason(err error) string {
+	var ollamaErr *OllamaError
+	if errors.As(err, &ollamaErr) {
+		return ollamaErr.Error()
+	}
+	if errors.Is(err, ErrNoCategoryID) {
+		return "unparseable response"
+	}
+	return err.Error()
+}
@@ -0,0 +1,175 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// callStubbedOllama points OllamaHost at a server running the handler and
+// makes a single streamed generate call
+func callStubbedOllama(t *testing.T, handler http.HandlerFunc) error {
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	previousHost := OllamaHost
+	OllamaHost = server.URL
+	defer func() { OllamaHost = previousHost }()
+
+	_, err := CallOllamaStream(context.Background(), "test-model", "prompt", nil)
+	return err
+}
+
+func TestOllamaErrorClassification(t *testing.T) {
+	tests := []struct {
+		name          string
+		handler       http.HandlerFunc
+		wantKind      OllamaErrorKind
+		wantStatus    int
+		wantTransient bool
+		wantInMessage string
+	}{
+		{
+			name: "Model not found",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNotFound)
+				fmt.Fprint(w, `{"error":"model \"test-model\" not found, try pulling it first"}`)
+			},
+			wantKind:      ErrKindModelNotFound,
+			wantStatus:    404,
+			wantTransient: false,
+			wantInMessage: "try pulling it first",
+		},
+		{
+			name: "Server error",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusInternalServerError)
+				fmt.Fprint(w, "model is still loading")
+			},
+			wantKind:      ErrKindStatus,
+			wantStatus:    500,
+			wantTransient: true,
+			wantInMessage: "model is still loading",
+		},
+		{
+			name: "Bad request",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `{"error":"invalid options"}`)
+			},
+			wantKind:      ErrKindStatus,
+			wantStatus:    400,
+			wantTransient: false,
+			wantInMessage: "invalid options",
+		},
+		{
+			name: "Bad JSON",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, "<html>not json</html>\n")
+			},
+			wantKind:      ErrKindBadJSON,
+			wantTransient: false,
+		},
+		{
+			name: "Error in stream",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, `{"error":"out of memory"}`+"\n")
+			},
+			wantKind:      ErrKindStatus,
+			wantTransient: false,
+			wantInMessage: "out of memory",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := callStubbedOllama(t, tt.handler)
+
+			var ollamaErr *OllamaError
+			if !errors.As(err, &ollamaErr) {
+				t.Fatalf("Expected an OllamaError, got %v", err)
+			}
+			if ollamaErr.Kind != tt.wantKind {
+				t.Errorf("Kind = %v, want %v", ollamaErr.Kind, tt.wantKind)
+			}
+			if ollamaErr.StatusCode != tt.wantStatus {
+				t.Errorf("StatusCode = %d, want %d", ollamaErr.StatusCode, tt.wantStatus)
+			}
+			if ollamaErr.Transient() != tt.wantTransient {
+				t.Errorf("Transient() = %v, want %v", ollamaErr.Transient(), tt.wantTransient)
+			}
+			if !strings.Contains(err.Error(), tt.wantInMessage) {
+				t.Errorf("Expected error %q to contain %q", err.Error(), tt.wantInMessage)
+			}
+		})
+	}
+}
+
+func TestOllamaErrorConnectionRefused(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	url := server.URL
+	server.Close()
+
+	_, err := callOllamaStreamAt(context.Background(), url, OllamaRequest{Model: "test-model", Prompt: "prompt"}, nil)
+
+	var ollamaErr *OllamaError
+	if !errors.As(err, &ollamaErr) || ollamaErr.Kind != ErrKindConnection {
+		t.Fatalf("Expected a connection error, got %v", err)
+	}
+	if !strings.Contains(err.Error(), url) {
+		t.Errorf("Expected the error to name the host called, got %v", err)
+	}
+	if !IsTransient(err) {
+		t.Error("Expected connection errors to be transient")
+	}
+}
+
+func TestOllamaErrorCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := classifyRequestError(ctx, OllamaHost, ctx.Err())
+
+	var ollamaErr *OllamaError
+	if errors.As(err, &ollamaErr) {
+		t.Errorf("Expected cancellation not to be an OllamaError, got %v", err)
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected a context cancelled error, got %v", err)
+	}
+}
+
+func TestFailureReason(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{
+			name:     "Ollama error",
+			err:      fmt.Errorf("error calling Ollama: %w", &OllamaError{Kind: ErrKindTimeout}),
+			expected: "timeout",
+		},
+		{
+			name:     "Parse failure",
+			err:      fmt.Errorf("error parsing LLM response: %w", ErrNoCategoryID),
+			expected: "unparseable response",
+		},
+		{
+			name:     "Other error",
+			err:      errors.New("disk full"),
+			expected: "disk full",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if reason := FailureReason(tt.err); reason != tt.expected {
+				t.Errorf("FailureReason() = %q, want %q", reason, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,372 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"whatAmIBuying/internal/database"
+	"whatAmIBuying/internal/models"
+	"whatAmIBuying/internal/render"
+)
+
+// LabelledPurchase is a purchase with its known correct category
+type LabelledPurchase struct {
+	Purchase   models.Purchase
+	CategoryID int
+	// Label is the category as written in a mappings file, empty for
+	// purchases categorized in the database
+	Label string
+}
+
+// EvalOptions configures what a categorizer is evaluated on
+type EvalOptions struct {
+	// Dataset is "db" for the categorized purchases in the database or the
+	// path of a mappings file
+	Dataset string
+	// Limit is the most purchases evaluated, 0 for all
+	Limit int
+	// TestFraction is the fraction of the categorized purchases in the
+	// database held out of what the categorizer learns from and evaluated
+	TestFraction float64
+	// Seed shuffles the categorized purchases before they are split
+	Seed int64
+	// Format is how the report is written, a table if empty
+	Format render.Format
+}
+
+// EvalResult holds the outcome of running a categorizer over a labelled set
+type EvalResult struct {
+	Total         int
+	Correct       int
+	ParseFailures int
+	Errors        int
+	// Confusion counts predictions per actual category, failed predictions
+	// are counted under predicted category 0
+	Confusion map[int]map[int]int
+	Latencies []time.Duration
+}
+
+// Accuracy is the fraction of purchases categorized correctly, failures
+// count as wrong answers
+func (r EvalResult) Accuracy() float64 {
+	if r.Total == 0 {
+		return 0
+	}
+	return float64(r.Correct) / float64(r.Total)
+}
+
+// ParseFailureRate is the fraction of purchases for which no category ID
+// could be parsed from the LLM response
+func (r EvalResult) ParseFailureRate() float64 {
+	if r.Total == 0 {
+		return 0
+	}
+	return float64(r.ParseFailures) / float64(r.Total)
+}
+
+// LatencyPercentile returns the latency below which the given fraction of
+// categorizations finished
+func (r EvalResult) LatencyPercentile(p float64) time.Duration {
+	if len(r.Latencies) == 0 {
+		return 0
+	}
+
+	sorted := make([]time.Duration, len(r.Latencies))
+	copy(sorted, r.Latencies)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	index := int(p * float64(len(sorted)-1))
+	return sorted[index]
+}
+
+// MeanLatency returns the average time a categorization took
+func (r EvalResult) MeanLatency() time.Duration {
+	if len(r.Latencies) == 0 {
+		return 0
+	}
+
+	var total time.Duration
+	for _, l := range r.Latencies {
+		total += l
+	}
+	return total / time.Duration(len(r.Latencies))
+}
+
+// RunEvaluation categorizes every labelled purchase and compares the result
+// with the label. Cancelling ctx ends the evaluation with the results so far
+func RunEvaluation(ctx context.Context, categorizer Categorizer, dataset []LabelledPurchase) EvalResult {
+	result := EvalResult{Confusion: make(map[int]map[int]int)}
+
+	for _, lp := range dataset {
+		if ctx.Err() != nil {
+			break
+		}
+
+		start := time.Now()
+		id, err := categorizer.Categorize(ctx, lp.Purchase)
+		if ctx.Err() != nil {
+			break
+		}
+		result.Latencies = append(result.Latencies, time.Since(start))
+		result.Total++
+
+		if err != nil {
+			if errors.Is(err, ErrNoCategoryID) {
+				result.ParseFailures++
+			} else {
+				result.Errors++
+			}
+			id = 0
+		}
+
+		if result.Confusion[lp.CategoryID] == nil {
+			result.Confusion[lp.CategoryID] = make(map[int]int)
+		}
+		result.Confusion[lp.CategoryID][id]++
+
+		if id == lp.CategoryID {
+			result.Correct++
+		}
+	}
+
+	return result
+}
+
+// categoryTokens splits a category name into lowercase singular words
+func categoryTokens(name string) []string {
+	var tokens []string
+	for _, word := range strings.FieldsFunc(strings.ToLower(name), func(r rune) bool { return !unicode.IsLetter(r) }) {
+		if word == "and" {
+			continue
+		}
+		tokens = append(tokens, strings.TrimSuffix(word, "s"))
+	}
+	return tokens
+}
+
+// MatchCategory finds the category a free text label refers to, such as
+// "Fruit" for "Fruits" or "Sauces" for "Condiments & Sauces". The last word
+// of the label names what it is, so it must be part of the category: "Fruit
+// juice" is no fruit
+func MatchCategory(label string, categories []models.Category) (int, bool) {
+	for _, c := range categories {
+		if strings.EqualFold(strings.TrimSpace(label), c.Category) {
+			return c.ID, true
+		}
+	}
+
+	labelTokens := categoryTokens(label)
+	if len(labelTokens) == 0 {
+		return 0, false
+	}
+	head := labelTokens[len(labelTokens)-1]
+	bestID, bestShared := 0, 0
+	for _, c := range categories {
+		shared := 0
+		hasHead := false
+		for _, ct := range categoryTokens(c.Category) {
+			hasHead = hasHead || ct == head
+			for _, lt := range labelTokens {
+				if ct == lt {
+					shared++
+				}
+			}
+		}
+		if hasHead && shared > bestShared {
+			bestID, bestShared = c.ID, shared
+		}
+	}
+
+	return bestID, bestShared > 0
+}
+
+// LoadMappingsDataset reads a labelled set in the "Product -> Category"
+// format of mappings.txt, returning the labels that match no category
+func LoadMappingsDataset(path string, categories []models.Category) ([]LabelledPurchase, []string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error opening mappings file: %w", err)
+	}
+	defer file.Close()
+
+	var dataset []LabelledPurchase
+	var unmatched []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		product, label, found := strings.Cut(line, "->")
+		if !found {
+			return nil, nil, fmt.Errorf("invalid mapping line %q", line)
+		}
+		product = strings.TrimSpace(product)
+		label = strings.TrimSpace(label)
+
+		id, ok := MatchCategory(label, categories)
+		if !ok {
+			unmatched = append(unmatched, line)
+			continue
+		}
+
+		dataset = append(dataset, LabelledPurchase{
+			Purchase:   models.Purchase{Product: product},
+			CategoryID: id,
+			Label:      label,
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("error reading mappings file: %w", err)
+	}
+
+	return dataset, unmatched, nil
+}
+
+// splitPurchases shuffles purchases with the given seed and splits them into
+// the ones learned from and the testFraction held out, as classifier.Split
+// does for examples
+func splitPurchases(purchases []models.Purchase, testFraction float64, seed int64) ([]models.Purchase, []models.Purchase) {
+	shuffled := make([]models.Purchase, len(purchases))
+	copy(shuffled, purchases)
+	rand.New(rand.NewSource(seed)).Shuffle(len(shuffled), func(i, j int) {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	})
+
+	testSize := int(math.Round(float64(len(shuffled)) * testFraction))
+	return shuffled[testSize:], shuffled[:testSize]
+}
+
+// EvaluateCategorizer runs the categorizer named in the options over a
+// labelled set and writes a report. Purchases from the database are held out
+// of what the categorizer learns from, so it is not tested on the answers it
+// was given
+func EvaluateCategorizer(ctx context.Context, opts CategorizeOptions, eval EvalOptions) error {
+	db, err := database.OpenDatabase()
+	if err != nil {
+		log.Fatal("Error opening database: ", err)
+	}
+
+	categories := *database.GetAllCategories(db)
+	categoryNames := make(map[int]string)
+	for _, c := range categories {
+		categoryNames[c.ID] = c.Category
+	}
+
+	// Cached responses would score earlier runs instead of this one, and
+	// writing them would leak the labelled set into later categorizations
+	opts.SkipCache = true
+
+	var dataset []LabelledPurchase
+	if eval.Dataset == "db" {
+		if eval.TestFraction <= 0 || eval.TestFraction >= 1 {
+			return fmt.Errorf("test fraction must be between 0 and 1, got %f", eval.TestFraction)
+		}
+		purchases, err := database.GetCategorizedPurchases(db)
+		if err != nil {
+			return fmt.Errorf("getting categorized purchases failed: %w", err)
+		}
+		train, test := splitPurchases(purchases, eval.TestFraction, eval.Seed)
+		opts.Training = train
+		for _, p := range test {
+			dataset = append(dataset, LabelledPurchase{Purchase: p, CategoryID: int(p.CategoryId.Int64)})
+		}
+	} else {
+		var unmatched []string
+		dataset, unmatched, err = LoadMappingsDataset(eval.Dataset, categories)
+		if err != nil {
+			return err
+		}
+		for _, line := range unmatched {
+			fmt.Fprintf(os.Stderr, "Skipping '%s': no matching category\n", line)
+		}
+		reported := make(map[string]bool)
+		for _, lp := range dataset {
+			if !strings.EqualFold(lp.Label, categoryNames[lp.CategoryID]) && !reported[lp.Label] {
+				fmt.Fprintf(os.Stderr, "Matching label '%s' to category '%s'\n", lp.Label, categoryNames[lp.CategoryID])
+				reported[lp.Label] = true
+			}
+		}
+	}
+
+	if eval.Limit > 0 && len(dataset) > eval.Limit {
+		dataset = dataset[:eval.Limit]
+	}
+	if len(dataset) == 0 {
+		return fmt.Errorf("no labelled purchases to evaluate")
+	}
+
+	categorizer, err := NewCategorizer(ctx, db, opts)
+	if err != nil {
+		return err
+	}
+
+	result := RunEvaluation(ctx, categorizer, dataset)
+	if ctx.Err() != nil {
+		fmt.Fprintf(os.Stderr, "\nInterrupted, reporting on the first %d of %d purchases\n", result.Total, len(dataset))
+	}
+	if reporter, ok := categorizer.(statsReporter); ok {
+		fmt.Fprintln(os.Stderr, reporter.Stats())
+	}
+
+	summary := render.NewTable("summary", "Categorizer", "Dataset", "Purchases", "Correct", "Accuracy",
+		"Parse failures", "Parse failure rate", "Errors", "Mean latency", "P50 latency", "P95 latency", "Max latency")
+	summary.AddRow(categorizer.Name(), eval.Dataset, result.Total, result.Correct, render.Fixed(result.Accuracy(), 3),
+		result.ParseFailures, render.Fixed(result.ParseFailureRate(), 3), result.Errors,
+		result.MeanLatency().Round(time.Microsecond),
+		result.LatencyPercentile(0.5).Round(time.Microsecond),
+		result.LatencyPercentile(0.95).Round(time.Microsecond),
+		result.LatencyPercentile(1).Round(time.Microsecond))
+
+	return render.Write(os.Stdout, eval.Format, summary, confusionMatrix(result.Confusion, categoryNames))
+}
+
+// confusionMatrix tabulates actual categories as rows and predicted
+// categories as columns, with failed predictions in the "err" column
+func confusionMatrix(confusion map[int]map[int]int, categoryNames map[int]string) *render.Table {
+	idSet := make(map[int]bool)
+	for actual, predictions := range confusion {
+		idSet[actual] = true
+		for predicted := range predictions {
+			if predicted != 0 {
+				idSet[predicted] = true
+			}
+		}
+	}
+	var ids []int
+	for id := range idSet {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	columns := []string{"Actual"}
+	for _, id := range ids {
+		columns = append(columns, strconv.Itoa(id))
+	}
+	table := render.NewTable("confusion", append(columns, "err")...)
+	table.Title = "Confusion matrix (rows: actual, columns: predicted)"
+
+	for _, actual := range ids {
+		name := categoryNames[actual]
+		if name == "" {
+			name = "Unknown"
+		}
+		row := []any{fmt.Sprintf("[%d] %s", actual, name)}
+		for _, predicted := range ids {
+			row = append(row, confusion[actual][predicted])
+		}
+		table.AddRow(append(row, confusion[actual][0])...)
+	}
+	return table
+}
@@ -0,0 +1,276 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+	"whatAmIBuying/internal/models"
+)
+
+// fakeCategorizer returns canned answers per product name
+type fakeCategorizer struct {
+	answers map[string]int
+	errs    map[string]error
+}
+
+func (f *fakeCategorizer) Name() string {
+	return "fake"
+}
+
+func (f *fakeCategorizer) Categorize(ctx context.Context, purchase models.Purchase) (int, error) {
+	if err, ok := f.errs[purchase.Product]; ok {
+		return 0, err
+	}
+	return f.answers[purchase.Product], nil
+}
+
+var evalCategories = []models.Category{
+	{ID: 1, Category: "Beef"},
+	{ID: 5, Category: "Dairy & Eggs"},
+	{ID: 6, Category: "Fruits"},
+	{ID: 12, Category: "Snacks"},
+	{ID: 15, Category: "Condiments & Sauces"},
+}
+
+func TestMatchCategory(t *testing.T) {
+	tests := []struct {
+		label     string
+		wantID    int
+		wantFound bool
+	}{
+		{label: "Beef", wantID: 1, wantFound: true},
+		{label: "dairy & eggs", wantID: 5, wantFound: true},
+		{label: "Dairy", wantID: 5, wantFound: true},
+		{label: "Fruit", wantID: 6, wantFound: true},
+		{label: "Savoury Snacks", wantID: 12, wantFound: true},
+		{label: "Sauces", wantID: 15, wantFound: true},
+		{label: "Household", wantID: 0, wantFound: false},
+		{label: "Fruit juice", wantID: 0, wantFound: false},
+		{label: "Beef snacks", wantID: 12, wantFound: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.label, func(t *testing.T) {
+			id, found := MatchCategory(tt.label, evalCategories)
+			if found != tt.wantFound || id != tt.wantID {
+				t.Errorf("MatchCategory() = (%d, %v), want (%d, %v)", id, found, tt.wantID, tt.wantFound)
+			}
+		})
+	}
+}
+
+func TestLoadMappingsDataset(t *testing.T) {
+	path := "test_mappings.txt"
+	content := "Beef Steak Mince -> Beef\nMature Cheddar -> Dairy\n\nKitchen Towels -> Household\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	defer os.Remove(path)
+
+	dataset, unmatched, err := LoadMappingsDataset(path, evalCategories)
+	if err != nil {
+		t.Fatalf("LoadMappingsDataset() error = %v", err)
+	}
+
+	if len(dataset) != 2 {
+		t.Fatalf("Expected 2 labelled purchases, got %d", len(dataset))
+	}
+	if dataset[1].Purchase.Product != "Mature Cheddar" || dataset[1].CategoryID != 5 {
+		t.Errorf("Unexpected labelled purchase %+v", dataset[1])
+	}
+	if len(unmatched) != 1 {
+		t.Errorf("Expected 1 unmatched line, got %d", len(unmatched))
+	}
+
+	if err := os.WriteFile(path, []byte("no arrow here\n"), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	_, _, err = LoadMappingsDataset(path, evalCategories)
+	if err == nil {
+		t.Error("Expected an error for a line without an arrow")
+	}
+}
+
+func TestSplitPurchases(t *testing.T) {
+	var purchases []models.Purchase
+	for i := 1; i <= 10; i++ {
+		purchases = append(purchases, models.Purchase{Id: i})
+	}
+
+	train, test := splitPurchases(purchases, 0.2, 1)
+
+	if len(train) != 8 || len(test) != 2 {
+		t.Fatalf("Expected 8 and 2 purchases, got %d and %d", len(train), len(test))
+	}
+	held := make(map[int]bool)
+	for _, p := range test {
+		held[p.Id] = true
+	}
+	for _, p := range train {
+		if held[p.Id] {
+			t.Errorf("Purchase %d is both learned from and held out", p.Id)
+		}
+	}
+
+	again, _ := splitPurchases(purchases, 0.2, 1)
+	if again[0].Id != train[0].Id {
+		t.Error("Expected the same split for the same seed")
+	}
+}
+
+func TestNewCategorizerLearnsOnlyFromTraining(t *testing.T) {
+	db, cleanup := setupTestDBForServices(t)
+	defer cleanup()
+
+	result, _ := db.Exec("INSERT INTO Receipts (date, amount) VALUES (?, ?)", "2025-01-06 10:00:00", "10.00")
+	receiptId, _ := result.LastInsertId()
+	db.Exec("INSERT INTO Purchases (name, price, receiptId, categoryId) VALUES (?, ?, ?, ?)", "Whole Milk", "1.50", receiptId, 1)
+	db.Exec("INSERT INTO Purchases (name, price, receiptId, categoryId) VALUES (?, ?, ?, ?)", "Chicken Breast", "4.00", receiptId, 2)
+
+	training := []models.Purchase{{Product: "Chicken Breast", CategoryId: sql.NullInt64{Int64: 2, Valid: true}}}
+	for _, name := range []string{"history", "classifier"} {
+		t.Run(name, func(t *testing.T) {
+			categorizer, err := NewCategorizer(context.Background(), db, CategorizeOptions{Categorizer: name, Training: training})
+			if err != nil {
+				t.Fatalf("NewCategorizer() error = %v", err)
+			}
+			if id, _ := categorizer.Categorize(context.Background(), models.Purchase{Product: "Chicken Breast"}); id != 2 {
+				t.Errorf("Expected the trained purchase in category 2, got %d", id)
+			}
+			// The history categorizer must not know the held out milk
+			if id, err := categorizer.Categorize(context.Background(), models.Purchase{Product: "Whole Milk"}); name == "history" && err == nil && id == 1 {
+				t.Error("Expected the held out purchase to be unknown")
+			}
+		})
+	}
+}
+
+func TestRunEvaluation(t *testing.T) {
+	categorizer := &fakeCategorizer{
+		answers: map[string]int{"Milk": 5, "Mince": 1, "Crisps": 5},
+		errs: map[string]error{
+			"Apples": fmt.Errorf("error parsing LLM response: %w", ErrNoCategoryID),
+			"Pears":  fmt.Errorf("error calling Ollama: connection refused"),
+		},
+	}
+	dataset := []LabelledPurchase{
+		{Purchase: models.Purchase{Product: "Milk"}, CategoryID: 5},
+		{Purchase: models.Purchase{Product: "Mince"}, CategoryID: 1},
+		{Purchase: models.Purchase{Product: "Crisps"}, CategoryID: 12},
+		{Purchase: models.Purchase{Product: "Apples"}, CategoryID: 6},
+		{Purchase: models.Purchase{Product: "Pears"}, CategoryID: 6},
+	}
+
+	result := RunEvaluation(context.Background(), categorizer, dataset)
+
+	if result.Total != 5 || result.Correct != 2 {
+		t.Errorf("Expected 2/5 correct, got %d/%d", result.Correct, result.Total)
+	}
+	if result.Accuracy() != 0.4 {
+		t.Errorf("Expected accuracy 0.4, got %f", result.Accuracy())
+	}
+	if result.ParseFailures != 1 || result.ParseFailureRate() != 0.2 {
+		t.Errorf("Expected 1 parse failure, got %d", result.ParseFailures)
+	}
+	if result.Errors != 1 {
+		t.Errorf("Expected 1 other error, got %d", result.Errors)
+	}
+	if result.Confusion[12][5] != 1 {
+		t.Error("Expected crisps to be counted as snacks predicted as dairy")
+	}
+	if result.Confusion[6][0] != 2 {
+		t.Error("Expected failed predictions to be counted in the error column")
+	}
+	if len(result.Latencies) != 5 {
+		t.Errorf("Expected 5 latencies, got %d", len(result.Latencies))
+	}
+}
+
+func TestLatencyStatistics(t *testing.T) {
+	result := EvalResult{Latencies: []time.Duration{4 * time.Second, time.Second, 3 * time.Second, 2 * time.Second}}
+
+	if mean := result.MeanLatency(); mean != 2500*time.Millisecond {
+		t.Errorf("MeanLatency() = %v, want 2.5s", mean)
+	}
+	if max := result.LatencyPercentile(1); max != 4*time.Second {
+		t.Errorf("LatencyPercentile(1) = %v, want 4s", max)
+	}
+	if min := result.LatencyPercentile(0); min != time.Second {
+		t.Errorf("LatencyPercentile(0) = %v, want 1s", min)
+	}
+
+	var empty EvalResult
+	if empty.MeanLatency() != 0 || empty.Accuracy() != 0 {
+		t.Error("Expected zero statistics for an empty result")
+	}
+}
+
+func TestHistoryCategorizer(t *testing.T) {
+	db, cleanup := setupTestDBForServices(t)
+	defer cleanup()
+
+	result, _ := db.Exec("INSERT INTO Receipts (date, amount) VALUES (?, ?)", "2025-01-06 10:00:00", "10.00")
+	receiptId, _ := result.LastInsertId()
+	db.Exec("INSERT INTO Purchases (name, price, receiptId, categoryId) VALUES (?, ?, ?, ?)", "Iceberg Lettuce 0082031", "0.89", receiptId, 3)
+	db.Exec("INSERT INTO Purchases (name, price, receiptId, categoryId) VALUES (?, ?, ?, ?)", "Iceberg Lettuce", "0.89", receiptId, 3)
+	db.Exec("INSERT INTO Purchases (name, price, receiptId, categoryId) VALUES (?, ?, ?, ?)", "Iceberg Lettuce", "0.89", receiptId, 1)
+
+	categorizer, err := NewHistoryCategorizer(db)
+	if err != nil {
+		t.Fatalf("NewHistoryCategorizer() error = %v", err)
+	}
+
+	id, err := categorizer.Categorize(context.Background(), models.Purchase{Product: "Iceberg Lettuce 0082999"})
+	if err != nil {
+		t.Fatalf("Categorize() error = %v", err)
+	}
+	if id != 3 {
+		t.Errorf("Expected the most common category 3, got %d", id)
+	}
+
+	_, err = categorizer.Categorize(context.Background(), models.Purchase{Product: "Blueberries"})
+	if err == nil {
+		t.Error("Expected an error for a product never categorized before")
+	}
+
+	categorizer.Learn(context.Background(), models.Purchase{Product: "Blueberries", CategoryId: sql.NullInt64{Int64: 2, Valid: true}})
+	id, _ = categorizer.Categorize(context.Background(), models.Purchase{Product: "Blueberries"})
+	if id != 2 {
+		t.Errorf("Expected learned category 2, got %d", id)
+	}
+}
+
+func TestRulesCategorizer(t *testing.T) {
+	db, cleanup := setupTestDBForServices(t)
+	defer cleanup()
+
+	categorizer := NewRulesCategorizer(db)
+
+	tests := []struct {
+		name    string
+		product string
+		want    int
+		wantErr bool
+	}{
+		{"category name", "Dairy Milk 1L", 1, false},
+		{"plural of the category name", "Meats Platter", 2, false},
+		{"singular of the category name", "Mixed Vegetable", 3, false},
+		{"longest name wins", "Meat with Vegetables", 3, false},
+		{"no category name", "Baguette", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := categorizer.Categorize(context.Background(), models.Purchase{Product: tt.product})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Categorize() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if id != tt.want {
+				t.Errorf("Categorize() = %d, want %d", id, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+	"whatAmIBuying/internal/database"
+	"whatAmIBuying/internal/models"
+	"whatAmIBuying/internal/render"
+)
+
+// ExplainPurchase writes a purchase with its current category and the audit
+// of every LLM categorization of it, newest first, in the given format. The
+// full prompt is only written if showPrompt is set
+func ExplainPurchase(id int, showPrompt bool, format render.Format) error {
+	db, err := database.OpenDatabase()
+	if err != nil {
+		log.Fatal("Error opening database: ", err)
+	}
+
+	err = database.CreateAuditTable(db)
+	if err != nil {
+		return err
+	}
+
+	purchase, err := database.GetPurchaseByID(db, id)
+	if err != nil {
+		return err
+	}
+
+	category := "uncategorized"
+	if purchase.CategoryId.Valid {
+		category, err = database.GetCategoryNameByID(db, int(purchase.CategoryId.Int64))
+		if err != nil {
+			return err
+		}
+	}
+	audits, err := database.GetAuditsForPurchase(db, id)
+	if err != nil {
+		return err
+	}
+	categoryNames := make(map[int]string)
+	for _, a := range audits {
+		name, err := database.GetCategoryNameByID(db, a.CategoryID)
+		if err != nil {
+			name = "unknown"
+		}
+		categoryNames[a.CategoryID] = name
+	}
+
+	// Reasoning and prompts span many lines, which the aligned table format
+	// cannot show, so it gets a text layout of its own
+	if format == "" || format == "table" {
+		printExplanation(purchase, category, audits, categoryNames, showPrompt)
+		return nil
+	}
+
+	summary := render.NewTable("purchase", "ID", "Product", "Price", "Category")
+	summary.AddRow(purchase.Id, purchase.Product, purchase.Price, category)
+
+	columns := []string{"Created", "Model", "Prompt version", "Category ID", "Category", "Cached",
+		"Prompt tokens", "Response tokens", "Duration", "Reasoning", "Response"}
+	if showPrompt {
+		columns = append(columns, "Prompt")
+	}
+	table := render.NewTable("audits", columns...)
+	table.Empty = "No LLM categorizations were recorded for this purchase, assign with -audit to record them."
+	for _, a := range audits {
+		row := []any{a.CreatedAt, a.Model, a.PromptVersion, a.CategoryID, categoryNames[a.CategoryID], a.Cached,
+			a.PromptTokens, a.ResponseTokens, a.Duration, a.Reasoning, RemoveThinkTags(a.RawResponse)}
+		if showPrompt {
+			row = append(row, a.Prompt)
+		}
+		table.AddRow(row...)
+	}
+
+	return render.Write(os.Stdout, format, summary, table)
+}
+
+// printExplanation prints a purchase and the audits of its categorizations
+// as text
+func printExplanation(purchase models.Purchase, category string, audits []models.CategorizationAudit, categoryNames map[int]string, showPrompt bool) {
+	fmt.Printf("Purchase %d: %s bought for %s\n", purchase.Id, purchase.Product, purchase.Price)
+	fmt.Printf("Category: %s\n", category)
+
+	if len(audits) == 0 {
+		fmt.Println("\nNo LLM categorizations were recorded for this purchase, assign with -audit to record them.")
+		return
+	}
+
+	for _, a := range audits {
+		fmt.Printf("\n%s  %s (prompt %s) -> [%d] %s\n", a.CreatedAt, a.Model, a.PromptVersion, a.CategoryID, categoryNames[a.CategoryID])
+		if a.Cached {
+			fmt.Println("Answered from the LLM cache")
+			fmt.Printf("Response: %s\n", a.RawResponse)
+			continue
+		}
+
+		fmt.Printf("Tokens: %d prompt, %d response, took %v\n", a.PromptTokens, a.ResponseTokens, a.Duration.Round(time.Millisecond))
+		if a.Reasoning != "" {
+			fmt.Printf("Reasoning:\n%s\n", indent(a.Reasoning))
+		}
+		fmt.Printf("Response:\n%s\n", indent(RemoveThinkTags(a.RawResponse)))
+		if showPrompt {
+			fmt.Printf("Prompt:\n%s\n", indent(a.Prompt))
+		}
+	}
+}
+
+// indent prefixes every line of text with two spaces
+func indent(text string) string {
+	return "  " + strings.ReplaceAll(strings.TrimSpace(text), "\n", "\n  ")
+}
@@ -0,0 +1,296 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"time"
+	"whatAmIBuying/internal/database"
+	"whatAmIBuying/internal/models"
+	"whatAmIBuying/internal/render"
+)
+
+// uncategorizedName labels spending on purchases without a category
+const uncategorizedName = "Uncategorized"
+
+// seasonalShrinkage is how many average periods a season's own history is
+// blended with, so a season seen once does not swing the forecast
+const seasonalShrinkage = 2.0
+
+// ForecastOptions configures a spending forecast
+type ForecastOptions struct {
+	// Period is "week" or "month"
+	Period string
+	// Periods is how many periods are forecast, starting with the one At is in
+	Periods int
+	// Level is the probability the spending falls in the prediction interval
+	Level float64
+	// At is the time the forecast is made, only spending before its period is
+	// learned from
+	At time.Time
+	// Format is how the forecast is written, a table if empty
+	Format render.Format
+}
+
+// periodStart returns the start of the week, from Monday, or the month t is in
+func periodStart(t time.Time, period string) time.Time {
+	day := truncateToDay(t)
+	if period == "month" {
+		return day.AddDate(0, 0, 1-day.Day())
+	}
+	return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+}
+
+// nextPeriod returns the start of the period after the one starting at start
+func nextPeriod(start time.Time, period string) time.Time {
+	if period == "month" {
+		return start.AddDate(0, 1, 0)
+	}
+	return start.AddDate(0, 0, 7)
+}
+
+// forecastWindow is how many recent periods the level of spending is
+// averaged over
+func forecastWindow(period string) int {
+	if period == "month" {
+		return 6
+	}
+	return 8
+}
+
+// periodKeyLayout keys periods by their first day, as time.Time keys differ
+// for the same instant in different timezones
+const periodKeyLayout = "2006-01-02"
+
+// spendingSeries sums the spending of every period from the first to the
+// last one with spending before end, in total and by category, with periods
+// without spending in between counted as zero. The series stops at the last
+// spending rather than at end, so a history that ended long ago is not
+// padded with periods of no spending
+func spendingSeries(purchases []models.PurchaseRecord, period string, end time.Time, categoryNames map[int]string) ([]time.Time, []float64, map[string][]float64) {
+	var starts []time.Time
+	var totals []float64
+	byCategory := make(map[string][]float64)
+
+	var first, last time.Time
+	for _, p := range purchases {
+		start := periodStart(p.ReceiptDate, period)
+		if !start.Before(end) {
+			continue
+		}
+		if first.IsZero() || start.Format(periodKeyLayout) < first.Format(periodKeyLayout) {
+			first = start
+		}
+		if last.IsZero() || start.Format(periodKeyLayout) > last.Format(periodKeyLayout) {
+			last = start
+		}
+	}
+	if first.IsZero() {
+		return starts, totals, byCategory
+	}
+
+	index := make(map[string]int)
+	for s := first; s.Format(periodKeyLayout) <= last.Format(periodKeyLayout); s = nextPeriod(s, period) {
+		index[s.Format(periodKeyLayout)] = len(starts)
+		starts = append(starts, s)
+		totals = append(totals, 0)
+	}
+
+	for _, p := range purchases {
+		i, ok := index[periodStart(p.ReceiptDate, period).Format(periodKeyLayout)]
+		if !ok {
+			continue
+		}
+
+		name := uncategorizedName
+		if p.Purchase.CategoryId.Valid {
+			name = categoryNames[int(p.Purchase.CategoryId.Int64)]
+		}
+		if byCategory[name] == nil {
+			byCategory[name] = make([]float64, len(starts))
+		}
+		totals[i] += p.Purchase.PriceFloat
+		byCategory[name][i] += p.Purchase.PriceFloat
+	}
+
+	return starts, totals, byCategory
+}
+
+// periodsBetween counts the periods from the one starting at from up to the
+// one starting at to
+func periodsBetween(from time.Time, to time.Time, period string) int {
+	n := 0
+	for s := from; s.Format(periodKeyLayout) < to.Format(periodKeyLayout); s = nextPeriod(s, period) {
+		n++
+	}
+	return n
+}
+
+// seasonOf is the month a period falls in, which drives seasonal spending
+// such as Christmas for weeks and months alike
+func seasonOf(start time.Time) time.Month {
+	return start.Month()
+}
+
+// seasonalFactors returns how much more or less than average is spent in
+// every season, shrunk towards 1 for seasons seen rarely
+func seasonalFactors(starts []time.Time, values []float64) map[time.Month]float64 {
+	mean := 0.0
+	for _, v := range values {
+		mean += v / float64(len(values))
+	}
+
+	sums := make(map[time.Month]float64)
+	counts := make(map[time.Month]float64)
+	for i, start := range starts {
+		sums[seasonOf(start)] += values[i]
+		counts[seasonOf(start)]++
+	}
+
+	// Every period counts as its ratio to the mean, and the shrinkage as
+	// periods at the mean
+	factors := make(map[time.Month]float64)
+	for season, sum := range sums {
+		ratio := counts[season]
+		if mean > 0 {
+			ratio = sum / mean
+		}
+		factors[season] = (ratio + seasonalShrinkage) / (counts[season] + seasonalShrinkage)
+	}
+	return factors
+}
+
+// seasonalFactor returns the factor of a season, 1 for unseen seasons
+func seasonalFactor(factors map[time.Month]float64, start time.Time) float64 {
+	if f, ok := factors[seasonOf(start)]; ok {
+		return f
+	}
+	return 1
+}
+
+// intervalZ returns the number of standard deviations either side of the
+// mean holding the given probability of a normal distribution
+func intervalZ(level float64) float64 {
+	return math.Sqrt2 * math.Erfinv(level)
+}
+
+// forecastSeries forecasts the periods from next on. The level is the mean
+// seasonally adjusted spending of the most recent periods, and the interval
+// comes from how far the history strays from that model
+func forecastSeries(starts []time.Time, values []float64, period string, next time.Time, periods int, level float64) []models.SpendingForecast {
+	if len(values) == 0 {
+		return nil
+	}
+
+	factors := seasonalFactors(starts, values)
+	window := min(len(values), forecastWindow(period))
+	base := 0.0
+	for i := len(values) - window; i < len(values); i++ {
+		base += values[i] / seasonalFactor(factors, starts[i]) / float64(window)
+	}
+
+	variance := 0.0
+	for i, v := range values {
+		residual := v - base*seasonalFactor(factors, starts[i])
+		variance += residual * residual / float64(len(values))
+	}
+	spread := intervalZ(level) * math.Sqrt(variance*(1+1/float64(window)))
+
+	forecasts := make([]models.SpendingForecast, 0, periods)
+	for start, i := next, 0; i < periods; start, i = nextPeriod(start, period), i+1 {
+		forecast := base * seasonalFactor(factors, start)
+		forecasts = append(forecasts, models.SpendingForecast{
+			Start:    start,
+			Forecast: forecast,
+			Low:      max(0, forecast-spread),
+			High:     forecast + spread,
+		})
+	}
+	return forecasts
+}
+
+// sumForecasts adds up forecasts of consecutive periods, widening the
+// interval as independent errors add up
+func sumForecasts(forecasts []models.SpendingForecast) models.SpendingForecast {
+	var sum models.SpendingForecast
+	spread := 0.0
+	for i, f := range forecasts {
+		if i == 0 {
+			sum.Start = f.Start
+		}
+		sum.Forecast += f.Forecast
+		spread += (f.High - f.Forecast) * (f.High - f.Forecast)
+	}
+	spread = math.Sqrt(spread)
+	sum.Low = max(0, sum.Forecast-spread)
+	sum.High = sum.Forecast + spread
+	return sum
+}
+
+// ForecastSpending prints the total spending forecast for the coming periods
+// and the spending by category over all of them
+func ForecastSpending(opts ForecastOptions) error {
+	db, err := database.OpenDatabase()
+	if err != nil {
+		log.Fatal("Error opening database: ", err)
+	}
+
+	if opts.Period != "week" && opts.Period != "month" {
+		return fmt.Errorf("unknown period %q, expected week or month", opts.Period)
+	}
+	if opts.Periods < 1 {
+		return fmt.Errorf("at least one period must be forecast, got %d", opts.Periods)
+	}
+	if opts.Level <= 0 || opts.Level >= 1 {
+		return fmt.Errorf("interval level must be between 0 and 1, got %g", opts.Level)
+	}
+
+	purchases, err := loadPurchaseRecords(db, false)
+	if err != nil {
+		return err
+	}
+	categoryNames := make(map[int]string)
+	for _, c := range *database.GetAllCategories(db) {
+		categoryNames[c.ID] = c.Category
+	}
+
+	next := periodStart(opts.At, opts.Period)
+	starts, totals, byCategory := spendingSeries(purchases, opts.Period, next, categoryNames)
+	if len(starts) == 0 {
+		return fmt.Errorf("no spending before %s to forecast from", next.Format("2006-01-02"))
+	}
+	if gap := periodsBetween(starts[len(starts)-1], next, opts.Period) - 1; gap >= forecastWindow(opts.Period) {
+		fmt.Fprintf(os.Stderr, "Warning: the latest spending is from the %s of %s, %d %ss before the forecast\n",
+			opts.Period, starts[len(starts)-1].Format("2006-01-02"), gap, opts.Period)
+	}
+
+	periods := render.NewTable("periods", "Period", "Forecast", "Low", "High")
+	periods.Title = fmt.Sprintf("Forecast of %sly spending from %d %ss of history (%.0f%% interval)", opts.Period, len(starts), opts.Period, opts.Level*100)
+	for _, f := range forecastSeries(starts, totals, opts.Period, next, opts.Periods, opts.Level) {
+		periods.AddRow(f.Start, f.Forecast, f.Low, f.High)
+	}
+
+	names := make([]string, 0, len(byCategory))
+	sums := make(map[string]models.SpendingForecast)
+	for name, values := range byCategory {
+		names = append(names, name)
+		sums[name] = sumForecasts(forecastSeries(starts, values, opts.Period, next, opts.Periods, opts.Level))
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if sums[names[i]].Forecast != sums[names[j]].Forecast {
+			return sums[names[i]].Forecast > sums[names[j]].Forecast
+		}
+		return names[i] < names[j]
+	})
+
+	categories := render.NewTable("categories", "Category", "Forecast", "Low", "High")
+	categories.Title = fmt.Sprintf("By category over the next %d %ss", opts.Periods, opts.Period)
+	for _, name := range names {
+		f := sums[name]
+		categories.AddRow(name, f.Forecast, f.Low, f.High)
+	}
+
+	return render.Write(os.Stdout, opts.Format, periods, categories)
+}
@@ -0,0 +1,217 @@
+package services
+
+import (
+	"database/sql"
+	"math"
+	"testing"
+	"time"
+	"whatAmIBuying/internal/models"
+)
+
+func TestPeriodStart(t *testing.T) {
+	tests := []struct {
+		name     string
+		t        time.Time
+		period   string
+		expected time.Time
+	}{
+		{"Monday", time.Date(2025, 1, 13, 18, 0, 0, 0, time.UTC), "week", time.Date(2025, 1, 13, 0, 0, 0, 0, time.UTC)},
+		{"Sunday", time.Date(2025, 1, 19, 18, 0, 0, 0, time.UTC), "week", time.Date(2025, 1, 13, 0, 0, 0, 0, time.UTC)},
+		{"Week across new year", time.Date(2025, 1, 1, 9, 0, 0, 0, time.UTC), "week", time.Date(2024, 12, 30, 0, 0, 0, 0, time.UTC)},
+		{"Month", time.Date(2025, 2, 28, 9, 0, 0, 0, time.UTC), "month", time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := periodStart(tt.t, tt.period); !got.Equal(tt.expected) {
+				t.Errorf("periodStart() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestIntervalZ(t *testing.T) {
+	tests := []struct {
+		level    float64
+		expected float64
+	}{
+		{0.8, 1.2816},
+		{0.9, 1.6449},
+		{0.95, 1.9600},
+	}
+
+	for _, tt := range tests {
+		if got := intervalZ(tt.level); math.Abs(got-tt.expected) > 1e-4 {
+			t.Errorf("intervalZ(%v) = %v, want %v", tt.level, got, tt.expected)
+		}
+	}
+}
+
+func TestSpendingSeries(t *testing.T) {
+	record := func(date string, price float64, categoryId int64) models.PurchaseRecord {
+		d, _ := time.Parse("2006-01-02", date)
+		return models.PurchaseRecord{
+			Purchase: models.Purchase{
+				PriceFloat: price,
+				CategoryId: sql.NullInt64{Int64: categoryId, Valid: categoryId != 0},
+			},
+			ReceiptDate: d,
+		}
+	}
+	purchases := []models.PurchaseRecord{
+		record("2025-01-06", 2.50, 1),
+		record("2025-01-08", 1.00, 0),
+		record("2025-01-21", 4.00, 1),
+		// In the week being forecast, so not history
+		record("2025-01-27", 9.00, 1),
+	}
+
+	starts, totals, byCategory := spendingSeries(purchases, "week", time.Date(2025, 1, 27, 0, 0, 0, 0, time.UTC), map[int]string{1: "Dairy"})
+
+	if len(starts) != 3 || !starts[1].Equal(time.Date(2025, 1, 13, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("Expected three weeks from the 6th, got %v", starts)
+	}
+	expected := []float64{3.50, 0, 4.00}
+	for i := range expected {
+		if math.Abs(totals[i]-expected[i]) > 1e-9 {
+			t.Errorf("Week %d total = %v, want %v", i, totals[i], expected[i])
+		}
+	}
+	if byCategory["Dairy"][2] != 4.00 || byCategory[uncategorizedName][0] != 1.00 {
+		t.Errorf("Unexpected spending by category %v", byCategory)
+	}
+}
+
+func TestSpendingSeriesAcrossTimezones(t *testing.T) {
+	// Receipts stored in winter and summer time, as fixed offsets
+	winter := time.FixedZone("+00:00", 0)
+	summer := time.FixedZone("+01:00", 3600)
+	record := func(at time.Time) models.PurchaseRecord {
+		return models.PurchaseRecord{Purchase: models.Purchase{PriceFloat: 10}, ReceiptDate: at}
+	}
+	purchases := []models.PurchaseRecord{
+		record(time.Date(2025, 1, 10, 12, 0, 0, 0, winter)),
+		record(time.Date(2025, 2, 10, 12, 0, 0, 0, winter)),
+		record(time.Date(2025, 4, 10, 12, 0, 0, 0, summer)),
+		record(time.Date(2025, 5, 10, 12, 0, 0, 0, summer)),
+		record(time.Date(2025, 6, 10, 12, 0, 0, 0, summer)),
+	}
+
+	_, totals, _ := spendingSeries(purchases, "month", time.Date(2025, 7, 1, 0, 0, 0, 0, summer), nil)
+
+	expected := []float64{10, 10, 0, 10, 10, 10}
+	if len(totals) != len(expected) {
+		t.Fatalf("Expected %d months, got %v", len(expected), totals)
+	}
+	for i := range expected {
+		if totals[i] != expected[i] {
+			t.Errorf("Monthly totals = %v, want %v", totals, expected)
+			break
+		}
+	}
+}
+
+func TestSpendingSeriesStopsAtLastSpending(t *testing.T) {
+	record := func(at time.Time) models.PurchaseRecord {
+		return models.PurchaseRecord{Purchase: models.Purchase{PriceFloat: 20}, ReceiptDate: at}
+	}
+	// Weekly shopping that stopped more than a year before the forecast
+	var purchases []models.PurchaseRecord
+	for i := 0; i < 10; i++ {
+		purchases = append(purchases, record(time.Date(2025, 1, 6+7*i, 10, 0, 0, 0, time.UTC)))
+	}
+	end := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	starts, totals, _ := spendingSeries(purchases, "week", end, nil)
+
+	if len(starts) != 10 || !starts[9].Equal(time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("Expected the ten weeks with spending, got %v", starts)
+	}
+	forecasts := forecastSeries(starts, totals, "week", end, 1, 0.8)
+	if len(forecasts) != 1 || math.Abs(forecasts[0].Forecast-20) > 1e-9 {
+		t.Errorf("Expected the forecast from the weeks with spending, got %+v", forecasts)
+	}
+	if n := periodsBetween(starts[9], end, "week"); n != 64 {
+		t.Errorf("Expected 64 weeks from the last spending to the forecast, got %d", n)
+	}
+}
+
+func TestForecastSeries(t *testing.T) {
+	monthly := func(from time.Time, n int) []time.Time {
+		starts := make([]time.Time, n)
+		for i := range starts {
+			starts[i] = from.AddDate(0, i, 0)
+		}
+		return starts
+	}
+	jan2024 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("Steady spending", func(t *testing.T) {
+		values := []float64{100, 100, 100, 100}
+		forecasts := forecastSeries(monthly(jan2024, 4), values, "month", jan2024.AddDate(0, 4, 0), 2, 0.8)
+
+		if len(forecasts) != 2 || !forecasts[1].Start.Equal(time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)) {
+			t.Fatalf("Unexpected forecasts %+v", forecasts)
+		}
+		for _, f := range forecasts {
+			if math.Abs(f.Forecast-100) > 1e-9 || f.Low != f.Forecast || f.High != f.Forecast {
+				t.Errorf("Expected exactly 100 without any spread, got %+v", f)
+			}
+		}
+	})
+
+	t.Run("December peak", func(t *testing.T) {
+		// Two years of 100 a month, with 300 every December
+		values := make([]float64, 24)
+		for i := range values {
+			values[i] = 100
+			if i%12 == 11 {
+				values[i] = 300
+			}
+		}
+		next := jan2024.AddDate(2, 0, 0)
+		forecasts := forecastSeries(monthly(jan2024, 24), values, "month", next, 12, 0.8)
+
+		november, december := forecasts[10], forecasts[11]
+		if december.Forecast <= 1.5*november.Forecast {
+			t.Errorf("Expected December well above November, got %.2f and %.2f", december.Forecast, november.Forecast)
+		}
+		if december.Low > december.Forecast || december.High < december.Forecast || december.High == december.Low {
+			t.Errorf("Expected an interval around the forecast, got %+v", december)
+		}
+	})
+
+	t.Run("No history", func(t *testing.T) {
+		if forecasts := forecastSeries(nil, nil, "week", jan2024, 4, 0.8); forecasts != nil {
+			t.Errorf("Expected no forecasts, got %+v", forecasts)
+		}
+	})
+}
+
+func TestSeasonalFactors(t *testing.T) {
+	starts := []time.Time{
+		time.Date(2024, 11, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	factors := seasonalFactors(starts, []float64{50, 150})
+
+	// December is 1.5 times the mean once, blended with two average periods
+	if math.Abs(factors[time.December]-(1.5+2)/3) > 1e-9 || math.Abs(factors[time.November]-(0.5+2)/3) > 1e-9 {
+		t.Errorf("Unexpected seasonal factors %v", factors)
+	}
+	if f := seasonalFactor(factors, time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)); f != 1 {
+		t.Errorf("Expected 1 for an unseen season, got %v", f)
+	}
+}
+
+func TestSumForecasts(t *testing.T) {
+	sum := sumForecasts([]models.SpendingForecast{
+		{Forecast: 10, Low: 7, High: 13},
+		{Forecast: 10, Low: 6, High: 14},
+	})
+
+	if sum.Forecast != 20 || math.Abs(sum.High-25) > 1e-9 || math.Abs(sum.Low-15) > 1e-9 {
+		t.Errorf("Expected 20 with a spread of 5, got %+v", sum)
+	}
+}
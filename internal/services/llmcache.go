@@ -0,0 +1,62 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"whatAmIBuying/internal/database"
+	"whatAmIBuying/internal/render"
+)
+
+// ShowLLMCacheStats writes how many responses are cached per model and
+// prompt version, and how often they were used, in the given format
+func ShowLLMCacheStats(format render.Format) error {
+	db, err := database.OpenDatabase()
+	if err != nil {
+		log.Fatal("Error opening database: ", err)
+	}
+
+	err = database.CreateLLMCacheTable(db)
+	if err != nil {
+		return err
+	}
+
+	stats, err := database.GetLLMCacheStats(db)
+	if err != nil {
+		return err
+	}
+
+	table := render.NewTable("cache", "Model", "Prompt", "Entries", "Hits", "Last used", "Current")
+	table.Empty = "The LLM cache is empty."
+	for _, s := range stats {
+		table.AddRow(s.Model, s.PromptVersion, s.Entries, s.Hits, s.LastUsed, s.PromptVersion == PromptVersion)
+	}
+
+	return render.Write(os.Stdout, format, table)
+}
+
+// ClearLLMCache removes the cached responses of the given model, or of every
+// model if model is empty
+func ClearLLMCache(model string) error {
+	db, err := database.OpenDatabase()
+	if err != nil {
+		log.Fatal("Error opening database: ", err)
+	}
+
+	err = database.CreateLLMCacheTable(db)
+	if err != nil {
+		return err
+	}
+
+	deleted, err := database.DeleteCachedResponses(db, model)
+	if err != nil {
+		return err
+	}
+
+	if model == "" {
+		fmt.Printf("Removed %d cached responses\n", deleted)
+	} else {
+		fmt.Printf("Removed %d cached responses of %s\n", deleted, model)
+	}
+	return nil
+}
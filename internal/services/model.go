@@ -0,0 +1,104 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"whatAmIBuying/internal/classifier"
+	"whatAmIBuying/internal/database"
+	"whatAmIBuying/internal/models"
+	"whatAmIBuying/internal/render"
+)
+
+// purchaseExamples converts categorized purchases into classifier examples
+func purchaseExamples(purchases []models.Purchase) []classifier.Example {
+	examples := make([]classifier.Example, 0, len(purchases))
+	for _, p := range purchases {
+		if !p.CategoryId.Valid {
+			continue
+		}
+		examples = append(examples, classifier.Example{
+			Text:  NormalizeProductName(p.Product),
+			Label: int(p.CategoryId.Int64),
+		})
+	}
+	return examples
+}
+
+// TrainClassifier trains the offline classifier on every categorized
+// purchase and saves it to the given path
+func TrainClassifier(path string) error {
+	db, err := database.OpenDatabase()
+	if err != nil {
+		log.Fatal("Error opening database: ", err)
+	}
+
+	purchases, err := database.GetCategorizedPurchases(db)
+	if err != nil {
+		return fmt.Errorf("getting categorized purchases failed: %w", err)
+	}
+
+	examples := purchaseExamples(purchases)
+	if len(examples) == 0 {
+		return fmt.Errorf("no categorized purchases to train on")
+	}
+
+	model := classifier.Train(examples)
+	err = model.Save(path)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Trained classifier on %d purchases in %d categories, saved to %s\n", len(examples), len(model.Classes), path)
+	return nil
+}
+
+// EvaluateClassifier trains the classifier on part of the categorized
+// purchases and reports how well it does on the held out rest in the given
+// format
+func EvaluateClassifier(testFraction float64, seed int64, format render.Format) error {
+	if testFraction <= 0 || testFraction >= 1 {
+		return fmt.Errorf("test fraction must be between 0 and 1, got %f", testFraction)
+	}
+
+	db, err := database.OpenDatabase()
+	if err != nil {
+		log.Fatal("Error opening database: ", err)
+	}
+
+	purchases, err := database.GetCategorizedPurchases(db)
+	if err != nil {
+		return fmt.Errorf("getting categorized purchases failed: %w", err)
+	}
+
+	train, test := classifier.Split(purchaseExamples(purchases), testFraction, seed)
+	if len(train) == 0 || len(test) == 0 {
+		return fmt.Errorf("not enough categorized purchases to evaluate, got %d", len(purchases))
+	}
+
+	evaluation, err := classifier.Evaluate(classifier.Train(train), test)
+	if err != nil {
+		return err
+	}
+
+	table := render.NewTable("categories", "Category", "Precision", "Recall", "Support")
+	table.Title = fmt.Sprintf("Trained on %d purchases, evaluated on %d, accuracy %.3f", len(train), len(test), evaluation.Accuracy)
+
+	var categoryIDs []int
+	for id := range evaluation.PerClass {
+		categoryIDs = append(categoryIDs, id)
+	}
+	sort.Ints(categoryIDs)
+
+	for _, id := range categoryIDs {
+		metrics := evaluation.PerClass[id]
+		name, err := database.GetCategoryNameByID(db, id)
+		if err != nil {
+			name = fmt.Sprintf("Category %d", id)
+		}
+		table.AddRow(name, render.Fixed(metrics.Precision, 3), render.Fixed(metrics.Recall, 3), metrics.Support)
+	}
+
+	return render.Write(os.Stdout, format, table)
+}
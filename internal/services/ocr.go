@@ -0,0 +1,314 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"whatAmIBuying/internal/imaging"
+)
+
+// OCRLine is a line of text read from an image
+type OCRLine struct {
+	Text string
+	Box  image.Rectangle
+	// Confidence is how sure the engine is about the text, from 0 to 1
+	Confidence float64
+}
+
+// OCREngine reads the lines of text in an image
+type OCREngine interface {
+	Name() string
+	Recognize(ctx context.Context, imagePath string) ([]OCRLine, error)
+}
+
+// TesseractEngine reads images with a locally installed tesseract binary
+type TesseractEngine struct {
+	// Command is the tesseract binary, "tesseract" from the PATH if empty
+	Command string
+	// Language is the tesseract language, "eng" if empty
+	Language string
+	// Preprocess crops, straightens and sharpens the photo before reading it
+	Preprocess bool
+}
+
+func (e *TesseractEngine) Name() string {
+	return "tesseract"
+}
+
+func (e *TesseractEngine) Recognize(ctx context.Context, imagePath string) ([]OCRLine, error) {
+	command := e.Command
+	if command == "" {
+		command = "tesseract"
+	}
+	language := e.Language
+	if language == "" {
+		language = "eng"
+	}
+
+	if _, err := exec.LookPath(command); err != nil {
+		return nil, fmt.Errorf("tesseract is not installed, install it or use another OCR engine: %w", err)
+	}
+
+	if e.Preprocess {
+		prepared, err := preprocessForOCR(imagePath)
+		if err != nil {
+			return nil, err
+		}
+		defer os.Remove(prepared)
+		imagePath = prepared
+	}
+
+	// Page segmentation mode 4 reads a single column of text of varying
+	// sizes, which is what a till receipt is
+	cmd := exec.CommandContext(ctx, command, imagePath, "stdout", "-l", language, "--psm", "4", "tsv")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("tesseract failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return ParseTesseractTSV(bytes.NewReader(output))
+}
+
+// preprocessForOCR writes a preprocessed copy of a photo to a temporary file
+// and returns its path
+func preprocessForOCR(imagePath string) (string, error) {
+	img, err := imaging.Load(imagePath)
+	if err != nil {
+		return "", err
+	}
+
+	file, err := os.CreateTemp("", "receipt-*.png")
+	if err != nil {
+		return "", fmt.Errorf("error creating temporary image: %w", err)
+	}
+	file.Close()
+
+	err = imaging.SavePNG(file.Name(), imaging.Preprocess(img))
+	if err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+
+	return file.Name(), nil
+}
+
+// tesseractLineKey identifies a line in tesseract's layout hierarchy
+type tesseractLineKey struct {
+	page, block, paragraph, line int
+}
+
+// ParseTesseractTSV reads the TSV output of tesseract, joining the words of
+// every line. The confidence of a line is the mean confidence of its words
+func ParseTesseractTSV(r io.Reader) ([]OCRLine, error) {
+	type lineWords struct {
+		words      []string
+		box        image.Rectangle
+		confidence float64
+	}
+
+	lines := make(map[tesseractLineKey]*lineWords)
+	var order []tesseractLineKey
+
+	scanner := bufio.NewScanner(r)
+	header := true
+	for scanner.Scan() {
+		if header {
+			header = false
+			continue
+		}
+
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) < 12 {
+			continue
+		}
+
+		numbers := make([]int, 10)
+		for i := range numbers {
+			n, err := strconv.Atoi(fields[i])
+			if err != nil {
+				return nil, fmt.Errorf("invalid tesseract TSV line %q: %w", scanner.Text(), err)
+			}
+			numbers[i] = n
+		}
+		level := numbers[0]
+		text := strings.TrimSpace(strings.Join(fields[11:], "\t"))
+		// Level 5 rows are words, the other levels describe the layout
+		if level != 5 || text == "" {
+			continue
+		}
+		confidence, err := strconv.ParseFloat(fields[10], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tesseract confidence %q: %w", fields[10], err)
+		}
+
+		key := tesseractLineKey{page: numbers[1], block: numbers[2], paragraph: numbers[3], line: numbers[4]}
+		box := image.Rect(numbers[6], numbers[7], numbers[6]+numbers[8], numbers[7]+numbers[9])
+		l, ok := lines[key]
+		if !ok {
+			l = &lineWords{box: box}
+			lines[key] = l
+			order = append(order, key)
+		}
+		l.words = append(l.words, text)
+		l.box = l.box.Union(box)
+		l.confidence += confidence / 100
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading tesseract output: %w", err)
+	}
+
+	result := make([]OCRLine, 0, len(order))
+	for _, key := range order {
+		l := lines[key]
+		result = append(result, OCRLine{
+			Text:       strings.Join(l.words, " "),
+			Box:        l.box,
+			Confidence: l.confidence / float64(len(l.words)),
+		})
+	}
+	return result, nil
+}
+
+// PaddleOCRDump reads the result of PaddleOCR saved as JSON by
+// read_image_text.py instead of running OCR itself
+type PaddleOCRDump struct {
+	// Path is the JSON dump, the image path with a .json extension if empty
+	Path string
+}
+
+func (e *PaddleOCRDump) Name() string {
+	return "paddle"
+}
+
+func (e *PaddleOCRDump) Recognize(ctx context.Context, imagePath string) ([]OCRLine, error) {
+	path := e.Path
+	if path == "" {
+		path = strings.TrimSuffix(imagePath, filepath.Ext(imagePath)) + ".json"
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading PaddleOCR dump: %w", err)
+	}
+
+	return ParsePaddleOCRJSON(content)
+}
+
+// ParsePaddleOCRJSON reads the result of PaddleOCR's ocr() call: a list of
+// pages, each a list of [box, [text, confidence]] pairs where the box is the
+// four corners of the text
+func ParsePaddleOCRJSON(content []byte) ([]OCRLine, error) {
+	var pages [][][2]json.RawMessage
+	err := json.Unmarshal(content, &pages)
+	if err != nil {
+		return nil, fmt.Errorf("invalid PaddleOCR dump: %w", err)
+	}
+
+	var lines []OCRLine
+	for _, page := range pages {
+		for _, entry := range page {
+			var corners [][2]float64
+			if err := json.Unmarshal(entry[0], &corners); err != nil {
+				return nil, fmt.Errorf("invalid PaddleOCR box %s: %w", entry[0], err)
+			}
+			var recognized [2]json.RawMessage
+			if err := json.Unmarshal(entry[1], &recognized); err != nil {
+				return nil, fmt.Errorf("invalid PaddleOCR text %s: %w", entry[1], err)
+			}
+
+			var line OCRLine
+			if err := json.Unmarshal(recognized[0], &line.Text); err != nil {
+				return nil, fmt.Errorf("invalid PaddleOCR text %s: %w", recognized[0], err)
+			}
+			if err := json.Unmarshal(recognized[1], &line.Confidence); err != nil {
+				return nil, fmt.Errorf("invalid PaddleOCR confidence %s: %w", recognized[1], err)
+			}
+			line.Box = boundingBox(corners)
+			lines = append(lines, line)
+		}
+	}
+
+	return lines, nil
+}
+
+// boundingBox returns the smallest rectangle holding all corners
+func boundingBox(corners [][2]float64) image.Rectangle {
+	if len(corners) == 0 {
+		return image.Rectangle{}
+	}
+
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for _, c := range corners {
+		minX, maxX = math.Min(minX, c[0]), math.Max(maxX, c[0])
+		minY, maxY = math.Min(minY, c[1]), math.Max(maxY, c[1])
+	}
+	return image.Rect(int(math.Floor(minX)), int(math.Floor(minY)), int(math.Ceil(maxX)), int(math.Ceil(maxY)))
+}
+
+// GroupOCRRows joins lines that sit side by side, such as a product name and
+// its price read as separate boxes, into rows ordered from top to bottom
+func GroupOCRRows(lines []OCRLine) []OCRLine {
+	sorted := make([]OCRLine, len(lines))
+	copy(sorted, lines)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Box.Min.Y+sorted[i].Box.Max.Y < sorted[j].Box.Min.Y+sorted[j].Box.Max.Y
+	})
+
+	var rows [][]OCRLine
+	for _, line := range sorted {
+		n := len(rows)
+		// Lines whose vertical centre lies within the last row belong to it
+		centre := (line.Box.Min.Y + line.Box.Max.Y) / 2
+		if n > 0 {
+			last := rows[n-1][0].Box
+			if centre >= last.Min.Y && centre < last.Max.Y {
+				rows[n-1] = append(rows[n-1], line)
+				continue
+			}
+		}
+		rows = append(rows, []OCRLine{line})
+	}
+
+	grouped := make([]OCRLine, 0, len(rows))
+	for _, row := range rows {
+		sort.SliceStable(row, func(i, j int) bool { return row[i].Box.Min.X < row[j].Box.Min.X })
+
+		joined := OCRLine{Box: row[0].Box}
+		var texts []string
+		for _, l := range row {
+			texts = append(texts, l.Text)
+			joined.Box = joined.Box.Union(l.Box)
+			joined.Confidence += l.Confidence / float64(len(row))
+		}
+		joined.Text = strings.Join(texts, " ")
+		grouped = append(grouped, joined)
+	}
+	return grouped
+}
+
+// NewOCREngine creates the OCR engine with the given name. dump is the
+// PaddleOCR JSON dump, next to the image if empty
+func NewOCREngine(name string, dump string) (OCREngine, error) {
+	switch name {
+	case "tesseract":
+		return &TesseractEngine{Preprocess: true}, nil
+	case "paddle":
+		return &PaddleOCRDump{Path: dump}, nil
+	default:
+		return nil, fmt.Errorf("unknown OCR engine %q, expected tesseract or paddle", name)
+	}
+}
@@ -0,0 +1,164 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"whatAmIBuying/internal/database"
+	"whatAmIBuying/internal/dates"
+	"whatAmIBuying/internal/models"
+)
+
+var (
+	// linePricePattern matches the price at the end of a receipt row, followed
+	// by the VAT code Lidl prints next to it, as in "Kitchen Towels 2.99 B"
+	linePricePattern = regexp.MustCompile(`^(.*?)\s*(-?)[£f]?(\d+\.\d{2})(?:\s+[A-Z*])?$`)
+	// ocrDatePattern matches a receipt date such as 26/01/25
+	ocrDatePattern = regexp.MustCompile(`\b\d{2}[/.]\d{2}[/.](?:\d{4}|\d{2})\b`)
+	// ocrTimePattern matches a receipt time such as 12:02:57
+	ocrTimePattern = regexp.MustCompile(`\b\d{2}:\d{2}(?::\d{2})?\b`)
+	// quantityPattern matches what is left of a row holding only a quantity
+	// and a price, as in "2 x 0.39 0.78"
+	quantityPattern = regexp.MustCompile(`^(?:\d+(?:\.\d+)?\s*(?:x|X|@|kg)?\s*)*(?:\d+\.\d{2})?$`)
+)
+
+// ParseOCRReceipt builds a receipt from rows of text read off a receipt
+// photo. Rows ending in a price before the TOTAL row are products, rows with
+// only a price belong to the product named on the row above
+func ParseOCRReceipt(rows []OCRLine) (models.Receipt, error) {
+	var receipt models.Receipt
+	var date, clock string
+	pending := ""
+	totalFound := false
+
+	for _, row := range rows {
+		text := strings.TrimSpace(row.Text)
+		if date == "" {
+			date = ocrDatePattern.FindString(text)
+		}
+		if clock == "" {
+			clock = ocrTimePattern.FindString(text)
+		}
+		// A date such as 26.01.25 would otherwise read as a price
+		if totalFound || text == "" || ocrDatePattern.MatchString(text) {
+			continue
+		}
+
+		m := linePricePattern.FindStringSubmatch(text)
+		if m == nil {
+			pending = text
+			continue
+		}
+		name, negative, price := strings.TrimSpace(m[1]), m[2] == "-", m[3]
+
+		if strings.HasPrefix(strings.ToUpper(name), "TOTAL") {
+			receipt.Amount = price
+			totalFound = true
+			continue
+		}
+		if quantityPattern.MatchString(name) {
+			// A price or "2 x 0.39" line under the product it belongs to
+			if pending == "" {
+				continue
+			}
+			name = strings.TrimSpace(pending + " " + name)
+		}
+		pending = ""
+		// Discounts are taken off the total but are not purchases
+		if negative {
+			continue
+		}
+
+		value, _ := strconv.ParseFloat(price, 64)
+		receipt.Purchases = append(receipt.Purchases, models.Purchase{Product: name, Price: price, PriceFloat: value})
+	}
+
+	if len(receipt.Purchases) == 0 {
+		return models.Receipt{}, fmt.Errorf("no products found on the receipt")
+	}
+	if date == "" {
+		return models.Receipt{}, fmt.Errorf("no date found on the receipt")
+	}
+
+	parsed, err := dates.Parse(date+" "+clock, database.ReceiptLocation)
+	if err != nil {
+		return models.Receipt{}, err
+	}
+	receipt.Date = parsed.Format(dates.DatabaseLayout)
+
+	if receipt.Amount == "" {
+		receipt.Amount = fmt.Sprintf("%.2f", receiptItemsTotal(receipt))
+	}
+
+	return receipt, nil
+}
+
+// OCRImportOptions configures how a receipt photo is imported with OCR
+type OCRImportOptions struct {
+	// Engine is the name of the OCR engine
+	Engine string
+	// Dump is the PaddleOCR JSON dump read by the paddle engine
+	Dump string
+	// Store is the store the receipt is from
+	Store string
+	// Cleanup is how product lines are cleaned, as in ImportOptions
+	Cleanup string
+	// Model is the Ollama model used for LLM cleanup, DefaultLLMModel if empty
+	Model string
+	// Pull downloads a missing Ollama model instead of refusing to start
+	Pull bool
+	// Timeout limits how long a single LLM request may take, 0 for no limit
+	Timeout time.Duration
+}
+
+// ImportReceiptWithOCR reads a receipt photo with an OCR engine and adds the
+// receipt and its purchases to the database
+func ImportReceiptWithOCR(ctx context.Context, opts OCRImportOptions, imagePath string) error {
+	db, err := database.OpenDatabase()
+	if err != nil {
+		log.Fatal("Error opening database: ", err)
+	}
+
+	engine, err := NewOCREngine(opts.Engine, opts.Dump)
+	if err != nil {
+		return err
+	}
+
+	cleaner, err := newConfiguredLineCleaner(ctx, db, ImportOptions{Cleanup: opts.Cleanup, Model: opts.Model, Pull: opts.Pull, Timeout: opts.Timeout})
+	if err != nil {
+		return err
+	}
+
+	lines, err := engine.Recognize(ctx, imagePath)
+	if err != nil {
+		return err
+	}
+
+	receipt, err := ParseOCRReceipt(GroupOCRRows(lines))
+	if err != nil {
+		return fmt.Errorf("reading the receipt from %d lines of text failed: %w", len(lines), err)
+	}
+	receipt.Store = opts.Store
+
+	if cleaner != nil {
+		cleaner.cleanPurchases(ctx, receipt.Purchases)
+	}
+
+	fmt.Printf("%s read with %s\n", receipt.Date, engine.Name())
+	for _, p := range receipt.Purchases {
+		fmt.Printf("  %-40s %8s\n", p.Product, p.Price)
+	}
+	fmt.Printf("  %-40s %8s\n", "Total", receipt.Amount)
+
+	id, err := database.AddReceipt(receipt, db)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Added receipt with id %d\n", id)
+	return nil
+}
@@ -0,0 +1,187 @@
+package services
+
+import (
+	"context"
+	"image"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+const sampleTesseractTSV = "level\tpage_num\tblock_num\tpar_num\tline_num\tword_num\tleft\ttop\twidth\theight\tconf\ttext\n" +
+	"1\t1\t0\t0\t0\t0\t0\t0\t400\t300\t-1\t\n" +
+	"4\t1\t1\t1\t1\t0\t10\t20\t300\t18\t-1\t\n" +
+	"5\t1\t1\t1\t1\t1\t10\t20\t60\t18\t96.5\tGreek\n" +
+	"5\t1\t1\t1\t1\t2\t80\t21\t70\t17\t93.5\tYogurt\n" +
+	"5\t1\t1\t1\t1\t3\t280\t20\t30\t18\t90\t1.65\n" +
+	"5\t1\t1\t1\t2\t1\t10\t50\t60\t18\t88\tTOTAL\n" +
+	"5\t1\t1\t1\t2\t2\t280\t50\t30\t18\t92\t1.65\n"
+
+func TestParseTesseractTSV(t *testing.T) {
+	lines, err := ParseTesseractTSV(strings.NewReader(sampleTesseractTSV))
+	if err != nil {
+		t.Fatalf("ParseTesseractTSV() error = %v", err)
+	}
+
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines, got %d", len(lines))
+	}
+	if lines[0].Text != "Greek Yogurt 1.65" || lines[1].Text != "TOTAL 1.65" {
+		t.Errorf("Unexpected lines %q and %q", lines[0].Text, lines[1].Text)
+	}
+	if lines[0].Box != image.Rect(10, 20, 310, 38) {
+		t.Errorf("Expected the box of all words, got %v", lines[0].Box)
+	}
+	if c := lines[0].Confidence; c < 0.933 || c > 0.934 {
+		t.Errorf("Expected the mean word confidence, got %f", c)
+	}
+
+	if _, err := ParseTesseractTSV(strings.NewReader("header\n5\t1\tx\t1\t1\t1\t0\t0\t1\t1\t90\tword\n")); err == nil {
+		t.Error("Expected an error for an invalid TSV line")
+	}
+}
+
+func TestParsePaddleOCRJSON(t *testing.T) {
+	dump := `[[
+		[[[10.0, 20.0], [120.5, 20.0], [120.5, 38.2], [10.0, 38.2]], ["Greek Yogurt", 0.98]],
+		[[[280.0, 21.0], [310.0, 21.0], [310.0, 37.0], [280.0, 37.0]], ["1.65", 0.95]]
+	]]`
+
+	lines, err := ParsePaddleOCRJSON([]byte(dump))
+	if err != nil {
+		t.Fatalf("ParsePaddleOCRJSON() error = %v", err)
+	}
+
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines, got %d", len(lines))
+	}
+	if lines[0].Text != "Greek Yogurt" || lines[0].Confidence != 0.98 {
+		t.Errorf("Unexpected line %+v", lines[0])
+	}
+	if lines[0].Box != image.Rect(10, 20, 121, 39) {
+		t.Errorf("Expected the box around the corners, got %v", lines[0].Box)
+	}
+
+	if _, err := ParsePaddleOCRJSON([]byte(`{"text": "Greek Yogurt"}`)); err == nil {
+		t.Error("Expected an error for an invalid dump")
+	}
+}
+
+func TestGroupOCRRows(t *testing.T) {
+	lines := []OCRLine{
+		{Text: "1.65 B", Box: image.Rect(280, 21, 310, 37), Confidence: 0.9},
+		{Text: "TOTAL", Box: image.Rect(10, 50, 60, 68), Confidence: 1},
+		{Text: "Greek Yogurt", Box: image.Rect(10, 20, 120, 38), Confidence: 0.8},
+	}
+
+	rows := GroupOCRRows(lines)
+
+	if len(rows) != 2 {
+		t.Fatalf("Expected 2 rows, got %v", rows)
+	}
+	if rows[0].Text != "Greek Yogurt 1.65 B" || rows[1].Text != "TOTAL" {
+		t.Errorf("Unexpected rows %q and %q", rows[0].Text, rows[1].Text)
+	}
+	if rows[0].Box != image.Rect(10, 20, 310, 38) {
+		t.Errorf("Expected the box of the whole row, got %v", rows[0].Box)
+	}
+}
+
+func TestParseOCRReceipt(t *testing.T) {
+	var rows []OCRLine
+	for _, text := range []string{
+		"LIDL",
+		"Greek Natural Yogurt 1.65 B",
+		"Bananas",
+		"2 x 0.39 0.78 B",
+		"Lidl Plus discount -0.30",
+		"Kitchen Towels 2.99 A",
+		"TOTAL 5.12",
+		"CARD 5.12",
+		"26/01/25 12:02:57",
+	} {
+		rows = append(rows, OCRLine{Text: text})
+	}
+
+	receipt, err := ParseOCRReceipt(rows)
+	if err != nil {
+		t.Fatalf("ParseOCRReceipt() error = %v", err)
+	}
+
+	if receipt.Date != "2025-01-26 12:02:57" || receipt.Amount != "5.12" {
+		t.Errorf("Unexpected date %q or amount %q", receipt.Date, receipt.Amount)
+	}
+	expected := []string{"Greek Natural Yogurt", "Bananas 2 x 0.39", "Kitchen Towels"}
+	if len(receipt.Purchases) != len(expected) {
+		t.Fatalf("Expected %d purchases, got %+v", len(expected), receipt.Purchases)
+	}
+	for i, product := range expected {
+		if receipt.Purchases[i].Product != product {
+			t.Errorf("Purchase %d = %q, want %q", i, receipt.Purchases[i].Product, product)
+		}
+	}
+	if p := receipt.Purchases[1]; p.Price != "0.78" || p.PriceFloat != 0.78 {
+		t.Errorf("Unexpected price for %+v", p)
+	}
+}
+
+func TestParseOCRReceiptErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		rows []string
+	}{
+		{"No products", []string{"LIDL", "26/01/25 12:02"}},
+		{"No date", []string{"Milk 1.10 B", "TOTAL 1.10"}},
+		{"Invalid date", []string{"Milk 1.10 B", "31/02/25"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rows []OCRLine
+			for _, text := range tt.rows {
+				rows = append(rows, OCRLine{Text: text})
+			}
+			if _, err := ParseOCRReceipt(rows); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
+
+func TestTesseractEngine(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("The fake tesseract is a shell script")
+	}
+
+	command := "./test_fake_tesseract.sh"
+	script := "#!/bin/sh\ncat <<'EOF'\n" + sampleTesseractTSV + "EOF\n"
+	os.WriteFile(command, []byte(script), 0755)
+	defer os.Remove(command)
+
+	engine := &TesseractEngine{Command: command}
+	lines, err := engine.Recognize(context.Background(), "receipt.png")
+	if err != nil {
+		t.Fatalf("Recognize() error = %v", err)
+	}
+	if len(lines) != 2 || lines[1].Text != "TOTAL 1.65" {
+		t.Errorf("Unexpected lines %+v", lines)
+	}
+
+	engine = &TesseractEngine{Command: "./test_missing_tesseract"}
+	if _, err := engine.Recognize(context.Background(), "receipt.png"); err == nil {
+		t.Error("Expected an error when tesseract is not installed")
+	}
+}
+
+func TestNewOCREngine(t *testing.T) {
+	if _, err := NewOCREngine("tesseract", ""); err != nil {
+		t.Errorf("NewOCREngine(tesseract) error = %v", err)
+	}
+	if engine, err := NewOCREngine("paddle", "dump.json"); err != nil || engine.Name() != "paddle" {
+		t.Errorf("NewOCREngine(paddle) = %v, %v", engine, err)
+	}
+	if _, err := NewOCREngine("easyocr", ""); err == nil {
+		t.Error("Expected an error for an unknown engine")
+	}
+}
@@ -1,14 +1,30 @@
 package services
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
+)
+
+// OllamaHost is the base URL of the Ollama server
+var OllamaHost = "http://localhost:11434"
+
+const (
+	// DefaultLLMModel is the generative model used for categorization
+	DefaultLLMModel = "deepseek-r1:7b"
+	// DefaultEmbeddingModel is the model used to embed product names
+	DefaultEmbeddingModel = "nomic-embed-text"
+	// DefaultVisionModel is the multimodal model used to read receipt photos
+	DefaultVisionModel = "llava"
 )
 
 // OllamaRequest represents the request structure for Ollama API
@@ -16,6 +32,10 @@ type OllamaRequest struct {
 	Model  string `json:"model"`
 	Prompt string `json:"prompt"`
 	Stream bool   `json:"stream"`
+	// Format is a JSON schema the response must follow, if set
+	Format json.RawMessage `json:"format,omitempty"`
+	// Images are base64 encoded images for multimodal models
+	Images []string `json:"images,omitempty"`
 }
 
 // OllamaResponse represents the response from Ollama API
@@ -32,54 +52,228 @@ type OllamaResponse struct {
 	PromptEvalDuration int64  `json:"prompt_eval_duration,omitempty"`
 	EvalCount          int    `json:"eval_count,omitempty"`
 	EvalDuration       int64  `json:"eval_duration,omitempty"`
+	Error              string `json:"error,omitempty"`
 }
 
-// CallOllama sends a prompt to your local Ollama instance
+// CallOllama sends a prompt to your local Ollama instance and returns the
+// whole response once it is complete, without <think> blocks
 func CallOllama(modelName string, prompt string) (string, error) {
-	// Create request payload
-	reqBody := OllamaRequest{
-		Model:  modelName,
-		Prompt: prompt,
-		Stream: false,
+	result, err := callOllamaStreamAt(context.Background(), OllamaHost, OllamaRequest{Model: modelName, Prompt: prompt}, nil)
+	if err != nil {
+		return "", err
 	}
+	return result.Response, nil
+}
+
+// OllamaResult is a complete streamed response from the generate API
+type OllamaResult struct {
+	// Response is the answer with <think> blocks removed
+	Response string
+	// Raw is the response exactly as the model produced it
+	Raw string
+	// Reasoning is the content of the <think> blocks
+	Reasoning string
+	// Final is the last chunk, which carries the token counts and durations
+	Final OllamaResponse
+}
+
+// CallOllamaStream sends a prompt to Ollama and reads the response as it is
+// generated, calling onChunk for every chunk received. The request is aborted
+// when ctx is cancelled or its deadline passes
+func CallOllamaStream(ctx context.Context, modelName string, prompt string, onChunk func(OllamaResponse)) (OllamaResult, error) {
+	return callOllamaStreamAt(ctx, OllamaHost, OllamaRequest{Model: modelName, Prompt: prompt}, onChunk)
+}
+
+// callOllamaStreamAt sends a generate request to the Ollama server at host
+// and reads the streamed response
+func callOllamaStreamAt(ctx context.Context, host string, reqBody OllamaRequest, onChunk func(OllamaResponse)) (OllamaResult, error) {
+	reqBody.Stream = true
 
 	jsonData, err := json.Marshal(reqBody)
 	if err != nil {
-		return "", fmt.Errorf("error marshaling request: %w", err)
+		return OllamaResult{}, fmt.Errorf("error marshaling request: %w", err)
 	}
 
-	// Send request to Ollama API
-	resp, err := http.Post("http://localhost:11434/api/generate",
-		"application/json",
-		bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, host+"/api/generate", bytes.NewBuffer(jsonData))
 	if err != nil {
-		return "", fmt.Errorf("error calling Ollama API: %w", err)
+		return OllamaResult{}, fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return OllamaResult{}, classifyRequestError(ctx, host, err)
 	}
 	defer resp.Body.Close()
 
-	// Read response
+	if err := checkResponseStatus(resp); err != nil {
+		return OllamaResult{}, err
+	}
+
+	// Every line of the body is a JSON object holding the next piece of the response
+	var assembled strings.Builder
+	var final OllamaResponse
+	done := false
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var chunk OllamaResponse
+		if err := json.Unmarshal(line, &chunk); err != nil {
+			return OllamaResult{}, &OllamaError{Kind: ErrKindBadJSON, Body: string(line), Err: err}
+		}
+		if chunk.Error != "" {
+			return OllamaResult{}, &OllamaError{Kind: ErrKindStatus, Body: chunk.Error}
+		}
+
+		assembled.WriteString(chunk.Response)
+		if onChunk != nil {
+			onChunk(chunk)
+		}
+		if chunk.Done {
+			final = chunk
+			done = true
+			break
+		}
+	}
+
+	if ctx.Err() != nil {
+		return OllamaResult{}, classifyRequestError(ctx, host, ctx.Err())
+	}
+	if err := scanner.Err(); err != nil {
+		return OllamaResult{}, &OllamaError{Kind: ErrKindConnection, Err: err}
+	}
+	if !done {
+		return OllamaResult{}, &OllamaError{Kind: ErrKindConnection, Err: fmt.Errorf("response ended before the model finished")}
+	}
+
+	raw := assembled.String()
+	return OllamaResult{
+		Response:  RemoveThinkTags(raw),
+		Raw:       raw,
+		Reasoning: ExtractThinkContent(raw),
+		Final:     final,
+	}, nil
+}
+
+// StreamProgress keeps a single status line up to date while a response is
+// streamed in
+type StreamProgress struct {
+	w        io.Writer
+	label    string
+	start    time.Time
+	chunks   int
+	thinking bool
+}
+
+// NewStreamProgress creates a progress line for the given label, such as the
+// name of the purchase being categorized
+func NewStreamProgress(w io.Writer, label string) *StreamProgress {
+	return &StreamProgress{w: w, label: label, start: time.Now()}
+}
+
+// Update records a received chunk and redraws the progress line
+func (p *StreamProgress) Update(chunk OllamaResponse) {
+	p.chunks++
+	if strings.Contains(chunk.Response, "<think>") {
+		p.thinking = true
+	}
+	if strings.Contains(chunk.Response, "</think>") {
+		p.thinking = false
+	}
+
+	state := "answering"
+	if p.thinking {
+		state = "thinking"
+	}
+	fmt.Fprintf(p.w, "\r\033[K%s: %s, %d tokens, %s", p.label, state, p.chunks, time.Since(p.start).Round(time.Second))
+}
+
+// Finish clears the progress line
+func (p *StreamProgress) Finish() {
+	fmt.Fprint(p.w, "\r\033[K")
+}
+
+// OllamaEmbeddingRequest represents the request structure for the Ollama embeddings API
+type OllamaEmbeddingRequest struct {
+	Model  string `json:"model"`
+	Prompt string `json:"prompt"`
+}
+
+// OllamaEmbeddingResponse represents the response from the Ollama embeddings API
+type OllamaEmbeddingResponse struct {
+	Embedding []float64 `json:"embedding"`
+}
+
+// GetOllamaEmbedding returns the embedding vector of the given text
+func GetOllamaEmbedding(ctx context.Context, modelName string, text string) ([]float64, error) {
+	return getOllamaEmbeddingAt(ctx, OllamaHost, modelName, text)
+}
+
+// getOllamaEmbeddingAt is GetOllamaEmbedding for the Ollama server at host
+func getOllamaEmbeddingAt(ctx context.Context, host string, modelName string, text string) ([]float64, error) {
+	jsonData, err := json.Marshal(OllamaEmbeddingRequest{Model: modelName, Prompt: text})
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, host+"/api/embeddings", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, classifyRequestError(ctx, host, err)
+	}
+	defer resp.Body.Close()
+
+	if err := checkResponseStatus(resp); err != nil {
+		return nil, err
+	}
+
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", fmt.Errorf("error reading response: %w", err)
+		return nil, &OllamaError{Kind: ErrKindConnection, Err: err}
 	}
 
-	// Parse response
-	var ollamaResp OllamaResponse
-	if err := json.Unmarshal(body, &ollamaResp); err != nil {
-		// Try to clean the response if it's malformed
-		cleanBody := bytes.TrimSpace(body)
-		if len(cleanBody) > 0 {
-			if err := json.Unmarshal(cleanBody, &ollamaResp); err != nil {
-				return "", fmt.Errorf("error unmarshaling response: %w", err)
-			}
-		} else {
-			return "", fmt.Errorf("error unmarshaling response: %w", err)
-		}
+	var embeddingResp OllamaEmbeddingResponse
+	if err := json.Unmarshal(body, &embeddingResp); err != nil {
+		return nil, &OllamaError{Kind: ErrKindBadJSON, Err: err}
+	}
+	if len(embeddingResp.Embedding) == 0 {
+		return nil, fmt.Errorf("empty embedding returned for %q", text)
 	}
 
-	response := RemoveThinkTags(ollamaResp.Response)
+	return embeddingResp.Embedding, nil
+}
 
-	return response, nil
+// ExtractThinkContent returns the content of the <think> tags in the
+// response, which RemoveThinkTags throws away
+func ExtractThinkContent(response string) string {
+	var parts []string
+	for {
+		start := strings.Index(response, "<think>")
+		if start == -1 {
+			break
+		}
+		response = response[start+len("<think>"):]
+
+		end := strings.Index(response, "</think>")
+		if end == -1 {
+			parts = append(parts, strings.TrimSpace(response))
+			break
+		}
+		parts = append(parts, strings.TrimSpace(response[:end]))
+		response = response[end+len("</think>"):]
+	}
+
+	return strings.TrimSpace(strings.Join(parts, "\n\n"))
 }
 
 // RemoveThinkTagContent removes content inside <think> tags from the response
@@ -107,6 +301,9 @@ func RemoveThinkTags(response string) string {
 	return response
 }
 
+// ErrNoCategoryID is returned when no category ID can be found in an LLM response
+var ErrNoCategoryID = errors.New("could not extract a valid category ID from response")
+
 // ParseLLMResponse attempts to parse the LLM response into a structured format
 func ParseLLMResponse(response string) (int, error) {
 	// First try: standard JSON parsing
@@ -170,5 +367,5 @@ func ParseLLMResponse(response string) (int, error) {
 		}
 	}
 
-	return 0, fmt.Errorf("could not extract a valid category ID from response: %s", response)
+	return 0, fmt.Errorf("%w: %s", ErrNoCategoryID, response)
 }
@@ -0,0 +1,226 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"whatAmIBuying/internal/render"
+)
+
+// OllamaModel describes a model installed on the Ollama server
+type OllamaModel struct {
+	Name       string `json:"name"`
+	Size       int64  `json:"size"`
+	ModifiedAt string `json:"modified_at"`
+}
+
+// OllamaTagsResponse represents the response from the Ollama tags API
+type OllamaTagsResponse struct {
+	Models []OllamaModel `json:"models"`
+}
+
+// OllamaPullRequest represents the request structure for the Ollama pull API
+type OllamaPullRequest struct {
+	Model  string `json:"model"`
+	Stream bool   `json:"stream"`
+}
+
+// OllamaPullProgress is one progress update streamed by the Ollama pull API
+type OllamaPullProgress struct {
+	Status    string `json:"status"`
+	Digest    string `json:"digest,omitempty"`
+	Total     int64  `json:"total,omitempty"`
+	Completed int64  `json:"completed,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// ListOllamaModels returns the models installed on the Ollama server
+func ListOllamaModels(ctx context.Context) ([]OllamaModel, error) {
+	return listOllamaModelsAt(ctx, OllamaHost)
+}
+
+// listOllamaModelsAt is ListOllamaModels for the Ollama server at host
+func listOllamaModelsAt(ctx context.Context, host string) ([]OllamaModel, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, host+"/api/tags", nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, classifyRequestError(ctx, host, err)
+	}
+	defer resp.Body.Close()
+
+	if err := checkResponseStatus(resp); err != nil {
+		return nil, err
+	}
+
+	var tags OllamaTagsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tags); err != nil {
+		return nil, &OllamaError{Kind: ErrKindBadJSON, Err: err}
+	}
+
+	return tags.Models, nil
+}
+
+// HasModel reports whether the model is in the list, treating a name without
+// a tag as the "latest" tag the way Ollama does
+func HasModel(models []OllamaModel, name string) bool {
+	for _, m := range models {
+		if m.Name == name || m.Name == name+":latest" {
+			return true
+		}
+	}
+	return false
+}
+
+// PullOllamaModel downloads a model to the Ollama server, calling onProgress
+// for every progress update
+func PullOllamaModel(ctx context.Context, name string, onProgress func(OllamaPullProgress)) error {
+	return pullOllamaModelAt(ctx, OllamaHost, name, onProgress)
+}
+
+// pullOllamaModelAt is PullOllamaModel for the Ollama server at host
+func pullOllamaModelAt(ctx context.Context, host string, name string, onProgress func(OllamaPullProgress)) error {
+	jsonData, err := json.Marshal(OllamaPullRequest{Model: name, Stream: true})
+	if err != nil {
+		return fmt.Errorf("error marshaling request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, host+"/api/pull", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return classifyRequestError(ctx, host, err)
+	}
+	defer resp.Body.Close()
+
+	if err := checkResponseStatus(resp); err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var progress OllamaPullProgress
+		if err := json.Unmarshal(line, &progress); err != nil {
+			return &OllamaError{Kind: ErrKindBadJSON, Body: string(line), Err: err}
+		}
+		if progress.Error != "" {
+			return &OllamaError{Kind: ErrKindStatus, Body: progress.Error}
+		}
+		if onProgress != nil {
+			onProgress(progress)
+		}
+		if progress.Status == "success" {
+			return nil
+		}
+	}
+
+	if ctx.Err() != nil {
+		return classifyRequestError(ctx, host, ctx.Err())
+	}
+	if err := scanner.Err(); err != nil {
+		return &OllamaError{Kind: ErrKindConnection, Err: err}
+	}
+	return &OllamaError{Kind: ErrKindConnection, Err: fmt.Errorf("pull of %s ended before it succeeded", name)}
+}
+
+// printPullProgress returns a pull progress callback keeping a single status
+// line up to date
+func printPullProgress(w io.Writer, name string) func(OllamaPullProgress) {
+	return func(p OllamaPullProgress) {
+		if p.Total > 0 {
+			fmt.Fprintf(w, "\r\033[KPulling %s: %s %.1f%%", name, p.Status, 100*float64(p.Completed)/float64(p.Total))
+		} else {
+			fmt.Fprintf(w, "\r\033[KPulling %s: %s", name, p.Status)
+		}
+		if p.Status == "success" {
+			fmt.Fprintln(w)
+		}
+	}
+}
+
+// EnsureModel checks that the Ollama server is reachable and has the model
+// installed, pulling it first if pull is set. Progress and the list of
+// available models are written to w
+func EnsureModel(ctx context.Context, name string, pull bool, w io.Writer) error {
+	return ensureModelAt(ctx, OllamaHost, name, pull, w)
+}
+
+// ensureModelAt is EnsureModel for the Ollama server at host
+func ensureModelAt(ctx context.Context, host string, name string, pull bool, w io.Writer) error {
+	models, err := listOllamaModelsAt(ctx, host)
+	if err != nil {
+		return fmt.Errorf("Ollama is not reachable at %s, start it with 'ollama serve': %w", host, err)
+	}
+
+	if HasModel(models, name) {
+		return nil
+	}
+
+	var names []string
+	for _, m := range models {
+		names = append(names, m.Name)
+	}
+	available := "none"
+	if len(names) > 0 {
+		available = strings.Join(names, ", ")
+	}
+
+	if !pull {
+		return fmt.Errorf("model %s is not installed at %s (available: %s), run with -pull or 'models pull %s'", name, host, available, name)
+	}
+
+	fmt.Fprintf(w, "Model %s is not installed at %s (available: %s), pulling it\n", name, host, available)
+	err = pullOllamaModelAt(ctx, host, name, printPullProgress(w, name))
+	if err != nil {
+		return fmt.Errorf("pulling %s failed: %w", name, err)
+	}
+
+	return nil
+}
+
+// ListModels writes the models installed on the Ollama server in the given
+// format, marking the ones used by default
+func ListModels(ctx context.Context, format render.Format) error {
+	models, err := ListOllamaModels(ctx)
+	if err != nil {
+		return fmt.Errorf("Ollama is not reachable at %s: %w", OllamaHost, err)
+	}
+
+	table := render.NewTable("models", "Model", "Size GB", "Default")
+	table.Empty = "No models installed."
+	for _, m := range models {
+		isDefault := m.Name == DefaultLLMModel || m.Name == DefaultEmbeddingModel+":latest" || m.Name == DefaultEmbeddingModel
+		table.AddRow(m.Name, render.Fixed(float64(m.Size)/1e9, 1), isDefault)
+	}
+
+	for _, name := range []string{DefaultLLMModel, DefaultEmbeddingModel} {
+		if !HasModel(models, name) {
+			fmt.Fprintf(os.Stderr, "Default model %s is not installed, run 'models pull %s'\n", name, name)
+		}
+	}
+
+	return render.Write(os.Stdout, format, table)
+}
+
+// PullModel downloads a model to the Ollama server, showing progress
+func PullModel(ctx context.Context, name string) error {
+	return PullOllamaModel(ctx, name, printPullProgress(os.Stdout, name))
+}
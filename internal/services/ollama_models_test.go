@@ -0,0 +1,157 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// startModelsStub starts a fake Ollama server with the given models installed,
+// which can pull any model
+func startModelsStub(t *testing.T, installed []string) (*[]string, func()) {
+	models := append([]string{}, installed...)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/tags":
+			var parts []string
+			for _, m := range models {
+				parts = append(parts, fmt.Sprintf(`{"name":%q,"size":4683087332}`, m))
+			}
+			fmt.Fprintf(w, `{"models":[%s]}`, strings.Join(parts, ","))
+		case "/api/pull":
+			fmt.Fprintln(w, `{"status":"pulling manifest"}`)
+			fmt.Fprintln(w, `{"status":"downloading","digest":"sha256:abc","total":100,"completed":50}`)
+			fmt.Fprintln(w, `{"status":"success"}`)
+			models = append(models, "pulled-model:latest")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	previousHost := OllamaHost
+	OllamaHost = server.URL
+	return &models, func() {
+		OllamaHost = previousHost
+		server.Close()
+	}
+}
+
+func TestHasModel(t *testing.T) {
+	models := []OllamaModel{{Name: "deepseek-r1:7b"}, {Name: "nomic-embed-text:latest"}}
+
+	tests := []struct {
+		name     string
+		expected bool
+	}{
+		{name: "deepseek-r1:7b", expected: true},
+		{name: "deepseek-r1:14b", expected: false},
+		{name: "nomic-embed-text", expected: true},
+		{name: "llava", expected: false},
+	}
+
+	for _, tt := range tests {
+		if HasModel(models, tt.name) != tt.expected {
+			t.Errorf("HasModel(%q) = %v, want %v", tt.name, !tt.expected, tt.expected)
+		}
+	}
+}
+
+func TestListOllamaModels(t *testing.T) {
+	_, stop := startModelsStub(t, []string{"deepseek-r1:7b", "llava:latest"})
+	defer stop()
+
+	models, err := ListOllamaModels(context.Background())
+	if err != nil {
+		t.Fatalf("ListOllamaModels() error = %v", err)
+	}
+	if len(models) != 2 || models[0].Name != "deepseek-r1:7b" || models[0].Size != 4683087332 {
+		t.Errorf("Unexpected models %+v", models)
+	}
+}
+
+func TestPullOllamaModel(t *testing.T) {
+	_, stop := startModelsStub(t, nil)
+	defer stop()
+
+	var statuses []string
+	err := PullOllamaModel(context.Background(), "pulled-model", func(p OllamaPullProgress) {
+		statuses = append(statuses, p.Status)
+	})
+	if err != nil {
+		t.Fatalf("PullOllamaModel() error = %v", err)
+	}
+	if len(statuses) != 3 || statuses[2] != "success" {
+		t.Errorf("Unexpected progress updates %v", statuses)
+	}
+}
+
+func TestPullOllamaModelError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"status":"pulling manifest"}`)
+		fmt.Fprintln(w, `{"error":"pull model manifest: file does not exist"}`)
+	}))
+	defer server.Close()
+	previousHost := OllamaHost
+	OllamaHost = server.URL
+	defer func() { OllamaHost = previousHost }()
+
+	err := PullOllamaModel(context.Background(), "no-such-model", nil)
+	if err == nil || !strings.Contains(err.Error(), "file does not exist") {
+		t.Errorf("Expected the pull error to be reported, got %v", err)
+	}
+}
+
+func TestEnsureModel(t *testing.T) {
+	models, stop := startModelsStub(t, []string{"deepseek-r1:7b"})
+	defer stop()
+
+	var out bytes.Buffer
+	if err := EnsureModel(context.Background(), "deepseek-r1:7b", false, &out); err != nil {
+		t.Errorf("EnsureModel() error = %v for an installed model", err)
+	}
+
+	err := EnsureModel(context.Background(), "pulled-model", false, &out)
+	if err == nil {
+		t.Fatal("Expected an error for a missing model without pull")
+	}
+	if !strings.Contains(err.Error(), "available: deepseek-r1:7b") {
+		t.Errorf("Expected the available models in the error, got %v", err)
+	}
+
+	err = EnsureModel(context.Background(), "pulled-model", true, &out)
+	if err != nil {
+		t.Fatalf("EnsureModel() with pull error = %v", err)
+	}
+	if !HasModel(modelsFromNames(*models), "pulled-model") {
+		t.Error("Expected the model to be pulled")
+	}
+	if !strings.Contains(out.String(), "Pulling pulled-model: downloading 50.0%") {
+		t.Errorf("Expected pull progress output, got %q", out.String())
+	}
+}
+
+func TestEnsureModelUnreachable(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	url := server.URL
+	server.Close()
+	previousHost := OllamaHost
+	OllamaHost = url
+	defer func() { OllamaHost = previousHost }()
+
+	err := EnsureModel(context.Background(), "deepseek-r1:7b", true, &bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), "not reachable") {
+		t.Errorf("Expected an unreachable server error, got %v", err)
+	}
+}
+
+func modelsFromNames(names []string) []OllamaModel {
+	var models []OllamaModel
+	for _, n := range names {
+		models = append(models, OllamaModel{Name: n})
+	}
+	return models
+}
@@ -1,7 +1,15 @@
 package services
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestRemoveThinkTags(t *testing.T) {
@@ -47,6 +55,44 @@ func TestRemoveThinkTags(t *testing.T) {
 	}
 }
 
+func TestExtractThinkContent(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "No think tags",
+			input:    "This is a simple response",
+			expected: "",
+		},
+		{
+			name:     "Think tags present",
+			input:    "<think>\nSome reasoning here\n</think>This is the answer",
+			expected: "Some reasoning here",
+		},
+		{
+			name:     "Unclosed think tag",
+			input:    "<think>Reasoning without closing tag",
+			expected: "Reasoning without closing tag",
+		},
+		{
+			name:     "Multiple think tags",
+			input:    "<think>First</think>Answer<think>Second</think>",
+			expected: "First\n\nSecond",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := ExtractThinkContent(tt.input)
+			if result != tt.expected {
+				t.Errorf("ExtractThinkContent() = %q, want %q", result, tt.expected)
+			}
+		})
+	}
+}
+
 func TestParseLLMResponse(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -172,3 +218,120 @@ func TestParseLLMResponseEdgeCases(t *testing.T) {
 		})
 	}
 }
+
+// streamChunks writes the given pieces of a response as NDJSON chunks, the
+// last one marked as done if finish is set
+func streamChunks(w http.ResponseWriter, pieces []string, finish bool) {
+	for i, piece := range pieces {
+		done := finish && i == len(pieces)-1
+		fmt.Fprintf(w, "{\"model\":\"test\",\"response\":%q,\"done\":%t}\n", piece, done)
+		w.(http.Flusher).Flush()
+	}
+}
+
+func TestCallOllamaStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		streamChunks(w, []string{"<think>", "It is milk", "</think>", "{\"ID\"", ": 5}"}, true)
+	}))
+	defer server.Close()
+	previousHost := OllamaHost
+	OllamaHost = server.URL
+	defer func() { OllamaHost = previousHost }()
+
+	chunks := 0
+	response, err := CallOllamaStream(context.Background(), "test", "prompt", func(OllamaResponse) { chunks++ })
+	if err != nil {
+		t.Fatalf("CallOllamaStream() error = %v", err)
+	}
+
+	if response.Response != `{"ID": 5}` {
+		t.Errorf("CallOllamaStream() = %q, want think block removed", response.Response)
+	}
+	if response.Reasoning != "It is milk" {
+		t.Errorf("Expected reasoning 'It is milk', got %q", response.Reasoning)
+	}
+	if response.Raw != `<think>It is milk</think>{"ID": 5}` {
+		t.Errorf("Expected the raw response to be kept, got %q", response.Raw)
+	}
+	if chunks != 5 {
+		t.Errorf("Expected 5 chunks, got %d", chunks)
+	}
+}
+
+func TestCallOllama(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		streamChunks(w, []string{"<think>", "It is milk", "</think>", "{\"ID\"", ": 5}"}, true)
+	}))
+	defer server.Close()
+	previousHost := OllamaHost
+	OllamaHost = server.URL
+	defer func() { OllamaHost = previousHost }()
+
+	response, err := CallOllama("test", "prompt")
+	if err != nil {
+		t.Fatalf("CallOllama() error = %v", err)
+	}
+	if response != `{"ID": 5}` {
+		t.Errorf("CallOllama() = %q, want the collected response without the think block", response)
+	}
+}
+
+func TestCallOllamaStreamIncomplete(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		streamChunks(w, []string{"<think>", "still thinking"}, false)
+	}))
+	defer server.Close()
+	previousHost := OllamaHost
+	OllamaHost = server.URL
+	defer func() { OllamaHost = previousHost }()
+
+	_, err := CallOllamaStream(context.Background(), "test", "prompt", nil)
+	if err == nil {
+		t.Error("Expected an error when the stream ends before the model is done")
+	}
+}
+
+func TestCallOllamaStreamDeadline(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		streamChunks(w, []string{"<think>"}, false)
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+	previousHost := OllamaHost
+	OllamaHost = server.URL
+	defer func() { OllamaHost = previousHost }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := CallOllamaStream(ctx, "test", "prompt", nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected a deadline exceeded error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected the request to stop at the deadline, took %v", elapsed)
+	}
+}
+
+func TestStreamProgress(t *testing.T) {
+	var out bytes.Buffer
+	progress := NewStreamProgress(&out, "Milk")
+
+	progress.Update(OllamaResponse{Response: "<think>"})
+	if !strings.Contains(out.String(), "Milk: thinking, 1 tokens") {
+		t.Errorf("Expected thinking progress, got %q", out.String())
+	}
+
+	progress.Update(OllamaResponse{Response: "</think>"})
+	progress.Update(OllamaResponse{Response: "{"})
+	if !strings.Contains(out.String(), "Milk: answering, 3 tokens") {
+		t.Errorf("Expected answering progress, got %q", out.String())
+	}
+
+	out.Reset()
+	progress.Finish()
+	if strings.Contains(out.String(), "Milk") {
+		t.Errorf("Expected Finish to clear the line, got %q", out.String())
+	}
+}
@@ -0,0 +1,100 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"whatAmIBuying/internal/models"
+)
+
+// categorizeResult is the outcome of categorizing a single purchase
+type categorizeResult struct {
+	purchase models.Purchase
+	id       int
+	err      error
+	// write makes the database writes of a deferredCategorizer
+	write func() error
+	// audit records the categorization once its category is assigned, nil
+	// if it is not audited
+	audit func() error
+}
+
+// categorizeConcurrently categorizes purchases with up to workers requests in
+// flight and calls handle with every result in the order of purchases. handle
+// and the writes of a deferredCategorizer run on the calling goroutine, so
+// the workers only read from the database. Once ctx is cancelled no new
+// purchases are started, while purchases already being categorized are
+// finished and handled
+func categorizeConcurrently(ctx context.Context, categorizer Categorizer, purchases []models.Purchase, workers int, handle func(categorizeResult)) {
+	if workers < 1 {
+		workers = 1
+	}
+
+	type indexedResult struct {
+		index  int
+		result categorizeResult
+	}
+
+	// Requests in flight run on a context that is not cancelled with ctx, so
+	// an interrupt does not throw away work that is nearly done
+	workCtx := context.WithoutCancel(ctx)
+
+	jobs := make(chan int)
+	results := make(chan indexedResult, workers)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				result := categorizeResult{purchase: purchases[i]}
+				if deferred, ok := categorizer.(deferredCategorizer); ok {
+					var writes deferredWrites
+					result.id, writes, result.err = deferred.categorizeDeferred(workCtx, purchases[i])
+					result.write, result.audit = writes.cache, writes.audit
+				} else {
+					result.id, result.err = categorizer.Categorize(workCtx, purchases[i])
+				}
+				results <- indexedResult{index: i, result: result}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(jobs)
+		for i := range purchases {
+			select {
+			case <-ctx.Done():
+				fmt.Println("Interrupted, finishing the purchases in progress, press Ctrl-C again to quit")
+				return
+			case jobs <- i:
+			}
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// Purchases are handed out in order, so the results received always form
+	// a gapless sequence once the slower ones arrive
+	pending := make(map[int]categorizeResult)
+	next := 0
+	for r := range results {
+		pending[r.index] = r.result
+		for {
+			result, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+			if result.err == nil && result.write != nil {
+				result.err = result.write()
+			}
+			handle(result)
+		}
+	}
+}
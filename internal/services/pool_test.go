@@ -0,0 +1,218 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+	"whatAmIBuying/internal/models"
+)
+
+// slowCategorizer answers with the purchase ID after a delay given per
+// product, keeping track of how many calls run at the same time
+type slowCategorizer struct {
+	delays    map[string]time.Duration
+	running   int32
+	maxActive int32
+}
+
+func (s *slowCategorizer) Name() string {
+	return "slow"
+}
+
+func (s *slowCategorizer) Categorize(ctx context.Context, purchase models.Purchase) (int, error) {
+	active := atomic.AddInt32(&s.running, 1)
+	defer atomic.AddInt32(&s.running, -1)
+	for {
+		max := atomic.LoadInt32(&s.maxActive)
+		if active <= max || atomic.CompareAndSwapInt32(&s.maxActive, max, active) {
+			break
+		}
+	}
+
+	time.Sleep(s.delays[purchase.Product])
+	return purchase.Id, nil
+}
+
+func TestCategorizeConcurrentlyKeepsOrder(t *testing.T) {
+	categorizer := &slowCategorizer{delays: make(map[string]time.Duration)}
+	var purchases []models.Purchase
+	for i := 1; i <= 8; i++ {
+		product := fmt.Sprintf("product %d", i)
+		// Earlier purchases take longer, so they finish out of order
+		categorizer.delays[product] = time.Duration(9-i) * 5 * time.Millisecond
+		purchases = append(purchases, models.Purchase{Id: i, Product: product})
+	}
+
+	var handled []int
+	categorizeConcurrently(context.Background(), categorizer, purchases, 3, func(r categorizeResult) {
+		if r.err != nil {
+			t.Errorf("Unexpected error for %s: %v", r.purchase.Product, r.err)
+		}
+		handled = append(handled, r.id)
+	})
+
+	if len(handled) != len(purchases) {
+		t.Fatalf("Expected %d results, got %d", len(purchases), len(handled))
+	}
+	for i, id := range handled {
+		if id != i+1 {
+			t.Errorf("Results out of order: %v", handled)
+			break
+		}
+	}
+	if max := atomic.LoadInt32(&categorizer.maxActive); max > 3 || max < 2 {
+		t.Errorf("Expected between 2 and 3 concurrent calls, got %d", max)
+	}
+}
+
+// blockingCategorizer blocks every call until release is closed or the call
+// is cancelled, and records the writes of the purchases it categorized
+type blockingCategorizer struct {
+	started  chan struct{}
+	release  chan struct{}
+	canceled int32
+	writes   []int
+}
+
+func (b *blockingCategorizer) Name() string {
+	return "blocking"
+}
+
+func (b *blockingCategorizer) Categorize(ctx context.Context, purchase models.Purchase) (int, error) {
+	b.started <- struct{}{}
+	select {
+	case <-b.release:
+		return purchase.Id, nil
+	case <-ctx.Done():
+		atomic.AddInt32(&b.canceled, 1)
+		return 0, fmt.Errorf("error calling Ollama: %w", ctx.Err())
+	}
+}
+
+func (b *blockingCategorizer) categorizeDeferred(ctx context.Context, purchase models.Purchase) (int, deferredWrites, error) {
+	id, err := b.Categorize(ctx, purchase)
+	return id, deferredWrites{cache: func() error {
+		b.writes = append(b.writes, id)
+		return nil
+	}}, err
+}
+
+func TestCategorizeConcurrentlyFinishesInFlight(t *testing.T) {
+	categorizer := &blockingCategorizer{started: make(chan struct{}, 5), release: make(chan struct{})}
+	var purchases []models.Purchase
+	for i := 1; i <= 5; i++ {
+		purchases = append(purchases, models.Purchase{Id: i})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-categorizer.started
+		<-categorizer.started
+		cancel()
+		close(categorizer.release)
+	}()
+
+	var handled []int
+	categorizeConcurrently(ctx, categorizer, purchases, 2, func(r categorizeResult) {
+		if r.err != nil {
+			t.Errorf("Unexpected error for purchase %d: %v", r.purchase.Id, r.err)
+		}
+		handled = append(handled, r.id)
+	})
+
+	if canceled := atomic.LoadInt32(&categorizer.canceled); canceled != 0 {
+		t.Errorf("Expected the purchases in flight to finish, %d were cancelled", canceled)
+	}
+	if len(handled) != 2 || handled[0] != 1 || handled[1] != 2 {
+		t.Errorf("Expected the 2 purchases started to be handled, got %v", handled)
+	}
+	if len(categorizer.writes) != 2 || categorizer.writes[0] != 1 || categorizer.writes[1] != 2 {
+		t.Errorf("Expected only the writes of the 2 purchases started, got %v", categorizer.writes)
+	}
+}
+
+// deferringCategorizer returns writes appending to writes without locking,
+// so the race detector catches writes made on the workers
+type deferringCategorizer struct {
+	slowCategorizer
+	writes []int
+}
+
+func (d *deferringCategorizer) categorizeDeferred(ctx context.Context, purchase models.Purchase) (int, deferredWrites, error) {
+	id, err := d.Categorize(ctx, purchase)
+	return id, deferredWrites{cache: func() error {
+		d.writes = append(d.writes, id)
+		return nil
+	}}, err
+}
+
+func TestCategorizeConcurrentlyWritesInOrder(t *testing.T) {
+	categorizer := &deferringCategorizer{slowCategorizer: slowCategorizer{delays: make(map[string]time.Duration)}}
+	var purchases []models.Purchase
+	for i := 1; i <= 6; i++ {
+		product := fmt.Sprintf("product %d", i)
+		categorizer.delays[product] = time.Duration(7-i) * 3 * time.Millisecond
+		purchases = append(purchases, models.Purchase{Id: i, Product: product})
+	}
+
+	categorizeConcurrently(context.Background(), categorizer, purchases, 3, func(r categorizeResult) {
+		if len(categorizer.writes) != r.id {
+			t.Errorf("Expected the writes of purchase %d before it is handled, got %v", r.id, categorizer.writes)
+		}
+	})
+
+	if len(categorizer.writes) != len(purchases) || categorizer.writes[0] != 1 || categorizer.writes[5] != 6 {
+		t.Errorf("Expected every write in order, got %v", categorizer.writes)
+	}
+}
+
+func TestAutoAssignPurchasesConcurrentlyOverHosts(t *testing.T) {
+	db, cleanup := setupTestDBForServices(t)
+	defer cleanup()
+	db.SetMaxOpenConns(1)
+
+	var calls [2]int32
+	var hosts []string
+	for i := range calls {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls[i], 1)
+			json.NewEncoder(w).Encode(OllamaResponse{Response: "{\"ID\": 3}", Done: true})
+		}))
+		defer server.Close()
+		hosts = append(hosts, server.URL)
+	}
+
+	result, _ := db.Exec("INSERT INTO Receipts (date, amount) VALUES (?, ?)", "2025-01-06 10:00:00", "10.00")
+	receiptId, _ := result.LastInsertId()
+	for _, product := range []string{"Carrots", "Leeks", "Onions", "Parsnips", "Kale", "Spinach"} {
+		db.Exec("INSERT INTO Purchases (name, price, receiptId) VALUES (?, ?, ?)", product, "1.00", receiptId)
+	}
+
+	categorizer, err := NewLLMCategorizer(db, "test-model")
+	if err != nil {
+		t.Fatalf("NewLLMCategorizer() error = %v", err)
+	}
+	categorizer.Hosts = hosts
+	categorizer.Audit = true
+
+	err = AutoAssignPurchases(context.Background(), db, categorizer, 3)
+	if err != nil {
+		t.Fatalf("AutoAssignPurchases() error = %v", err)
+	}
+
+	var unassigned int
+	db.QueryRow("SELECT COUNT(*) FROM Purchases WHERE categoryId IS NULL OR categoryId != 3").Scan(&unassigned)
+	if unassigned != 0 {
+		t.Errorf("Expected every purchase in category 3, %d are not", unassigned)
+	}
+	for i := range calls {
+		if n := atomic.LoadInt32(&calls[i]); n != 3 {
+			t.Errorf("Expected 3 requests to host %d, got %d", i, n)
+		}
+	}
+}
@@ -5,94 +5,234 @@ import (
 	"fmt"
 	"log"
 	"math"
+	"os"
+	"sort"
+	"strconv"
 	"time"
 	"whatAmIBuying/internal/database"
+	"whatAmIBuying/internal/dates"
 	"whatAmIBuying/internal/models"
+	"whatAmIBuying/internal/render"
 )
 
-func PredictPurchases() {
+// PredictOptions configures a purchase prediction
+type PredictOptions struct {
+	// At is the time purchases are predicted for
+	At time.Time
+	// Days is the horizon, the number of days from At that are scored. Less
+	// than 1 scores At alone
+	Days int
+	// Predictor is the name of the predictor, "time" if empty
+	Predictor string
+	// Scoring weighs the purchase history, DefaultScoringOptions if zero
+	Scoring ScoringOptions
+	// Format is how the predictions are written, a table if empty
+	Format render.Format
+}
+
+// PredictPurchases prints the categories most likely to be bought at the
+// given time, best first
+func PredictPurchases(opts PredictOptions) error {
 	db, err := database.OpenDatabase()
 	if err != nil {
 		log.Fatal("Error opening database: ", err)
 	}
 
-	targetTime := time.Date(2023, 12, 24, 15, 30, 0, 0, time.Local) // Example: Christmas Eve at 3:30 PM
+	if opts.Scoring == (ScoringOptions{}) {
+		opts.Scoring = DefaultScoringOptions
+	}
+
+	if opts.Predictor == "" {
+		opts.Predictor = "time"
+	}
+	predictor, err := NewPredictor(opts.Predictor, opts.Scoring)
+	if err != nil {
+		return err
+	}
 
-	categoryScores, err := getTimeBasedRecommendations(db, targetTime)
+	categoryScores, err := predictOverHorizon(db, opts.At, opts.Days, predictor)
 	if err != nil {
-		fmt.Println(err)
+		return err
 	}
 
+	table := render.NewTable("categories", "Category", "Probability")
+	if opts.Days > 1 {
+		table.Title = fmt.Sprintf("Predicted categories from %s over %d days by %s", opts.At.Format("Mon 2 Jan 2006 15:04"), opts.Days, predictor.Name())
+	} else {
+		table.Title = fmt.Sprintf("Predicted categories for %s by %s", opts.At.Format("Mon 2 Jan 2006 15:04"), predictor.Name())
+	}
+	table.Empty = "No purchases are predicted in this time."
 	for _, cs := range categoryScores {
-		fmt.Printf("Category ID: %d, score: %f \n", cs.CategoryID, cs.Score)
+		name, err := database.GetCategoryNameByID(db, cs.CategoryID)
+		if err != nil {
+			name = fmt.Sprintf("Category %d", cs.CategoryID)
+		}
+		table.AddRow(name, render.Percent(cs.Score))
+	}
+
+	return render.Write(os.Stdout, opts.Format, table)
+}
+
+// predictOverHorizon averages the category probabilities of every day from
+// targetTime over the given number of days, sorted best first
+func predictOverHorizon(db *sql.DB, targetTime time.Time, days int, predictor Predictor) ([]models.CategoryScore, error) {
+	days = max(days, 1)
+
+	history, err := loadPurchaseRecords(db, true)
+	if err != nil {
+		return nil, err
+	}
+
+	totals := make(map[int]float64)
+	for day := 0; day < days; day++ {
+		for _, cs := range predictor.Predict(history, targetTime.AddDate(0, 0, day)) {
+			totals[cs.CategoryID] += cs.Score / float64(days)
+		}
 	}
+
+	return normalizeScores(totals), nil
+}
+
+// sortCategoryScores orders scores from best to worst, breaking ties by
+// category ID so the order is stable
+func sortCategoryScores(scores []models.CategoryScore) {
+	sort.Slice(scores, func(i, j int) bool {
+		if scores[i].Score != scores[j].Score {
+			return scores[i].Score > scores[j].Score
+		}
+		return scores[i].CategoryID < scores[j].CategoryID
+	})
 }
 
-func getTimeBasedRecommendations(db *sql.DB, targetTime time.Time) ([]models.CategoryScore, error) {
-	rows, err := db.Query(`SELECT pu.Id, pu.name, pu.price, pu.categoryId, r.date
-	FROM Purchases pu 
+// loadPurchaseRecords reads purchases with the date of their receipt in the
+// timezone it was printed in, oldest first, optionally only the categorized
+// ones. Receipts whose date could not be parsed are left out
+func loadPurchaseRecords(db *sql.DB, categorizedOnly bool) ([]models.PurchaseRecord, error) {
+	query := `SELECT pu.Id, pu.name, pu.price, pu.receiptId, pu.categoryId, r.dateUtc, r.timezone
+	FROM Purchases pu
 	JOIN Receipts r on pu.receiptId = r.Id
-	WHERE pu.categoryId IS NOT NULL`)
+	WHERE r.dateError IS NULL`
+	if categorizedOnly {
+		query += ` AND pu.categoryId IS NOT NULL`
+	}
+	query += `
+	ORDER BY r.dateUtc, pu.Id`
+
+	rows, err := db.Query(query)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
+	locations := make(map[string]*time.Location)
 	var purchases []models.PurchaseRecord
 	for rows.Next() {
 		var pr models.PurchaseRecord
-		var dateStr string
-		err = rows.Scan(&pr.Purchase.Id, &pr.Purchase.Product, &pr.Purchase.Price, &pr.Purchase.CategoryId, &dateStr)
+		var dateStr, timezone string
+		err = rows.Scan(&pr.Purchase.Id, &pr.Purchase.Product, &pr.Purchase.Price, &pr.Purchase.ReceiptId, &pr.Purchase.CategoryId, &dateStr, &timezone)
 		if err != nil {
 			return nil, err
 		}
+		pr.Purchase.PriceFloat, _ = strconv.ParseFloat(pr.Purchase.Price, 64)
 
-		pr.ReceiptDate, err = time.Parse("2006-01-02 15:04:05", dateStr)
-		if err != nil {
-			// If standard format fails, try with microseconds
-			pr.ReceiptDate, err = time.Parse("2006-01-02 15:04:05.000000", dateStr)
+		loc, ok := locations[timezone]
+		if !ok {
+			loc, err = dates.Location(timezone)
 			if err != nil {
 				return nil, err
 			}
+			locations[timezone] = loc
+		}
+		utc, err := time.Parse(dates.DatabaseLayout, dateStr)
+		if err != nil {
+			return nil, err
 		}
+		pr.ReceiptDate = utc.In(loc)
 
 		purchases = append(purchases, pr)
 	}
 
-	scores := make(map[int]*models.CategoryScore)
-	targetWeekday := int(targetTime.Weekday())
-	targetMonth := int(targetTime.Month())
+	return purchases, rows.Err()
+}
 
-	for _, p := range purchases {
-		var catID = int(p.Purchase.CategoryId.Int64)
-		if scores[catID] == nil {
-			scores[catID] = &models.CategoryScore{
-				CategoryID: catID,
-				Score:      0,
-			}
-		}
+// ScoringOptions weighs how purchases in the history count towards a
+// category being bought at a target time
+type ScoringOptions struct {
+	// HalfLife is the age at which a purchase counts half as much as one made
+	// at the target time, 0 for no decay
+	HalfLife time.Duration
+	// Weekday weighs purchases made on or near the target weekday
+	Weekday float64
+	// Month weighs purchases made in or near the target month
+	Month float64
+	// TimeOfDay weighs purchases made at or near the target hour
+	TimeOfDay float64
+	// Recency weighs every purchase by its age alone
+	Recency float64
+}
+
+// DefaultScoringOptions forgets purchases over a few months and favours the
+// weekday, which matters most for a weekly shop
+var DefaultScoringOptions = ScoringOptions{
+	HalfLife:  90 * 24 * time.Hour,
+	Weekday:   0.4,
+	Month:     0.2,
+	TimeOfDay: 0.2,
+	Recency:   0.2,
+}
 
-		// Weekday score
-		purchaseWeekday := int(p.ReceiptDate.Weekday())
-		weekdayDist := math.Mod(float64(purchaseWeekday-targetWeekday+7), 7)
-		weekdayScore := math.Exp(-math.Pow(weekdayDist, 2)/4.5) * 0.5
+// circularDistance returns the distance between a and b on a cycle of the
+// given length, such as weekdays or months
+func circularDistance(a, b, length float64) float64 {
+	d := math.Mod(math.Abs(a-b), length)
+	return math.Min(d, length-d)
+}
 
-		// Month score
-		purchaseMonth := int(p.ReceiptDate.Month())
-		monthDist := math.Mod(float64(purchaseMonth-targetMonth+12), 12)
-		if monthDist > 6 {
-			monthDist = 12 - monthDist
-		}
-		monthScore := math.Exp(-math.Pow(monthDist, 2)/8.0) * 0.3
+// recencyDecay is how much a purchase of the given age counts, halving with
+// every half life
+func recencyDecay(age time.Duration, halfLife time.Duration) float64 {
+	if halfLife <= 0 || age <= 0 {
+		return 1
+	}
+	return math.Pow(0.5, float64(age)/float64(halfLife))
+}
+
+// purchaseScore is how strongly a purchase suggests buying its category again
+// at the target time
+func purchaseScore(purchased time.Time, targetTime time.Time, opts ScoringOptions) float64 {
+	weekdayDist := circularDistance(float64(purchased.Weekday()), float64(targetTime.Weekday()), 7)
+	weekdayScore := math.Exp(-math.Pow(weekdayDist, 2) / 4.5)
+
+	monthDist := circularDistance(float64(purchased.Month()), float64(targetTime.Month()), 12)
+	monthScore := math.Exp(-math.Pow(monthDist, 2) / 8.0)
+
+	hour := func(t time.Time) float64 { return float64(t.Hour()) + float64(t.Minute())/60 }
+	hourDist := circularDistance(hour(purchased), hour(targetTime), 24)
+	timeScore := math.Exp(-math.Pow(hourDist, 2) / 8.0)
+
+	decay := recencyDecay(targetTime.Sub(purchased), opts.HalfLife)
+	return decay * (opts.Weekday*weekdayScore + opts.Month*monthScore + opts.TimeOfDay*timeScore + opts.Recency)
+}
 
-		freqScore := 0.2
-		scores[catID].Score += weekdayScore + monthScore + freqScore
+// scoreCategories returns the probability of every category being bought at
+// the target time from the purchases made before it
+func scoreCategories(purchases []models.PurchaseRecord, targetTime time.Time, opts ScoringOptions) []models.CategoryScore {
+	scores := make(map[int]float64)
+	for _, p := range purchases {
+		if p.ReceiptDate.After(targetTime) {
+			continue
+		}
+		scores[int(p.Purchase.CategoryId.Int64)] += purchaseScore(p.ReceiptDate, targetTime, opts)
 	}
 
-	var categoryScores []models.CategoryScore
-	for _, score := range scores {
-		categoryScores = append(categoryScores, *score)
+	return normalizeScores(scores)
+}
+
+func getTimeBasedRecommendations(db *sql.DB, targetTime time.Time, opts ScoringOptions) ([]models.CategoryScore, error) {
+	purchases, err := loadPurchaseRecords(db, true)
+	if err != nil {
+		return nil, err
 	}
 
-	return categoryScores, nil
+	return scoreCategories(purchases, targetTime, opts), nil
 }
@@ -3,9 +3,12 @@ package services
 import (
 	"context"
 	"database/sql"
+	"math"
 	"os"
 	"testing"
 	"time"
+	"whatAmIBuying/internal/database"
+	"whatAmIBuying/internal/models"
 
 	_ "modernc.org/sqlite"
 )
@@ -45,6 +48,11 @@ func setupTestDBForServices(t *testing.T) (*sql.DB, func()) {
 		t.Fatalf("Failed to create tables: %v", err)
 	}
 
+	err = database.Migrate(db)
+	if err != nil {
+		t.Fatalf("Failed to migrate tables: %v", err)
+	}
+
 	// Seed categories
 	categories := []string{"Dairy", "Meat", "Vegetables"}
 	for _, cat := range categories {
@@ -62,6 +70,15 @@ func setupTestDBForServices(t *testing.T) (*sql.DB, func()) {
 	return db, cleanup
 }
 
+// migrateTestDB parses the dates of the receipts a test inserted, as opening
+// the database does
+func migrateTestDB(t *testing.T, db *sql.DB) {
+	err := database.Migrate(db)
+	if err != nil {
+		t.Fatalf("Failed to migrate tables: %v", err)
+	}
+}
+
 func TestGetTimeBasedRecommendations(t *testing.T) {
 	db, cleanup := setupTestDBForServices(t)
 	defer cleanup()
@@ -97,11 +114,12 @@ func TestGetTimeBasedRecommendations(t *testing.T) {
 	tx.ExecContext(ctx, "INSERT INTO Purchases (name, price, receiptId, categoryId) VALUES (?, ?, ?, ?)",
 		"Milk", "2.50", receiptId3, 1) // Dairy again
 	tx.Commit()
+	migrateTestDB(t, db)
 
 	// Test prediction for a Monday in January
 	targetTime := time.Date(2025, 1, 13, 10, 0, 0, 0, time.Local) // Monday
 
-	scores, err := getTimeBasedRecommendations(db, targetTime)
+	scores, err := getTimeBasedRecommendations(db, targetTime, DefaultScoringOptions)
 	if err != nil {
 		t.Fatalf("getTimeBasedRecommendations() error = %v", err)
 	}
@@ -135,7 +153,7 @@ func TestGetTimeBasedRecommendationsEmptyDB(t *testing.T) {
 
 	targetTime := time.Date(2025, 1, 13, 10, 0, 0, 0, time.Local)
 
-	scores, err := getTimeBasedRecommendations(db, targetTime)
+	scores, err := getTimeBasedRecommendations(db, targetTime, DefaultScoringOptions)
 	if err != nil {
 		t.Fatalf("getTimeBasedRecommendations() error = %v", err)
 	}
@@ -169,10 +187,11 @@ func TestGetTimeBasedRecommendationsDifferentWeekdays(t *testing.T) {
 	tx.ExecContext(ctx, "INSERT INTO Purchases (name, price, receiptId, categoryId) VALUES (?, ?, ?, ?)",
 		"Steak", "8.00", receiptId, 2)
 	tx.Commit()
+	migrateTestDB(t, db)
 
 	// Test for Monday - should have stronger score for Dairy
 	mondayTarget := time.Date(2025, 1, 13, 10, 0, 0, 0, time.Local) // Monday
-	mondayScores, err := getTimeBasedRecommendations(db, mondayTarget)
+	mondayScores, err := getTimeBasedRecommendations(db, mondayTarget, DefaultScoringOptions)
 	if err != nil {
 		t.Fatalf("getTimeBasedRecommendations() error = %v", err)
 	}
@@ -184,7 +203,7 @@ func TestGetTimeBasedRecommendationsDifferentWeekdays(t *testing.T) {
 
 	// Test for Friday - should have stronger score for Meat
 	fridayTarget := time.Date(2025, 1, 17, 17, 0, 0, 0, time.Local) // Friday
-	fridayScores, err := getTimeBasedRecommendations(db, fridayTarget)
+	fridayScores, err := getTimeBasedRecommendations(db, fridayTarget, DefaultScoringOptions)
 	if err != nil {
 		t.Fatalf("getTimeBasedRecommendations() error = %v", err)
 	}
@@ -204,3 +223,206 @@ func TestGetTimeBasedRecommendationsDifferentWeekdays(t *testing.T) {
 		t.Error("Expected Meat to have higher score on Friday than Monday")
 	}
 }
+
+func TestPredictOverHorizon(t *testing.T) {
+	db, cleanup := setupTestDBForServices(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	for _, p := range []struct {
+		date       string
+		categoryId int
+	}{
+		{"2025-01-06 10:00:00", 1}, // Monday
+		{"2025-01-13 10:00:00", 1}, // Monday
+		{"2025-01-10 17:00:00", 2}, // Friday
+	} {
+		result, _ := db.ExecContext(ctx, "INSERT INTO Receipts (date, amount) VALUES (?, ?)", p.date, "1.00")
+		receiptId, _ := result.LastInsertId()
+		db.ExecContext(ctx, "INSERT INTO Purchases (name, price, receiptId, categoryId) VALUES (?, ?, ?, ?)",
+			"Item", "1.00", receiptId, p.categoryId)
+	}
+	migrateTestDB(t, db)
+
+	monday := time.Date(2025, 1, 20, 10, 0, 0, 0, time.Local)
+	scores, err := predictOverHorizon(db, monday, 1, &TimePredictor{Scoring: DefaultScoringOptions})
+	if err != nil {
+		t.Fatalf("predictOverHorizon() error = %v", err)
+	}
+	if len(scores) != 2 || scores[0].CategoryID != 1 {
+		t.Fatalf("Expected Dairy first on a Monday, got %v", scores)
+	}
+
+	week, err := predictOverHorizon(db, monday, 7, &TimePredictor{Scoring: DefaultScoringOptions})
+	if err != nil {
+		t.Fatalf("predictOverHorizon() error = %v", err)
+	}
+	if len(week) != 2 || week[0].Score < week[1].Score {
+		t.Errorf("Expected scores sorted best first, got %v", week)
+	}
+	if week[1].Score <= scores[1].Score {
+		t.Errorf("Expected Meat to score higher over a week including Friday, got %f and %f", week[1].Score, scores[1].Score)
+	}
+}
+
+func TestCircularDistance(t *testing.T) {
+	tests := []struct {
+		name     string
+		a, b     float64
+		length   float64
+		expected float64
+	}{
+		{"Same weekday", 1, 1, 7, 0},
+		{"Sunday and Monday", 0, 1, 7, 1},
+		{"Monday and Sunday", 1, 0, 7, 1},
+		{"Saturday and Monday wrap", 6, 1, 7, 2},
+		{"December and January", 12, 1, 12, 1},
+		{"Opposite months", 3, 9, 12, 6},
+		{"Late night and early morning", 23.5, 0.5, 24, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := circularDistance(tt.a, tt.b, tt.length); math.Abs(got-tt.expected) > 1e-9 {
+				t.Errorf("circularDistance(%v, %v, %v) = %v, want %v", tt.a, tt.b, tt.length, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRecencyDecay(t *testing.T) {
+	day := 24 * time.Hour
+	tests := []struct {
+		name     string
+		age      time.Duration
+		halfLife time.Duration
+		expected float64
+	}{
+		{"Just bought", 0, 30 * day, 1},
+		{"One half life", 30 * day, 30 * day, 0.5},
+		{"Two half lives", 60 * day, 30 * day, 0.25},
+		{"Half a half life", 15 * day, 30 * day, math.Sqrt(0.5)},
+		{"No decay", 365 * day, 0, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := recencyDecay(tt.age, tt.halfLife); math.Abs(got-tt.expected) > 1e-9 {
+				t.Errorf("recencyDecay() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestPurchaseScore(t *testing.T) {
+	// A Monday at 10:00 in January
+	target := time.Date(2025, 1, 13, 10, 0, 0, 0, time.UTC)
+	only := func(component string) ScoringOptions {
+		opts := ScoringOptions{}
+		switch component {
+		case "weekday":
+			opts.Weekday = 1
+		case "month":
+			opts.Month = 1
+		case "time":
+			opts.TimeOfDay = 1
+		case "recency":
+			opts.Recency = 1
+		}
+		return opts
+	}
+
+	tests := []struct {
+		name      string
+		purchased time.Time
+		opts      ScoringOptions
+		expected  float64
+	}{
+		{"Same weekday", time.Date(2025, 1, 6, 18, 0, 0, 0, time.UTC), only("weekday"), 1},
+		{"Weekday before", time.Date(2025, 1, 5, 10, 0, 0, 0, time.UTC), only("weekday"), math.Exp(-1 / 4.5)},
+		{"Three weekdays apart", time.Date(2025, 1, 10, 10, 0, 0, 0, time.UTC), only("weekday"), math.Exp(-9 / 4.5)},
+		{"December for January", time.Date(2024, 12, 15, 10, 0, 0, 0, time.UTC), only("month"), math.Exp(-1 / 8.0)},
+		{"Two hours apart", time.Date(2025, 1, 6, 12, 0, 0, 0, time.UTC), only("time"), math.Exp(-4 / 8.0)},
+		{"Recency only", time.Date(2024, 3, 3, 0, 0, 0, 0, time.UTC), only("recency"), 1},
+		{
+			"Weighted sum with decay",
+			time.Date(2024, 10, 15, 10, 0, 0, 0, time.UTC), // A Tuesday, 90 days earlier
+			ScoringOptions{HalfLife: 90 * 24 * time.Hour, Weekday: 0.4, Month: 0.2, TimeOfDay: 0.2, Recency: 0.2},
+			0.5 * (0.4*math.Exp(-1/4.5) + 0.2*math.Exp(-9/8.0) + 0.2 + 0.2),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := purchaseScore(tt.purchased, target, tt.opts); math.Abs(got-tt.expected) > 1e-9 {
+				t.Errorf("purchaseScore() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestScoreCategoriesNormalizes(t *testing.T) {
+	record := func(date string, categoryId int64) models.PurchaseRecord {
+		d, _ := time.Parse("2006-01-02 15:04", date)
+		return models.PurchaseRecord{
+			Purchase:    models.Purchase{CategoryId: sql.NullInt64{Int64: categoryId, Valid: true}},
+			ReceiptDate: d,
+		}
+	}
+	purchases := []models.PurchaseRecord{
+		record("2025-01-06 10:00", 1),
+		record("2025-01-06 10:00", 1),
+		record("2025-01-06 10:00", 2),
+		record("2025-01-06 10:00", 3),
+		// After the target, so not known yet
+		record("2025-02-01 10:00", 3),
+	}
+	target := time.Date(2025, 1, 13, 10, 0, 0, 0, time.UTC)
+
+	scores := scoreCategories(purchases, target, DefaultScoringOptions)
+
+	expected := []models.CategoryScore{{CategoryID: 1, Score: 0.5}, {CategoryID: 2, Score: 0.25}, {CategoryID: 3, Score: 0.25}}
+	if len(scores) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, scores)
+	}
+	for i := range expected {
+		if scores[i].CategoryID != expected[i].CategoryID || math.Abs(scores[i].Score-expected[i].Score) > 1e-9 {
+			t.Errorf("Score %d = %v, want %v", i, scores[i], expected[i])
+		}
+	}
+
+	// Older purchases count less, so a recent category outweighs an old one
+	old := []models.PurchaseRecord{record("2024-07-01 10:00", 1), record("2025-01-06 10:00", 2)}
+	scores = scoreCategories(old, target, ScoringOptions{HalfLife: 30 * 24 * time.Hour, Recency: 1})
+	if scores[0].CategoryID != 2 || scores[0].Score < 0.95 {
+		t.Errorf("Expected the recent category to dominate, got %v", scores)
+	}
+}
+
+func TestLoadPurchaseRecordsSkipsInvalidDates(t *testing.T) {
+	db, cleanup := setupTestDBForServices(t)
+	defer cleanup()
+
+	for _, date := range []string{"26/01/25 12:02:57", "sometime in spring", "2025-01-27 09:00:00"} {
+		result, _ := db.Exec("INSERT INTO Receipts (date, amount) VALUES (?, ?)", date, "1.00")
+		receiptId, _ := result.LastInsertId()
+		db.Exec("INSERT INTO Purchases (name, price, receiptId, categoryId) VALUES (?, ?, ?, ?)", "Milk", "1.10", receiptId, 1)
+	}
+	migrateTestDB(t, db)
+
+	purchases, err := loadPurchaseRecords(db, true)
+	if err != nil {
+		t.Fatalf("loadPurchaseRecords() error = %v", err)
+	}
+
+	if len(purchases) != 2 {
+		t.Fatalf("Expected the receipt with an invalid date left out, got %d purchases", len(purchases))
+	}
+	first := purchases[0].ReceiptDate
+	if first.Day() != 26 || first.Hour() != 12 || first.Minute() != 2 {
+		t.Errorf("Expected the receipt's local time 26th 12:02, got %v", first)
+	}
+	if purchases[1].Purchase.PriceFloat != 1.10 {
+		t.Errorf("Expected the price parsed, got %v", purchases[1].Purchase.PriceFloat)
+	}
+}
@@ -0,0 +1,186 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"whatAmIBuying/internal/models"
+)
+
+// Predictor foresees which categories are bought at a given time from the
+// purchases made before it
+type Predictor interface {
+	Name() string
+	// Predict returns the probability of every category being bought at the
+	// given time, best first. Purchases after it are ignored
+	Predict(history []models.PurchaseRecord, at time.Time) []models.CategoryScore
+}
+
+// PredictorNames are the predictors NewPredictor knows, in the order they
+// are listed
+var PredictorNames = []string{"time", "frequency", "markov", "ensemble"}
+
+// NewPredictor creates the predictor with the given name. scoring weighs the
+// history of the time based predictor and the decay of the others
+func NewPredictor(name string, scoring ScoringOptions) (Predictor, error) {
+	switch name {
+	case "time":
+		return &TimePredictor{Scoring: scoring}, nil
+	case "frequency":
+		return &FrequencyPredictor{HalfLife: scoring.HalfLife}, nil
+	case "markov":
+		return &MarkovPredictor{Smoothing: 1}, nil
+	case "ensemble":
+		return &EnsemblePredictor{Members: []Predictor{
+			&TimePredictor{Scoring: scoring},
+			&FrequencyPredictor{HalfLife: scoring.HalfLife},
+			&MarkovPredictor{Smoothing: 1},
+		}}, nil
+	default:
+		return nil, fmt.Errorf("unknown predictor %q, expected one of %s", name, strings.Join(PredictorNames, ", "))
+	}
+}
+
+// TimePredictor scores categories by how often they were bought at a similar
+// weekday, month and time of day
+type TimePredictor struct {
+	Scoring ScoringOptions
+}
+
+func (p *TimePredictor) Name() string {
+	return "time"
+}
+
+func (p *TimePredictor) Predict(history []models.PurchaseRecord, at time.Time) []models.CategoryScore {
+	return scoreCategories(history, at, p.Scoring)
+}
+
+// FrequencyPredictor scores categories by how often they were bought, with
+// recent purchases counting more
+type FrequencyPredictor struct {
+	// HalfLife is the age at which a purchase counts half, 0 for no decay
+	HalfLife time.Duration
+}
+
+func (p *FrequencyPredictor) Name() string {
+	return "frequency"
+}
+
+func (p *FrequencyPredictor) Predict(history []models.PurchaseRecord, at time.Time) []models.CategoryScore {
+	return scoreCategories(history, at, ScoringOptions{HalfLife: p.HalfLife, Recency: 1})
+}
+
+// MarkovPredictor scores categories by what was bought on the receipt after
+// receipts holding the categories of the latest one
+type MarkovPredictor struct {
+	// Smoothing is added to every transition count so categories never seen
+	// to follow keep a small chance
+	Smoothing float64
+}
+
+func (p *MarkovPredictor) Name() string {
+	return "markov"
+}
+
+func (p *MarkovPredictor) Predict(history []models.PurchaseRecord, at time.Time) []models.CategoryScore {
+	var known []models.PurchaseRecord
+	for _, r := range history {
+		if !r.ReceiptDate.After(at) {
+			known = append(known, r)
+		}
+	}
+	receipts := groupByReceipt(known)
+	if len(receipts) == 0 {
+		return nil
+	}
+
+	categories := make(map[int]bool)
+	for _, r := range known {
+		categories[int(r.Purchase.CategoryId.Int64)] = true
+	}
+
+	// transitions[a][b] counts receipts with b following receipts with a
+	transitions := make(map[int]map[int]float64)
+	for i := 1; i < len(receipts); i++ {
+		for from := range receiptCategories(receipts[i-1]) {
+			if transitions[from] == nil {
+				transitions[from] = make(map[int]float64)
+			}
+			for to := range receiptCategories(receipts[i]) {
+				transitions[from][to]++
+			}
+		}
+	}
+
+	// Every category of the latest receipt predicts the next one equally
+	scores := make(map[int]float64)
+	last := receiptCategories(receipts[len(receipts)-1])
+	for from := range last {
+		total := 0.0
+		for _, count := range transitions[from] {
+			total += count
+		}
+		total += p.Smoothing * float64(len(categories))
+		if total == 0 {
+			continue
+		}
+		for to := range categories {
+			scores[to] += (transitions[from][to] + p.Smoothing) / total / float64(len(last))
+		}
+	}
+
+	return normalizeScores(scores)
+}
+
+// receiptCategories returns the categories bought on a receipt
+func receiptCategories(receipt []models.PurchaseRecord) map[int]bool {
+	categories := make(map[int]bool)
+	for _, r := range receipt {
+		categories[int(r.Purchase.CategoryId.Int64)] = true
+	}
+	return categories
+}
+
+// EnsemblePredictor averages the probabilities of its members
+type EnsemblePredictor struct {
+	Members []Predictor
+	// Weights weighs every member, equal weights if empty
+	Weights []float64
+}
+
+func (p *EnsemblePredictor) Name() string {
+	return "ensemble"
+}
+
+func (p *EnsemblePredictor) Predict(history []models.PurchaseRecord, at time.Time) []models.CategoryScore {
+	scores := make(map[int]float64)
+	for i, member := range p.Members {
+		weight := 1.0
+		if i < len(p.Weights) {
+			weight = p.Weights[i]
+		}
+		for _, cs := range member.Predict(history, at) {
+			scores[cs.CategoryID] += weight * cs.Score
+		}
+	}
+
+	return normalizeScores(scores)
+}
+
+// normalizeScores turns category scores into probabilities, best first
+func normalizeScores(scores map[int]float64) []models.CategoryScore {
+	total := 0.0
+	for _, score := range scores {
+		total += score
+	}
+
+	categoryScores := make([]models.CategoryScore, 0, len(scores))
+	for id, score := range scores {
+		if total > 0 {
+			score /= total
+		}
+		categoryScores = append(categoryScores, models.CategoryScore{CategoryID: id, Score: score})
+	}
+	sortCategoryScores(categoryScores)
+	return categoryScores
+}
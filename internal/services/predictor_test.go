@@ -0,0 +1,99 @@
+package services
+
+import (
+	"math"
+	"testing"
+	"time"
+	"whatAmIBuying/internal/models"
+)
+
+func TestNewPredictor(t *testing.T) {
+	for _, name := range PredictorNames {
+		predictor, err := NewPredictor(name, DefaultScoringOptions)
+		if err != nil {
+			t.Errorf("NewPredictor(%q) error = %v", name, err)
+			continue
+		}
+		if predictor.Name() != name {
+			t.Errorf("NewPredictor(%q) is named %q", name, predictor.Name())
+		}
+	}
+
+	if _, err := NewPredictor("oracle", DefaultScoringOptions); err == nil {
+		t.Error("Expected an error for an unknown predictor")
+	}
+}
+
+func TestPredictors(t *testing.T) {
+	// Receipts with Dairy are followed by receipts with Vegetables, which
+	// are followed by receipts with Dairy
+	history := []models.PurchaseRecord{
+		backtestRecord(1, 1, 1),
+		backtestRecord(2, 2, 3),
+		backtestRecord(3, 3, 1),
+		backtestRecord(3, 3, 2),
+		backtestRecord(4, 4, 3),
+		backtestRecord(5, 5, 1),
+		// Not bought yet at the time of the prediction
+		backtestRecord(6, 20, 2),
+	}
+	at := time.Date(2025, 1, 6, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		predictor Predictor
+		expected  []models.CategoryScore
+	}{
+		{
+			"Frequency without decay",
+			&FrequencyPredictor{},
+			[]models.CategoryScore{{CategoryID: 1, Score: 0.5}, {CategoryID: 3, Score: 1.0 / 3}, {CategoryID: 2, Score: 1.0 / 6}},
+		},
+		{
+			// Dairy was followed by Vegetables both times, with Laplace
+			// smoothing over three categories
+			"Markov after Dairy",
+			&MarkovPredictor{Smoothing: 1},
+			[]models.CategoryScore{{CategoryID: 3, Score: 3.0 / 5}, {CategoryID: 1, Score: 1.0 / 5}, {CategoryID: 2, Score: 1.0 / 5}},
+		},
+		{
+			"Markov without smoothing",
+			&MarkovPredictor{},
+			[]models.CategoryScore{{CategoryID: 3, Score: 1}, {CategoryID: 1, Score: 0}, {CategoryID: 2, Score: 0}},
+		},
+		{
+			"Weighted ensemble",
+			&EnsemblePredictor{Members: []Predictor{&FrequencyPredictor{}, &MarkovPredictor{}}, Weights: []float64{3, 1}},
+			[]models.CategoryScore{
+				{CategoryID: 3, Score: (3*1.0/3 + 1) / 4},
+				{CategoryID: 1, Score: (3 * 0.5) / 4},
+				{CategoryID: 2, Score: (3 * 1.0 / 6) / 4},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scores := tt.predictor.Predict(history, at)
+
+			if len(scores) != len(tt.expected) {
+				t.Fatalf("Expected %v, got %v", tt.expected, scores)
+			}
+			for i := range tt.expected {
+				if scores[i].CategoryID != tt.expected[i].CategoryID || math.Abs(scores[i].Score-tt.expected[i].Score) > 1e-9 {
+					t.Errorf("Score %d = %v, want %v", i, scores[i], tt.expected[i])
+				}
+			}
+		})
+	}
+}
+
+func TestPredictorsWithoutHistory(t *testing.T) {
+	at := time.Date(2025, 1, 6, 10, 0, 0, 0, time.UTC)
+	for _, name := range PredictorNames {
+		predictor, _ := NewPredictor(name, DefaultScoringOptions)
+		if scores := predictor.Predict(nil, at); len(scores) != 0 {
+			t.Errorf("Expected no scores from %s without history, got %v", name, scores)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package services
+
+import (
+	"fmt"
+	"whatAmIBuying/internal/imaging"
+)
+
+// SplitReceiptRows preprocesses a receipt photo and writes an image of every
+// row of text to outDir, ready for OCR
+func SplitReceiptRows(imagePath string, outDir string) error {
+	img, err := imaging.Load(imagePath)
+	if err != nil {
+		return err
+	}
+
+	prepared := imaging.Preprocess(img)
+
+	bands := imaging.RowBands(prepared, imaging.DefaultRowOptions)
+	paths, err := imaging.WriteRows(outDir, imaging.CropRows(prepared, bands))
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Cropped the %dx%d photo to the %dx%d paper\n",
+		img.Bounds().Dx(), img.Bounds().Dy(), prepared.Bounds().Dx(), prepared.Bounds().Dy())
+	fmt.Printf("Wrote %d rows to %s\n", len(paths), outDir)
+	return nil
+}
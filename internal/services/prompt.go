@@ -0,0 +1,101 @@
+package services
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"whatAmIBuying/internal/models"
+)
+
+// fewShotExamples is how many similar categorized purchases are shown to the LLM
+const fewShotExamples = 5
+
+// NormalizeProductName lowercases a product name and drops tokens that carry
+// no meaning for categorization, such as barcodes and "2 x 1.05" multipliers
+func NormalizeProductName(name string) string {
+	var words []string
+	for _, field := range strings.Fields(strings.ToLower(name)) {
+		hasLetter := false
+		for _, r := range field {
+			if unicode.IsLetter(r) {
+				hasLetter = true
+				break
+			}
+		}
+		if !hasLetter || field == "x" {
+			continue
+		}
+		words = append(words, field)
+	}
+	return strings.Join(words, " ")
+}
+
+// trigrams returns the set of character trigrams of a normalized name
+func trigrams(name string) map[string]bool {
+	padded := []rune("  " + NormalizeProductName(name) + " ")
+	grams := make(map[string]bool)
+	for i := 0; i+3 <= len(padded); i++ {
+		grams[string(padded[i:i+3])] = true
+	}
+	return grams
+}
+
+// NameSimilarity returns the Jaccard similarity of the character trigrams of
+// two product names, from 0 (nothing in common) to 1 (identical)
+func NameSimilarity(a string, b string) float64 {
+	gramsA := trigrams(a)
+	gramsB := trigrams(b)
+	if len(gramsA) == 0 || len(gramsB) == 0 {
+		return 0
+	}
+
+	shared := 0
+	for g := range gramsA {
+		if gramsB[g] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(gramsA)+len(gramsB)-shared)
+}
+
+// FindSimilarPurchases returns up to k categorized purchases whose names are
+// most similar to the name of the given purchase, most similar first. A stored
+// purchase is never its own example
+func FindSimilarPurchases(purchase models.Purchase, candidates []models.Purchase, k int) []models.Purchase {
+	type scored struct {
+		purchase models.Purchase
+		score    float64
+	}
+
+	seen := make(map[string]bool)
+	var scoredPurchases []scored
+	for _, c := range candidates {
+		if !c.CategoryId.Valid || (purchase.Id != 0 && c.Id == purchase.Id) {
+			continue
+		}
+		key := NormalizeProductName(c.Product)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		score := NameSimilarity(purchase.Product, c.Product)
+		if score > 0 {
+			scoredPurchases = append(scoredPurchases, scored{purchase: c, score: score})
+		}
+	}
+
+	sort.SliceStable(scoredPurchases, func(i, j int) bool {
+		return scoredPurchases[i].score > scoredPurchases[j].score
+	})
+
+	if len(scoredPurchases) > k {
+		scoredPurchases = scoredPurchases[:k]
+	}
+
+	similar := make([]models.Purchase, 0, len(scoredPurchases))
+	for _, s := range scoredPurchases {
+		similar = append(similar, s.purchase)
+	}
+	return similar
+}
@@ -0,0 +1,186 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"whatAmIBuying/internal/database"
+	"whatAmIBuying/internal/models"
+	"whatAmIBuying/internal/render"
+)
+
+// PromptVersion identifies the built-in categorization prompt, bump it
+// whenever the prompt changes so cached responses to the old prompt are not
+// reused
+const PromptVersion = "v4"
+
+// defaultPromptTemplate is the built-in categorization prompt. Templates
+// loaded from files receive the same PromptData
+const defaultPromptTemplate = `You are an AI assistant that helps to categorize purchases.
+
+TASK: Categorize the following purchase into one of the available categories.
+
+IMPORTANT INSTRUCTIONS:
+1. Take your time to think carefully about what this product actually is.
+2. Consider specific keywords and context clues in the purchase description.
+3. If the item contains multiple ingredients or components, focus on the main ingredient.
+4. For prepared foods, categorize based on the primary component.
+5. Follow the way previously categorized purchases were filed, if any examples are given.
+
+REQUIRED RESPONSE FORMAT:
+Your final answer MUST be provided in valid JSON format with a single 'ID' field containing the category ID as a number. Example: {"ID": 1}
+
+DO NOT include any explanations, reasoning, or additional text in your output - ONLY the JSON object.
+
+Available categories:
+{{range .Categories}}ID: {{.ID}}, Category: {{.Category}}
+{{end}}
+{{if .Examples}}Examples of how similar purchases were categorized before:
+{{range .Examples}}{{.Product}} -> {"ID": {{.CategoryID}}} ({{.Category}})
+{{end}}
+{{end}}{{.Product}} bought for {{.Price}}{{if .Store}} at {{.Store}}{{end}}`
+
+// PromptExample is a previously categorized purchase shown to the LLM
+type PromptExample struct {
+	Product    string
+	CategoryID int
+	Category   string
+}
+
+// PromptData holds the variables available to a prompt template
+type PromptData struct {
+	Categories []models.Category
+	Examples   []PromptExample
+	Product    string
+	Price      string
+	// Store is the store on the purchase's receipt, empty if unknown
+	Store string
+}
+
+// PromptTemplate is a categorization prompt written as a text/template
+type PromptTemplate struct {
+	// Version is stored with every cached response and audit, so responses to
+	// a different prompt are never mixed up
+	Version string
+	tmpl    *template.Template
+}
+
+// DefaultPromptTemplate returns the built-in categorization prompt
+func DefaultPromptTemplate() *PromptTemplate {
+	return &PromptTemplate{
+		Version: PromptVersion,
+		tmpl:    template.Must(template.New("default").Parse(defaultPromptTemplate)),
+	}
+}
+
+// LoadPromptTemplate reads a prompt template from a file, or returns the
+// built-in prompt if path is empty. The version of a file template is its
+// name followed by a hash of its content, so editing the file starts a new
+// version
+func LoadPromptTemplate(path string) (*PromptTemplate, error) {
+	if path == "" {
+		return DefaultPromptTemplate(), nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading prompt template: %w", err)
+	}
+
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	tmpl, err := template.New(name).Parse(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing prompt template %s: %w", path, err)
+	}
+
+	hash := sha256.Sum256(content)
+	return &PromptTemplate{
+		Version: name + "-" + hex.EncodeToString(hash[:4]),
+		tmpl:    tmpl,
+	}, nil
+}
+
+// Render builds the prompt for a single purchase made at store, including
+// previously categorized purchases as examples
+func (p *PromptTemplate) Render(categories []models.Category, examples []models.Purchase, purchase models.Purchase, store string) (string, error) {
+	categoryNames := make(map[int]string)
+	for _, category := range categories {
+		categoryNames[category.ID] = category.Category
+	}
+
+	data := PromptData{
+		Categories: categories,
+		Product:    purchase.Product,
+		Price:      purchase.Price,
+		Store:      store,
+	}
+	for _, e := range examples {
+		id := int(e.CategoryId.Int64)
+		data.Examples = append(data.Examples, PromptExample{Product: e.Product, CategoryID: id, Category: categoryNames[id]})
+	}
+
+	var sb strings.Builder
+	err := p.tmpl.Execute(&sb, data)
+	if err != nil {
+		return "", fmt.Errorf("error rendering prompt template: %w", err)
+	}
+
+	return sb.String(), nil
+}
+
+// RenderPrompt writes the prompt the LLM categorizer would send for a stored
+// purchase in the given format, using the template at path or the built-in
+// prompt if path is empty
+func RenderPrompt(path string, purchaseID int, format render.Format) error {
+	db, err := database.OpenDatabase()
+	if err != nil {
+		log.Fatal("Error opening database: ", err)
+	}
+
+	prompt, err := LoadPromptTemplate(path)
+	if err != nil {
+		return err
+	}
+
+	purchase, err := database.GetPurchaseByID(db, purchaseID)
+	if err != nil {
+		return err
+	}
+
+	history, err := database.GetCategorizedPurchases(db)
+	if err != nil {
+		return fmt.Errorf("getting categorized purchases failed: %w", err)
+	}
+
+	store, err := database.GetReceiptStore(db, purchase.ReceiptId)
+	if err != nil {
+		return err
+	}
+
+	examples := FindSimilarPurchases(purchase, history, fewShotExamples)
+	rendered, err := prompt.Render(*database.GetAllCategories(db), examples, purchase, store)
+	if err != nil {
+		return err
+	}
+
+	// The prompt spans many lines, so the table format prints it as it is sent
+	if format == "" || format == "table" {
+		fmt.Printf("Prompt version: %s\n\n%s\n", prompt.Version, rendered)
+		return nil
+	}
+
+	table := render.NewTable("prompt", "Purchase ID", "Prompt version", "Prompt")
+	table.AddRow(purchase.Id, prompt.Version, rendered)
+	return render.Write(os.Stdout, format, table)
+}
+
+// PrintDefaultPromptTemplate prints the built-in prompt template, as a
+// starting point for a template file
+func PrintDefaultPromptTemplate() {
+	fmt.Println(defaultPromptTemplate)
+}
@@ -0,0 +1,184 @@
+package services
+
+import (
+	"database/sql"
+	"os"
+	"strings"
+	"testing"
+	"whatAmIBuying/internal/models"
+)
+
+func TestNormalizeProductName(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "Plain name",
+			input:    "Stock Pots Chicken",
+			expected: "stock pots chicken",
+		},
+		{
+			name:     "Barcode suffix",
+			input:    "Iceberg Lettuce 0082031",
+			expected: "iceberg lettuce",
+		},
+		{
+			name:     "Multiplier",
+			input:    "Seeded Brioche Buns 2 x 1.05",
+			expected: "seeded brioche buns",
+		},
+		{
+			name:     "Empty",
+			input:    "",
+			expected: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := NormalizeProductName(tt.input)
+			if result != tt.expected {
+				t.Errorf("NormalizeProductName() = %q, want %q", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestNameSimilarity(t *testing.T) {
+	if s := NameSimilarity("Stock Pots Chicken", "Stock Pots Chicken"); s != 1 {
+		t.Errorf("Expected identical names to have similarity 1, got %f", s)
+	}
+
+	if s := NameSimilarity("Milk", ""); s != 0 {
+		t.Errorf("Expected similarity with empty name to be 0, got %f", s)
+	}
+
+	near := NameSimilarity("Stock Pots Chicken", "Stock Pots Veal 2 x 0.99")
+	far := NameSimilarity("Stock Pots Chicken", "Blueberries 350g 0080826")
+	if near <= far {
+		t.Errorf("Expected 'Stock Pots Veal' (%f) to be more similar than 'Blueberries' (%f)", near, far)
+	}
+}
+
+func TestFindSimilarPurchases(t *testing.T) {
+	candidates := []models.Purchase{
+		{Product: "Stock Pots Veal 2 x 0.99", CategoryId: sql.NullInt64{Int64: 17, Valid: true}},
+		{Product: "Blueberries 350g 0080826", CategoryId: sql.NullInt64{Int64: 6, Valid: true}},
+		{Product: "Stock Pots Beef", CategoryId: sql.NullInt64{Int64: 17, Valid: true}},
+		{Product: "Stock Pots Beef", CategoryId: sql.NullInt64{Int64: 17, Valid: true}},
+		{Product: "Stock Pots Lamb", CategoryId: sql.NullInt64{}},
+		{Id: 7, Product: "Stock Pots Chicken", CategoryId: sql.NullInt64{Int64: 2, Valid: true}},
+	}
+
+	similar := FindSimilarPurchases(models.Purchase{Id: 7, Product: "Stock Pots Chicken"}, candidates, 2)
+
+	if len(similar) != 2 {
+		t.Fatalf("Expected 2 similar purchases, got %d", len(similar))
+	}
+	for _, p := range similar {
+		if !strings.HasPrefix(p.Product, "Stock Pots") {
+			t.Errorf("Unexpected similar purchase '%s'", p.Product)
+		}
+		if p.Product == "Stock Pots Lamb" {
+			t.Error("Uncategorized purchases should not be used as examples")
+		}
+		if p.Id == 7 {
+			t.Error("A purchase should not be an example for itself")
+		}
+	}
+	if similar[0].Product == similar[1].Product {
+		t.Error("Duplicate product names should only be used once")
+	}
+}
+
+func TestPromptTemplateRender(t *testing.T) {
+	categories := []models.Category{
+		{ID: 1, Category: "Beef"},
+		{ID: 17, Category: "Spices & Herbs"},
+	}
+	examples := []models.Purchase{
+		{Product: "Stock Pots Veal", CategoryId: sql.NullInt64{Int64: 17, Valid: true}},
+	}
+	purchase := models.Purchase{Product: "Stock Pots Chicken", Price: "0.99"}
+
+	prompt, err := DefaultPromptTemplate().Render(categories, examples, purchase, "")
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+
+	expectedParts := []string{
+		"ID: 1, Category: Beef\n",
+		"ID: 17, Category: Spices & Herbs\n",
+		"Stock Pots Veal -> {\"ID\": 17} (Spices & Herbs)\n",
+	}
+	for _, part := range expectedParts {
+		if !strings.Contains(prompt, part) {
+			t.Errorf("Expected prompt to contain %q", part)
+		}
+	}
+	if !strings.HasSuffix(prompt, "\n\nStock Pots Chicken bought for 0.99") {
+		t.Error("Expected prompt to end with the purchase being categorized")
+	}
+
+	withoutExamples, _ := DefaultPromptTemplate().Render(categories, nil, purchase, "")
+	if strings.Contains(withoutExamples, "Examples of how") {
+		t.Error("Expected no examples section when there are no examples")
+	}
+
+	withStore, _ := DefaultPromptTemplate().Render(categories, nil, purchase, "Lidl")
+	if !strings.HasSuffix(withStore, "Stock Pots Chicken bought for 0.99 at Lidl") {
+		t.Errorf("Expected the store after the purchase, got %q", withStore)
+	}
+}
+
+func TestLoadPromptTemplate(t *testing.T) {
+	path := "test_prompt.tmpl"
+	defer os.Remove(path)
+
+	loaded, err := LoadPromptTemplate("")
+	if err != nil || loaded.Version != PromptVersion {
+		t.Fatalf("Expected the built-in prompt for an empty path, got %+v, %v", loaded, err)
+	}
+
+	os.WriteFile(path, []byte(`{{range .Examples}}{{.Product}}={{.Category}};{{end}}{{.Product}} ({{.Price}})`), 0644)
+	loaded, err = LoadPromptTemplate(path)
+	if err != nil {
+		t.Fatalf("LoadPromptTemplate() error = %v", err)
+	}
+	if !strings.HasPrefix(loaded.Version, "test_prompt-") {
+		t.Errorf("Expected the version to start with the file name, got %s", loaded.Version)
+	}
+
+	prompt, err := loaded.Render(
+		[]models.Category{{ID: 2, Category: "Meat"}},
+		[]models.Purchase{{Product: "Beef Mince", CategoryId: sql.NullInt64{Int64: 2, Valid: true}}},
+		models.Purchase{Product: "Pork Mince", Price: "3.10"},
+		"",
+	)
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	if prompt != "Beef Mince=Meat;Pork Mince (3.10)" {
+		t.Errorf("Unexpected prompt %q", prompt)
+	}
+
+	// Editing the template must change its version
+	os.WriteFile(path, []byte(`{{.Product}}`), 0644)
+	edited, _ := LoadPromptTemplate(path)
+	if edited.Version == loaded.Version {
+		t.Error("Expected a new version after editing the template")
+	}
+
+	os.WriteFile(path, []byte(`{{.Product`), 0644)
+	if _, err := LoadPromptTemplate(path); err == nil {
+		t.Error("Expected an error for an invalid template")
+	}
+
+	os.WriteFile(path, []byte(`{{.Shop}}`), 0644)
+	broken, _ := LoadPromptTemplate(path)
+	if _, err := broken.Render(nil, nil, models.Purchase{}, ""); err == nil {
+		t.Error("Expected an error for an unknown variable")
+	}
+}
@@ -1,6 +1,8 @@
 package services
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
 	"log"
 	"os"
@@ -74,70 +76,103 @@ func AssignPurchases() error {
 	return nil
 }
 
-func TestLLM() {
-	// Example: Call Ollama with your deepseek model
+// CategorizePurchases assigns a category to every unassigned purchase using
+// the categorizer named in the options. Cancelling ctx skips the purchases
+// that have not been started yet
+func CategorizePurchases(ctx context.Context, opts CategorizeOptions) error {
 	db, err := database.OpenDatabase()
 	if err != nil {
 		log.Fatal("Error opening database: ", err)
 	}
 
-	var purchasesWithNullCategoryId []models.Purchase
-	purchasesWithNullCategoryId, err = database.GetUnassignedPurchases(db)
-	if err != nil {
-		fmt.Errorf("getting unassigned purchases failed: %w", err)
+	// SQLite allows a single writer, sharing one connection makes concurrent
+	// workers queue for it instead of failing with "database is locked"
+	if opts.Workers > 1 {
+		db.SetMaxOpenConns(1)
 	}
 
-	var categories = database.GetAllCategories(db)
-
-	prompt := `You are an AI assistant that helps to categorize purchases. 
-
-TASK: Categorize the following purchase into one of the available categories.
-
-IMPORTANT INSTRUCTIONS:
-1. Take your time to think carefully about what this product actually is.
-2. Consider specific keywords and context clues in the purchase description.
-3. If the item contains multiple ingredients or components, focus on the main ingredient.
-4. For prepared foods, categorize based on the primary component.
+	categorizer, err := NewCategorizer(ctx, db, opts)
+	if err != nil {
+		return err
+	}
 
-REQUIRED RESPONSE FORMAT:
-Your final answer MUST be provided in valid JSON format with a single 'ID' field containing the category ID as a number. Example: {"ID": 1}
+	return AutoAssignPurchases(ctx, db, categorizer, opts.Workers)
+}
 
-DO NOT include any explanations, reasoning, or additional text in your output - ONLY the JSON object.
+// AutoAssignPurchases categorizes all unassigned purchases with the given
+// categorizer, running up to workers categorizations at the same time, and
+// stores the results in the order the purchases were read
+func AutoAssignPurchases(ctx context.Context, db *sql.DB, categorizer Categorizer, workers int) error {
+	var purchasesWithNullCategoryId []models.Purchase
+	purchasesWithNullCategoryId, err := database.GetUnassignedPurchases(db)
+	if err != nil {
+		return fmt.Errorf("getting unassigned purchases failed: %w", err)
+	}
 
-`
-	var categoryListString string
-	categoryListString = "Available categories: \n"
-	for _, category := range *categories {
-		categoryListString += fmt.Sprintf("ID: %d, Category: %s \n", category.ID, category.Category)
+	type failure struct {
+		purchase models.Purchase
+		reason   string
 	}
+	var failures []failure
+
+	total := len(purchasesWithNullCategoryId)
+	done := 0
+	assigned := 0
+	categorizeConcurrently(ctx, categorizer, purchasesWithNullCategoryId, workers, func(r categorizeResult) {
+		done++
+		p := r.purchase
+		id := r.id
+
+		if r.err != nil {
+			log.Printf("[%d/%d] Error categorizing '%s' with %s categorizer: %v", done, total, p.Product, categorizer.Name(), r.err)
+			failures = append(failures, failure{purchase: p, reason: FailureReason(r.err)})
+			return
+		}
 
-	prompt += categoryListString + "\n"
-	for _, p := range purchasesWithNullCategoryId {
-		fmt.Println(prompt)
-		response, err := CallOllama("deepseek-r1:7b", prompt+p.Product+" bought for "+p.Price)
+		categoryName, err := database.GetCategoryNameByID(db, id)
+		if err != nil {
+			log.Printf("Error getting category name by ID: %v", err)
+			failures = append(failures, failure{purchase: p, reason: fmt.Sprintf("category %d does not exist", id)})
+			return
+		}
+		fmt.Printf("[%d/%d] Parsed category ID: %d, category name: %s for purchase %s bought for %s\n", done, total, id, categoryName, p.Product, p.Price)
 
+		_, err = database.ChangePurchaseCategory(db, &id, &p.Id)
 		if err != nil {
-			log.Printf("Error calling Ollama: %v", err)
-			continue
-		} else {
-			id, err := ParseLLMResponse(response)
-			if err != nil {
-				log.Printf("Error parsing LLM response: %v", err)
-				continue
-			}
-			categoryName, err := database.GetCategoryNameByID(db, id)
-			if err != nil {
-				log.Printf("Error getting category name by ID: %v", err)
-				continue
-			}
-			fmt.Printf("Parsed category ID: %d, category name: %s for purchase %s bought for %s\n", id, categoryName, p.Product, p.Price)
+			log.Printf("Error changing purchase category: %v", err)
+			failures = append(failures, failure{purchase: p, reason: err.Error()})
+			return
+		}
+		assigned++
 
-			_, err = database.ChangePurchaseCategory(db, &id, &p.Id)
+		if r.audit != nil {
+			err = r.audit()
 			if err != nil {
-				log.Printf("Error changing purchase category: %v", err)
-				continue
+				log.Printf("Error recording the audit of '%s': %v", p.Product, err)
 			}
 		}
 
+		// After an interrupt nothing is left to categorize with what is learned
+		if learner, ok := categorizer.(historyLearner); ok && ctx.Err() == nil {
+			p.CategoryId = sql.NullInt64{Int64: int64(id), Valid: true}
+			learner.Learn(ctx, p)
+		}
+	})
+
+	if ctx.Err() != nil {
+		fmt.Printf("Interrupted, assigned %d of %d purchases\n", assigned, total)
+	}
+
+	if len(failures) > 0 {
+		fmt.Printf("\nFailed to categorize %d purchases:\n", len(failures))
+		for _, f := range failures {
+			fmt.Printf("  [%d] %s: %s\n", f.purchase.Id, f.purchase.Product, f.reason)
+		}
+	}
+
+	if reporter, ok := categorizer.(statsReporter); ok {
+		fmt.Println(reporter.Stats())
 	}
+
+	return nil
 }
@@ -1,21 +1,43 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
 	"os"
 	"strconv"
+	"time"
 	"whatAmIBuying/internal/database"
 	"whatAmIBuying/internal/models"
+	"whatAmIBuying/internal/render"
 )
 
-func ReadReceipts() {
+// ImportOptions configures how receipts are imported
+type ImportOptions struct {
+	// Cleanup is how product lines are cleaned before they are stored: empty
+	// to store them as read, "rules" for the deterministic rules only or "llm"
+	// to also ask the LLM about lines the rules cannot fix
+	Cleanup string
+	// Model is the Ollama model used for LLM cleanup, DefaultLLMModel if empty
+	Model string
+	// Pull downloads a missing Ollama model instead of refusing to start
+	Pull bool
+	// Timeout limits how long a single LLM request may take, 0 for no limit
+	Timeout time.Duration
+}
+
+func ReadReceipts(ctx context.Context, opts ImportOptions) {
 	db, err := database.OpenDatabase()
 	if err != nil {
 		log.Fatal("Error opening database: ", err)
 	}
 
+	cleaner, err := newConfiguredLineCleaner(ctx, db, opts)
+	if err != nil {
+		log.Fatal("Error preparing cleanup: ", err)
+	}
+
 	fileContent, err := os.ReadFile("output.json")
 	if err != nil {
 		fmt.Println("Error reading output file:", err)
@@ -42,6 +64,9 @@ func ReadReceipts() {
 
 		}
 	}
+	if cleaner != nil {
+		cleaner.cleanPurchases(ctx, data.Purchases)
+	}
 
 	var sum float64
 	for i := range data.Purchases {
@@ -57,3 +82,28 @@ func ReadReceipts() {
 	fmt.Printf("Added receipt with id %d", id)
 
 }
+
+// CheckReceiptDates writes the receipts whose date could not be parsed when
+// the database was opened, which predictions and reports leave out, in the
+// given format
+func CheckReceiptDates(format render.Format) error {
+	db, err := database.OpenDatabase()
+	if err != nil {
+		log.Fatal("Error opening database: ", err)
+	}
+
+	flagged, err := database.GetReceiptDateErrors(db)
+	if err != nil {
+		return err
+	}
+
+	table := render.NewTable("receipts", "Receipt", "Date", "Error")
+	table.Empty = "All receipt dates are valid"
+	if len(flagged) > 0 {
+		table.Title = fmt.Sprintf("%d receipts have a date that could not be parsed", len(flagged))
+	}
+	for _, r := range flagged {
+		table.AddRow(r.ReceiptID, r.Date, r.Error)
+	}
+	return render.Write(os.Stdout, format, table)
+}
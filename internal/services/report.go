@@ -0,0 +1,234 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+	"whatAmIBuying/internal/database"
+	"whatAmIBuying/internal/dates"
+	"whatAmIBuying/internal/models"
+	"whatAmIBuying/internal/render"
+)
+
+// unknownStoreName labels spending on receipts without a store
+const unknownStoreName = "Unknown store"
+
+// ReportOptions configures a spending report
+type ReportOptions struct {
+	// From is the first day reported, the zero time for no limit
+	From time.Time
+	// To is the last day reported, the zero time for no limit
+	To time.Time
+	// GroupBy is category, store, week, month or product
+	GroupBy string
+	// Format is how the report is written, a table if empty
+	Format render.Format
+}
+
+// spendingRow is a purchase with what it can be grouped by
+type spendingRow struct {
+	product   string
+	price     float64
+	receiptId int
+	store     string
+	category  sql.NullString
+	purchased time.Time
+}
+
+// loadSpendingRows reads the purchases on receipts from the start of from up
+// to the end of to, in the timezone their receipt was printed in
+func loadSpendingRows(db *sql.DB, from time.Time, to time.Time) ([]spendingRow, error) {
+	query := `SELECT pu.name, pu.price, pu.receiptId, r.store, c.Category, r.dateUtc, r.timezone
+	FROM Purchases pu
+	JOIN Receipts r ON pu.receiptId = r.id
+	LEFT JOIN Categories c ON pu.categoryId = c.id
+	WHERE r.dateError IS NULL`
+	var args []any
+	if !from.IsZero() {
+		query += ` AND r.dateUtc >= ?`
+		args = append(args, truncateToDay(from).UTC().Format(dates.DatabaseLayout))
+	}
+	if !to.IsZero() {
+		query += ` AND r.dateUtc < ?`
+		args = append(args, truncateToDay(to).AddDate(0, 0, 1).UTC().Format(dates.DatabaseLayout))
+	}
+	query += `
+	ORDER BY r.dateUtc, pu.id`
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("Query failed: %w", err)
+	}
+	defer rows.Close()
+
+	var spending []spendingRow
+	for rows.Next() {
+		var row spendingRow
+		var price, dateUtc, timezone string
+		err := rows.Scan(&row.product, &price, &row.receiptId, &row.store, &row.category, &dateUtc, &timezone)
+		if err != nil {
+			return nil, fmt.Errorf("Error scanning purchase: %w", err)
+		}
+		row.price, _ = strconv.ParseFloat(price, 64)
+
+		loc, err := dates.Location(timezone)
+		if err != nil {
+			return nil, err
+		}
+		utc, err := time.Parse(dates.DatabaseLayout, dateUtc)
+		if err != nil {
+			return nil, err
+		}
+		row.purchased = utc.In(loc)
+
+		spending = append(spending, row)
+	}
+
+	return spending, rows.Err()
+}
+
+// spendingKey returns the group of a purchase, and whether groups are
+// ordered in time rather than by spending
+func spendingKey(row spendingRow, groupBy string) (string, bool, error) {
+	switch groupBy {
+	case "category":
+		return row.category.String, false, nil
+	case "store":
+		if row.store == "" {
+			return unknownStoreName, false, nil
+		}
+		return row.store, false, nil
+	case "week":
+		return periodStart(row.purchased, "week").Format("2006-01-02"), true, nil
+	case "month":
+		return row.purchased.Format("2006-01"), true, nil
+	case "product":
+		if name := NormalizeProductName(row.product); name != "" {
+			return name, false, nil
+		}
+		return row.product, false, nil
+	default:
+		return "", false, fmt.Errorf("unknown grouping %q, expected category, store, week, month or product", groupBy)
+	}
+}
+
+// groupSpending sums purchases by group, ordered by time for periods and by
+// spending otherwise. Uncategorized purchases are summed on their own and
+// left out of the groups when grouping by category
+func groupSpending(rows []spendingRow, groupBy string) ([]models.SpendingGroup, models.SpendingGroup, error) {
+	groups := make(map[string]*models.SpendingGroup)
+	receipts := make(map[string]map[int]bool)
+	uncategorized := models.SpendingGroup{Key: uncategorizedName}
+	uncategorizedReceipts := make(map[int]bool)
+	chronological := false
+
+	for _, row := range rows {
+		if !row.category.Valid {
+			uncategorized.Total += row.price
+			uncategorized.Purchases++
+			uncategorizedReceipts[row.receiptId] = true
+			if groupBy == "category" {
+				continue
+			}
+		}
+
+		key, inTime, err := spendingKey(row, groupBy)
+		if err != nil {
+			return nil, models.SpendingGroup{}, err
+		}
+		chronological = inTime
+
+		g, ok := groups[key]
+		if !ok {
+			g = &models.SpendingGroup{Key: key}
+			groups[key] = g
+			receipts[key] = make(map[int]bool)
+		}
+		g.Total += row.price
+		g.Purchases++
+		receipts[key][row.receiptId] = true
+	}
+	uncategorized.Receipts = len(uncategorizedReceipts)
+
+	result := make([]models.SpendingGroup, 0, len(groups))
+	for key, g := range groups {
+		g.Receipts = len(receipts[key])
+		result = append(result, *g)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if !chronological && result[i].Total != result[j].Total {
+			return result[i].Total > result[j].Total
+		}
+		return result[i].Key < result[j].Key
+	})
+	return result, uncategorized, nil
+}
+
+// ReportSpending prints the spending between two days grouped by category,
+// store, week, month or product, with the uncategorized spending on its own
+func ReportSpending(opts ReportOptions) error {
+	db, err := database.OpenDatabase()
+	if err != nil {
+		log.Fatal("Error opening database: ", err)
+	}
+
+	if _, _, err := spendingKey(spendingRow{}, opts.GroupBy); err != nil {
+		return err
+	}
+
+	rows, err := loadSpendingRows(db, opts.From, opts.To)
+	if err != nil {
+		return err
+	}
+	groups, uncategorized, err := groupSpending(rows, opts.GroupBy)
+	if err != nil {
+		return err
+	}
+
+	total := models.SpendingGroup{Key: "Total"}
+	allReceipts := make(map[int]bool)
+	for _, row := range rows {
+		total.Total += row.price
+		total.Purchases++
+		allReceipts[row.receiptId] = true
+	}
+	total.Receipts = len(allReceipts)
+
+	table := render.NewTable("groups", groupByTitle(opts.GroupBy), "Total", "Purchases", "Receipts", "Average")
+	addSpendingRows(table, groups)
+	summary := render.NewTable("summary", "Spending", "Total", "Purchases", "Receipts", "Average")
+	addSpendingRows(summary, []models.SpendingGroup{total, uncategorized})
+
+	return render.Write(os.Stdout, opts.Format, table, summary)
+}
+
+// addSpendingRows adds the totals, counts and average price of the groups
+func addSpendingRows(table *render.Table, groups []models.SpendingGroup) {
+	for _, g := range groups {
+		average := 0.0
+		if g.Purchases > 0 {
+			average = g.Total / float64(g.Purchases)
+		}
+		table.AddRow(g.Key, g.Total, g.Purchases, g.Receipts, average)
+	}
+}
+
+// groupByTitle is the heading of the grouping column of a report
+func groupByTitle(groupBy string) string {
+	switch groupBy {
+	case "category":
+		return "Category"
+	case "store":
+		return "Store"
+	case "week":
+		return "Week"
+	case "month":
+		return "Month"
+	default:
+		return "Product"
+	}
+}
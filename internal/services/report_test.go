@@ -0,0 +1,103 @@
+package services
+
+import (
+	"database/sql"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestGroupSpending(t *testing.T) {
+	row := func(product string, price float64, receiptId int, store string, category string, date string) spendingRow {
+		d, _ := time.Parse("2006-01-02", date)
+		return spendingRow{
+			product:   product,
+			price:     price,
+			receiptId: receiptId,
+			store:     store,
+			category:  sql.NullString{String: category, Valid: category != ""},
+			purchased: d,
+		}
+	}
+	rows := []spendingRow{
+		row("Whole Milk", 1.50, 1, "Lidl", "Dairy", "2025-01-06"),
+		row("Chicken Breast", 4.00, 1, "Lidl", "Meat", "2025-01-06"),
+		row("Kitchen Towels", 2.99, 1, "Lidl", "", "2025-01-06"),
+		row("Whole Milk", 1.50, 2, "", "Dairy", "2025-01-14"),
+		row("Cheddar", 2.50, 3, "Tesco", "Dairy", "2025-02-03"),
+	}
+
+	tests := []struct {
+		groupBy   string
+		keys      []string
+		totals    []float64
+		purchases []int
+		receipts  []int
+	}{
+		{"category", []string{"Dairy", "Meat"}, []float64{5.50, 4.00}, []int{3, 1}, []int{3, 1}},
+		{"store", []string{"Lidl", "Tesco", unknownStoreName}, []float64{8.49, 2.50, 1.50}, []int{3, 1, 1}, []int{1, 1, 1}},
+		{"week", []string{"2025-01-06", "2025-01-13", "2025-02-03"}, []float64{8.49, 1.50, 2.50}, []int{3, 1, 1}, []int{1, 1, 1}},
+		{"month", []string{"2025-01", "2025-02"}, []float64{9.99, 2.50}, []int{4, 1}, []int{2, 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.groupBy, func(t *testing.T) {
+			groups, uncategorized, err := groupSpending(rows, tt.groupBy)
+			if err != nil {
+				t.Fatalf("groupSpending() error = %v", err)
+			}
+			if len(groups) != len(tt.keys) {
+				t.Fatalf("Expected groups %v, got %+v", tt.keys, groups)
+			}
+			for i, g := range groups {
+				if g.Key != tt.keys[i] || math.Abs(g.Total-tt.totals[i]) > 1e-9 || g.Purchases != tt.purchases[i] || g.Receipts != tt.receipts[i] {
+					t.Errorf("Group %d = %+v, want %s %.2f %d %d", i, g, tt.keys[i], tt.totals[i], tt.purchases[i], tt.receipts[i])
+				}
+			}
+			if uncategorized.Total != 2.99 || uncategorized.Purchases != 1 || uncategorized.Receipts != 1 {
+				t.Errorf("Unexpected uncategorized spending %+v", uncategorized)
+			}
+		})
+	}
+
+	if _, _, err := groupSpending(rows, "year"); err == nil {
+		t.Error("Expected an error for an unknown grouping")
+	}
+}
+
+func TestLoadSpendingRows(t *testing.T) {
+	db, cleanup := setupTestDBForServices(t)
+	defer cleanup()
+
+	for _, date := range []string{"2025-01-05 18:00:00", "2025-01-06 10:00:00", "2025-01-31 23:30:00", "not a date"} {
+		result, _ := db.Exec("INSERT INTO Receipts (date, amount) VALUES (?, ?)", date, "1.00")
+		receiptId, _ := result.LastInsertId()
+		db.Exec("INSERT INTO Purchases (name, price, receiptId, categoryId) VALUES (?, ?, ?, ?)", "Whole Milk", "1.00", receiptId, 1)
+		db.Exec("INSERT INTO Purchases (name, price, receiptId) VALUES (?, ?, ?)", "Kitchen Towels", "2.99", receiptId)
+	}
+	migrateTestDB(t, db)
+
+	from := time.Date(2025, 1, 6, 0, 0, 0, 0, time.Local)
+	to := time.Date(2025, 1, 31, 0, 0, 0, 0, time.Local)
+	rows, err := loadSpendingRows(db, from, to)
+	if err != nil {
+		t.Fatalf("loadSpendingRows() error = %v", err)
+	}
+
+	// The 5th is before the range, the last day is reported whole and the
+	// receipt with an invalid date is left out
+	if len(rows) != 4 {
+		t.Fatalf("Expected 4 purchases, got %+v", rows)
+	}
+	if rows[0].category.String != "Dairy" || rows[1].category.Valid {
+		t.Errorf("Expected Dairy then an uncategorized purchase, got %+v", rows[:2])
+	}
+	if got := rows[3].purchased.Format("2006-01-02 15:04"); got != "2025-01-31 23:30" {
+		t.Errorf("Expected the local time of the receipt, got %s", got)
+	}
+
+	rows, err = loadSpendingRows(db, time.Time{}, time.Time{})
+	if err != nil || len(rows) != 6 {
+		t.Errorf("Expected every purchase with a valid date without limits, got %d, %v", len(rows), err)
+	}
+}
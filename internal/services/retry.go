@@ -0,0 +1,57 @@
+package services
+
+import (
+	"context"
+	"time"
+)
+
+// RetryPolicy bounds how often and how fast failed requests are retried
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first one
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// DefaultRetryPolicy retries transient failures twice, waiting 1s and then 2s
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: time.Second,
+	MaxBackoff:     30 * time.Second,
+}
+
+// Backoff returns how long to wait before the given retry, counting from 1
+func (p RetryPolicy) Backoff(retry int) time.Duration {
+	backoff := p.InitialBackoff
+	for i := 1; i < retry; i++ {
+		backoff *= 2
+		if backoff >= p.MaxBackoff {
+			return p.MaxBackoff
+		}
+	}
+	return backoff
+}
+
+// Do calls fn until it succeeds, fails with an error that is not transient,
+// runs out of attempts or ctx is cancelled. onRetry, if set, is called before
+// waiting for the next attempt
+func (p RetryPolicy) Do(ctx context.Context, fn func() error, onRetry func(retry int, wait time.Duration, err error)) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = fn()
+		if err == nil || !IsTransient(err) || attempt >= p.MaxAttempts {
+			return err
+		}
+
+		wait := p.Backoff(attempt)
+		if onRetry != nil {
+			onRetry(attempt, wait, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+	}
+}
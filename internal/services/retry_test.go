@@ -0,0 +1,122 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+	"whatAmIBuying/internal/models"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 10, InitialBackoff: time.Second, MaxBackoff: 5 * time.Second}
+
+	tests := []struct {
+		retry    int
+		expected time.Duration
+	}{
+		{retry: 1, expected: time.Second},
+		{retry: 2, expected: 2 * time.Second},
+		{retry: 3, expected: 4 * time.Second},
+		{retry: 4, expected: 5 * time.Second},
+		{retry: 9, expected: 5 * time.Second},
+	}
+
+	for _, tt := range tests {
+		if backoff := policy.Backoff(tt.retry); backoff != tt.expected {
+			t.Errorf("Backoff(%d) = %v, want %v", tt.retry, backoff, tt.expected)
+		}
+	}
+}
+
+func TestRetryPolicyDo(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+	transient := &OllamaError{Kind: ErrKindConnection}
+	permanent := &OllamaError{Kind: ErrKindModelNotFound}
+
+	tests := []struct {
+		name         string
+		errs         []error
+		wantAttempts int
+		wantErr      error
+	}{
+		{name: "Success", errs: []error{nil}, wantAttempts: 1, wantErr: nil},
+		{name: "Transient then success", errs: []error{transient, nil}, wantAttempts: 2, wantErr: nil},
+		{name: "Permanent", errs: []error{permanent}, wantAttempts: 1, wantErr: permanent},
+		{name: "Out of attempts", errs: []error{transient, transient, transient, nil}, wantAttempts: 3, wantErr: transient},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			retries := 0
+			err := policy.Do(context.Background(), func() error {
+				attempts++
+				return tt.errs[attempts-1]
+			}, func(int, time.Duration, error) { retries++ })
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Do() error = %v, want %v", err, tt.wantErr)
+			}
+			if attempts != tt.wantAttempts {
+				t.Errorf("Expected %d attempts, got %d", tt.wantAttempts, attempts)
+			}
+			if retries != attempts-1 {
+				t.Errorf("Expected onRetry to be called %d times, got %d", attempts-1, retries)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyDoCancelled(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Hour, MaxBackoff: time.Hour}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	attempts := 0
+	err := policy.Do(ctx, func() error {
+		attempts++
+		return &OllamaError{Kind: ErrKindConnection}
+	}, func(int, time.Duration, error) { cancel() })
+
+	if err == nil || attempts != 1 {
+		t.Errorf("Expected to stop waiting once cancelled, got %d attempts and error %v", attempts, err)
+	}
+}
+
+func TestLLMCategorizerRetriesTransientFailures(t *testing.T) {
+	db, cleanup := setupTestDBForServices(t)
+	defer cleanup()
+
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"response":"{\"ID\": 3}","done":true}`))
+	}))
+	defer server.Close()
+	previousHost := OllamaHost
+	OllamaHost = server.URL
+	defer func() { OllamaHost = previousHost }()
+
+	categorizer, err := NewLLMCategorizer(db, "test-model")
+	if err != nil {
+		t.Fatalf("NewLLMCategorizer() error = %v", err)
+	}
+	categorizer.Retry = RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+
+	id, err := categorizer.Categorize(context.Background(), models.Purchase{Product: "Vine Tomatoes"})
+	if err != nil {
+		t.Fatalf("Categorize() error = %v", err)
+	}
+	if id != 3 {
+		t.Errorf("Expected category 3, got %d", id)
+	}
+	if calls != 2 {
+		t.Errorf("Expected 2 calls, got %d", calls)
+	}
+}
@@ -0,0 +1,195 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"whatAmIBuying/internal/database"
+	"whatAmIBuying/internal/models"
+	"whatAmIBuying/internal/render"
+)
+
+// minShoppingPurchases is how often a product must have been bought, on
+// different days, before its repurchase interval is estimated
+const minShoppingPurchases = 3
+
+// minShoppingConfidence drops products so irregular or long overdue that
+// they are not worth listing
+const minShoppingConfidence = 0.05
+
+// productHistory is when a product was bought, one entry per day
+type productHistory struct {
+	name string
+	days []time.Time
+}
+
+// ShoppingList returns the products likely to be needed between at and the
+// end of the horizon, soonest due first. Every product's repurchase interval
+// is the median gap between the days it was bought, and only purchases up
+// to at are considered
+func ShoppingList(db *sql.DB, at time.Time, days int) ([]models.ShoppingItem, error) {
+	purchases, err := loadPurchaseRecords(db, false)
+	if err != nil {
+		return nil, err
+	}
+
+	horizonEnd := truncateToDay(at).AddDate(0, 0, max(days, 1))
+	var items []models.ShoppingItem
+	for _, item := range dueProducts(purchases, at) {
+		if item.Due.Before(horizonEnd) {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+// dueProducts predicts when every product bought often and regularly enough
+// is bought next, soonest due first, from the purchases up to at. purchases
+// must be sorted oldest first
+func dueProducts(purchases []models.PurchaseRecord, at time.Time) []models.ShoppingItem {
+	histories := make(map[string]*productHistory)
+	for _, p := range purchases {
+		if p.ReceiptDate.After(at) {
+			break
+		}
+		key := NormalizeProductName(p.Purchase.Product)
+		if key == "" {
+			continue
+		}
+
+		h, ok := histories[key]
+		if !ok {
+			h = &productHistory{}
+			histories[key] = h
+		}
+		// The latest spelling of the product is the one shown
+		h.name = p.Purchase.Product
+		day := truncateToDay(p.ReceiptDate)
+		if n := len(h.days); n == 0 || !h.days[n-1].Equal(day) {
+			h.days = append(h.days, day)
+		}
+	}
+
+	var items []models.ShoppingItem
+	for _, h := range histories {
+		item, ok := predictRepurchase(h, at)
+		if ok && item.Confidence >= minShoppingConfidence {
+			items = append(items, item)
+		}
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		if !items[i].Due.Equal(items[j].Due) {
+			return items[i].Due.Before(items[j].Due)
+		}
+		if items[i].Confidence != items[j].Confidence {
+			return items[i].Confidence > items[j].Confidence
+		}
+		return items[i].Product < items[j].Product
+	})
+	return items
+}
+
+// predictRepurchase estimates when a product is bought next. It is false
+// when the product was not bought often enough to tell
+func predictRepurchase(h *productHistory, at time.Time) (models.ShoppingItem, bool) {
+	if len(h.days) < minShoppingPurchases {
+		return models.ShoppingItem{}, false
+	}
+
+	gaps := make([]float64, 0, len(h.days)-1)
+	for i := 1; i < len(h.days); i++ {
+		gaps = append(gaps, h.days[i].Sub(h.days[i-1]).Hours()/24)
+	}
+	interval := median(gaps)
+	last := h.days[len(h.days)-1]
+
+	return models.ShoppingItem{
+		Product:    h.name,
+		LastBought: last,
+		Interval:   time.Duration(interval * 24 * float64(time.Hour)),
+		Due:        last.AddDate(0, 0, int(math.Round(interval))),
+		Confidence: repurchaseConfidence(gaps, interval, at.Sub(last).Hours()/24),
+		Purchases:  len(h.days),
+	}, true
+}
+
+// repurchaseConfidence is high for products bought at regular intervals many
+// times, and falls for products long overdue, which were probably given up
+func repurchaseConfidence(gaps []float64, interval float64, sinceLast float64) float64 {
+	mean, variance := 0.0, 0.0
+	for _, g := range gaps {
+		mean += g / float64(len(gaps))
+	}
+	for _, g := range gaps {
+		variance += (g - mean) * (g - mean) / float64(len(gaps))
+	}
+
+	regularity := 1 / (1 + math.Sqrt(variance)/mean)
+	support := 1 - 1/float64(len(gaps)+1)
+	staleness := 1.0
+	if overdue := sinceLast - 2*interval; overdue > 0 {
+		staleness = math.Exp(-overdue / interval)
+	}
+	return regularity * support * staleness
+}
+
+// median returns the middle value of values
+func median(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+// truncateToDay returns midnight at the start of the day of t
+func truncateToDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// PredictShoppingList prints the products likely to be needed at the given
+// time, soonest due first
+func PredictShoppingList(opts PredictOptions) error {
+	db, err := database.OpenDatabase()
+	if err != nil {
+		log.Fatal("Error opening database: ", err)
+	}
+
+	items, err := ShoppingList(db, opts.At, opts.Days)
+	if err != nil {
+		return err
+	}
+
+	list := render.NewTable("shopping", "Product", "Every", "Last bought", "Due", "Confidence")
+	list.Title = fmt.Sprintf("Shopping list for %s", opts.At.Format("Mon 2 Jan 2006 15:04"))
+	list.Empty = "Nothing is due"
+	for _, item := range items {
+		list.AddRow(item.Product, render.Fixed(item.Interval.Hours()/24, 0), item.LastBought, item.Due, render.Percent(item.Confidence))
+	}
+
+	// Only receipts up to the prediction time are mined, as for the list
+	baskets, err := loadBaskets(db, "product", opts.At)
+	if err != nil {
+		return err
+	}
+	var products []string
+	for _, item := range items {
+		products = append(products, NormalizeProductName(item.Product))
+	}
+	alsoBuy := render.NewTable("also_buy", "Product", "With", "Confidence")
+	alsoBuy.Title = "You usually also buy"
+	alsoBuy.Empty = "Nothing else"
+	for _, s := range AlsoBuy(MineAssociationRules(baskets, DefaultBasketOptions), products) {
+		alsoBuy.AddRow(s.Item, strings.Join(s.Because, " + "), render.Percent(s.Confidence))
+	}
+
+	return render.Write(os.Stdout, opts.Format, list, alsoBuy)
+}
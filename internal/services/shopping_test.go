@@ -0,0 +1,95 @@
+package services
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestShoppingList(t *testing.T) {
+	db, cleanup := setupTestDBForServices(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	purchases := map[string][]string{
+		// Every 5 days
+		"Milk 2L": {"2025-01-01", "2025-01-06", "2025-01-11", "2025-01-16"},
+		// Every 6 weeks
+		"Kitchen Towels": {"2024-10-01", "2024-11-12", "2024-12-24"},
+		// Too few purchases to tell
+		"Birthday Cake": {"2025-01-10"},
+		// Bought after the prediction time, which must not be seen
+		"Ice Cream": {"2025-01-17", "2025-01-18", "2025-01-19"},
+	}
+	for product, dates := range purchases {
+		for _, date := range dates {
+			result, _ := db.ExecContext(ctx, "INSERT INTO Receipts (date, amount) VALUES (?, ?)", date+" 10:00:00", "1.00")
+			receiptId, _ := result.LastInsertId()
+			db.ExecContext(ctx, "INSERT INTO Purchases (name, price, receiptId, categoryId) VALUES (?, ?, ?, ?)",
+				product, "1.00", receiptId, nil)
+		}
+	}
+	migrateTestDB(t, db)
+
+	at := time.Date(2025, 1, 16, 18, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		days     int
+		expected []string
+	}{
+		{"Nothing due today", 1, nil},
+		{"Milk due within a week", 7, []string{"Milk 2L"}},
+		{"Towels due within three weeks", 21, []string{"Milk 2L", "Kitchen Towels"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items, err := ShoppingList(db, at, tt.days)
+			if err != nil {
+				t.Fatalf("ShoppingList() error = %v", err)
+			}
+			if len(items) != len(tt.expected) {
+				t.Fatalf("Expected %v, got %+v", tt.expected, items)
+			}
+			for i, product := range tt.expected {
+				if items[i].Product != product {
+					t.Errorf("Item %d = %q, want %q", i, items[i].Product, product)
+				}
+			}
+		})
+	}
+
+	items, _ := ShoppingList(db, at, 7)
+	milk := items[0]
+	if milk.Interval != 5*24*time.Hour || !milk.Due.Equal(time.Date(2025, 1, 21, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected milk every 5 days, due on the 21st, got %+v", milk)
+	}
+	// Perfectly regular with 3 gaps
+	if math.Abs(milk.Confidence-0.75) > 1e-9 {
+		t.Errorf("Expected a confidence of 0.75, got %f", milk.Confidence)
+	}
+}
+
+func TestRepurchaseConfidence(t *testing.T) {
+	tests := []struct {
+		name      string
+		gaps      []float64
+		sinceLast float64
+		expected  float64
+	}{
+		{"Regular", []float64{7, 7, 7}, 3, 0.75},
+		{"Irregular", []float64{2, 12}, 3, (2.0 / 3) * (1 / (1 + 5.0/7))},
+		{"Long overdue", []float64{7, 7, 7}, 21, 0.75 * math.Exp(-1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := repurchaseConfidence(tt.gaps, median(tt.gaps), tt.sinceLast)
+			if math.Abs(got-tt.expected) > 1e-9 {
+				t.Errorf("repurchaseConfidence() = %f, want %f", got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"whatAmIBuying/internal/database"
+	"whatAmIBuying/internal/dates"
+	"whatAmIBuying/internal/models"
+)
+
+// receiptSchema is the JSON schema a vision model must follow when reading a
+// receipt photo
+const receiptSchema = `{
+	"type": "object",
+	"properties": {
+		"date": {"type": "string"},
+		"store": {"type": "string"},
+		"items": {
+			"type": "array",
+			"items": {
+				"type": "object",
+				"properties": {
+					"name": {"type": "string"},
+					"price": {"type": "number"}
+				},
+				"required": ["name", "price"]
+			}
+		},
+		"total": {"type": "number"}
+	},
+	"required": ["date", "store", "items", "total"]
+}`
+
+const receiptExtractionPrompt = `This is a photo of a supermarket receipt. Read it and respond ONLY with a JSON object holding:
+- date: the date and time of the purchase as YYYY-MM-DD HH:MM:SS
+- store: the name of the store
+- items: every product bought, with its name and the price paid for the whole line, leaving out discounts, deposits and payment lines
+- total: the total amount paid`
+
+// visionReceipt is the receipt as answered by the vision model
+type visionReceipt struct {
+	Date  string `json:"date"`
+	Store string `json:"store"`
+	Items []struct {
+		Name  string  `json:"name"`
+		Price float64 `json:"price"`
+	} `json:"items"`
+	Total float64 `json:"total"`
+}
+
+// ExtractReceipt sends a receipt photo to a multimodal Ollama model and
+// returns the receipt it reads, with the date in the database format
+func ExtractReceipt(ctx context.Context, model string, imagePath string) (models.Receipt, error) {
+	image, err := os.ReadFile(imagePath)
+	if err != nil {
+		return models.Receipt{}, fmt.Errorf("error reading receipt image: %w", err)
+	}
+
+	result, err := callOllamaStreamAt(ctx, OllamaHost, OllamaRequest{
+		Model:  model,
+		Prompt: receiptExtractionPrompt,
+		Format: json.RawMessage(receiptSchema),
+		Images: []string{base64.StdEncoding.EncodeToString(image)},
+	}, nil)
+	if err != nil {
+		return models.Receipt{}, fmt.Errorf("error calling Ollama: %w", err)
+	}
+
+	return parseVisionReceipt(result.Response)
+}
+
+// parseVisionReceipt turns the answer of a vision model into a receipt
+func parseVisionReceipt(response string) (models.Receipt, error) {
+	var answer visionReceipt
+	err := json.Unmarshal([]byte(strings.TrimSpace(response)), &answer)
+	if err != nil {
+		return models.Receipt{}, fmt.Errorf("invalid receipt %q: %w", response, err)
+	}
+
+	date, err := dates.Parse(answer.Date, database.ReceiptLocation)
+	if err != nil {
+		return models.Receipt{}, err
+	}
+
+	receipt := models.Receipt{
+		Date:   date.Format(dates.DatabaseLayout),
+		Store:  strings.TrimSpace(answer.Store),
+		Amount: fmt.Sprintf("%.2f", answer.Total),
+	}
+	for _, item := range answer.Items {
+		name := strings.TrimSpace(item.Name)
+		if name == "" {
+			continue
+		}
+		receipt.Purchases = append(receipt.Purchases, models.Purchase{
+			Product:    name,
+			Price:      fmt.Sprintf("%.2f", item.Price),
+			PriceFloat: item.Price,
+		})
+	}
+	if len(receipt.Purchases) == 0 {
+		return models.Receipt{}, fmt.Errorf("no line items found on the receipt")
+	}
+
+	return receipt, nil
+}
+
+// receiptItemsTotal returns the sum of the prices of all purchases on a receipt
+func receiptItemsTotal(receipt models.Receipt) float64 {
+	var sum float64
+	for _, p := range receipt.Purchases {
+		sum += p.PriceFloat
+	}
+	return sum
+}
+
+// VisionOptions configures how receipt photos are read by a vision model
+type VisionOptions struct {
+	// Model is the multimodal Ollama model, DefaultVisionModel if empty
+	Model string
+	// Pull downloads a missing Ollama model instead of refusing to start
+	Pull bool
+	// Timeout limits how long reading a single photo may take, 0 for no limit
+	Timeout time.Duration
+}
+
+// ImportReceiptImage reads a receipt photo with a vision model and adds the
+// receipt and its purchases to the database
+func ImportReceiptImage(ctx context.Context, opts VisionOptions, imagePath string) error {
+	db, err := database.OpenDatabase()
+	if err != nil {
+		log.Fatal("Error opening database: ", err)
+	}
+
+	if opts.Model == "" {
+		opts.Model = DefaultVisionModel
+	}
+	if err := EnsureModel(ctx, opts.Model, opts.Pull, os.Stderr); err != nil {
+		return err
+	}
+
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	receipt, err := ExtractReceipt(ctx, opts.Model, imagePath)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s at %s\n", receipt.Date, receipt.Store)
+	for _, p := range receipt.Purchases {
+		fmt.Printf("  %-40s %8s\n", p.Product, p.Price)
+	}
+	fmt.Printf("  %-40s %8s\n", "Total", receipt.Amount)
+
+	total, _ := strconv.ParseFloat(receipt.Amount, 64)
+	if sum := receiptItemsTotal(receipt); math.Abs(sum-total) >= 0.005 {
+		fmt.Printf("Warning: the line items add up to %.2f, check the receipt for misread lines\n", sum)
+	}
+
+	id, err := database.AddReceipt(receipt, db)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Added receipt with id %d\n", id)
+	return nil
+}
@@ -0,0 +1,82 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestExtractReceipt(t *testing.T) {
+	imagePath := "test_receipt.png"
+	image := []byte("\x89PNG fake receipt photo")
+	os.WriteFile(imagePath, image, 0644)
+	defer os.Remove(imagePath)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req OllamaRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Model != "vision-model" {
+			t.Errorf("Expected model vision-model, got %s", req.Model)
+		}
+		if len(req.Images) != 1 || req.Images[0] != base64.StdEncoding.EncodeToString(image) {
+			t.Errorf("Expected the photo as a base64 image, got %v", req.Images)
+		}
+		if len(req.Format) == 0 {
+			t.Error("Expected a JSON schema in the request")
+		}
+
+		json.NewEncoder(w).Encode(OllamaResponse{
+			Response: `{"date": "2025-01-26 12:02", "store": " Lidl ", "items": [
+				{"name": "Greek Natural Yogurt", "price": 1.65},
+				{"name": "", "price": 0.35},
+				{"name": "Kitchen Towels", "price": 2.99}
+			], "total": 4.64}`,
+			Done: true,
+		})
+	}))
+	defer server.Close()
+	previousHost := OllamaHost
+	OllamaHost = server.URL
+	defer func() { OllamaHost = previousHost }()
+
+	receipt, err := ExtractReceipt(context.Background(), "vision-model", imagePath)
+	if err != nil {
+		t.Fatalf("ExtractReceipt() error = %v", err)
+	}
+
+	if receipt.Date != "2025-01-26 12:02:00" {
+		t.Errorf("Expected the date in database format, got %s", receipt.Date)
+	}
+	if receipt.Store != "Lidl" || receipt.Amount != "4.64" {
+		t.Errorf("Unexpected store %q or amount %q", receipt.Store, receipt.Amount)
+	}
+	if len(receipt.Purchases) != 2 {
+		t.Fatalf("Expected 2 purchases, got %d", len(receipt.Purchases))
+	}
+	if p := receipt.Purchases[1]; p.Product != "Kitchen Towels" || p.Price != "2.99" || p.PriceFloat != 2.99 {
+		t.Errorf("Unexpected purchase %+v", p)
+	}
+}
+
+func TestParseVisionReceiptErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+	}{
+		{"Not JSON", "I can see a receipt"},
+		{"Unknown date", `{"date": "last Tuesday", "store": "Lidl", "items": [{"name": "Milk", "price": 1}], "total": 1}`},
+		{"No items", `{"date": "2025-01-26", "store": "Lidl", "items": [], "total": 0}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseVisionReceipt(tt.response); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
@@ -1,15 +1,36 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
 	"whatAmIBuying/internal/services"
 
 	_ "modernc.org/sqlite"
 )
 
 func main() {
+	// The first Ctrl-C cancels ctx so commands can stop cleanly, a second one
+	// kills the program
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			command(ctx, os.Args[2:])
+			return
+		}
+	}
+
 	assignFlag := flag.Bool("a", false, "assign mode (shorthand)")
 	assignFlagLong := flag.Bool("assign", false, "assign mode")
 	readFlag := flag.Bool("r", false, "read mode (shorthand)")
@@ -18,10 +39,47 @@ func main() {
 	predictFlagLong := flag.Bool("predict", false, "predict mode")
 	llmFlag := flag.Bool("l", false, "LLM mode (shorthand)")
 	llmFlagLong := flag.Bool("llm", false, "LLM mode")
+	categorizerFlag := flag.String("c", "", "categorizer used for automatic assignment: llm, embedding, classifier, history, rules or auto (shorthand)")
+	categorizerFlagLong := flag.String("categorizer", "", "categorizer used for automatic assignment: llm, embedding, classifier, history, rules or auto")
+	timeoutFlag := flag.Duration("timeout", 5*time.Minute, "maximum time a single LLM request may take")
+	retriesFlag := flag.Int("retries", 2, "how often a failed LLM request is retried when the failure is transient")
+	modelFlag := flag.String("model", services.DefaultLLMModel, "Ollama model used for LLM categorization")
+	pullFlag := flag.Bool("pull", false, "pull the Ollama model if it is not installed")
+	workersFlag := flag.Int("workers", 1, "how many purchases are categorized at the same time")
+	promptFlag := flag.String("prompt", "", "prompt template file used for LLM categorization (default built-in prompt)")
+	cleanupFlag := flag.String("clean", "", "clean product lines when reading receipts: rules, or llm to also ask the LLM about lines the rules cannot fix")
+	auditFlag := flag.Bool("audit", false, "store the prompt, response and reasoning of every LLM categorization assigned, shown by purchases explain")
+	hostsFlag := flag.String("hosts", "", "comma separated Ollama servers LLM requests are spread over (default "+services.OllamaHost+")")
 
 	flag.Parse()
 
-	if *assignFlag || *assignFlagLong {
+	opts := services.CategorizeOptions{
+		Categorizer: *categorizerFlag,
+		Model:       *modelFlag,
+		Pull:        *pullFlag,
+		Timeout:     *timeoutFlag,
+		Progress:    os.Stderr,
+		Retries:     *retriesFlag,
+		Workers:     *workersFlag,
+		PromptFile:  *promptFlag,
+		Audit:       *auditFlag,
+	}
+	if *hostsFlag != "" {
+		for _, host := range strings.Split(*hostsFlag, ",") {
+			opts.Hosts = append(opts.Hosts, strings.TrimRight(strings.TrimSpace(host), "/"))
+		}
+	}
+	if *categorizerFlagLong != "" {
+		opts.Categorizer = *categorizerFlagLong
+	}
+
+	if (*assignFlag || *assignFlagLong) && opts.Categorizer != "" {
+		fmt.Printf("Assign mode activated, using %s categorizer\n", opts.Categorizer)
+		err := services.CategorizePurchases(ctx, opts)
+		if err != nil {
+			log.Fatal("Error assigning purchases: ", err)
+		}
+	} else if *assignFlag || *assignFlagLong {
 		fmt.Println("Assign mode activated")
 		err := services.AssignPurchases()
 		if err != nil {
@@ -29,12 +87,24 @@ func main() {
 		}
 	} else if *readFlag || *readFlagLong {
 		fmt.Println("Read mode activated")
-		services.ReadReceipts()
+		services.ReadReceipts(ctx, services.ImportOptions{
+			Cleanup: *cleanupFlag,
+			Model:   *modelFlag,
+			Pull:    *pullFlag,
+			Timeout: *timeoutFlag,
+		})
 	} else if *predictFlag || *predictFlagLong {
 		fmt.Println("Predict mode activated")
-		services.PredictPurchases()
+		err := services.PredictPurchases(services.PredictOptions{At: time.Now()})
+		if err != nil {
+			log.Fatal("Error predicting purchases: ", err)
+		}
 	} else if *llmFlag || *llmFlagLong {
 		fmt.Println("LLM mode activated")
-		services.TestLLM()
+		opts.Categorizer = "llm"
+		err := services.CategorizePurchases(ctx, opts)
+		if err != nil {
+			log.Fatal("Error categorizing purchases: ", err)
+		}
 	}
 }
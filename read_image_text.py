@@ -8,3 +8,8 @@ with open("imagetext.txt", "w") as file:
         res = result[idx]
         for line in res:
             file.write(line[1][0] + "\n")
+
+# The full result with boxes and confidence, read by `receipts import -engine paddle`
+import json
+with open(img_path.rsplit(".", 1)[0] + ".json", "w") as file:
+    json.dump(result, file)